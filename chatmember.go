@@ -0,0 +1,98 @@
+package gotgbot
+
+// ChatMemberTransition describes how a chat member's status changed in a ChatMemberUpdated event.
+type ChatMemberTransition string
+
+const (
+	// ChatMemberTransitionJoined means the user became a member of the chat. For MyChatMember updates, this means the
+	// bot was added to the chat.
+	ChatMemberTransitionJoined ChatMemberTransition = "joined"
+	// ChatMemberTransitionLeft means the user is no longer a member of the chat, without being banned.
+	ChatMemberTransitionLeft ChatMemberTransition = "left"
+	// ChatMemberTransitionBanned means the user was banned from the chat.
+	ChatMemberTransitionBanned ChatMemberTransition = "banned"
+	// ChatMemberTransitionUnbanned means the user was unbanned from the chat.
+	ChatMemberTransitionUnbanned ChatMemberTransition = "unbanned"
+	// ChatMemberTransitionPromoted means the user became an administrator (or the creator) of the chat.
+	ChatMemberTransitionPromoted ChatMemberTransition = "promoted"
+	// ChatMemberTransitionDemoted means the user is no longer an administrator of the chat.
+	ChatMemberTransitionDemoted ChatMemberTransition = "demoted"
+	// ChatMemberTransitionRestricted means the user was restricted in the chat.
+	ChatMemberTransitionRestricted ChatMemberTransition = "restricted"
+	// ChatMemberTransitionUnrestricted means the user's restrictions were lifted.
+	ChatMemberTransitionUnrestricted ChatMemberTransition = "unrestricted"
+)
+
+// Transitions determines all the transitions between the old and new chat member states.
+// Some updates contain multiple transitions; for example, adding a user directly as an administrator results in both
+// a ChatMemberTransitionJoined and a ChatMemberTransitionPromoted transition.
+// If nothing relevant changed (eg, an administrator's custom title was edited), the result is empty.
+func (cmu ChatMemberUpdated) Transitions() []ChatMemberTransition {
+	if cmu.OldChatMember == nil || cmu.NewChatMember == nil {
+		return nil
+	}
+
+	oldMember := cmu.OldChatMember.MergeChatMember()
+	newMember := cmu.NewChatMember.MergeChatMember()
+
+	var out []ChatMemberTransition
+	wasMember, isMember := isChatMember(oldMember), isChatMember(newMember)
+	if !wasMember && isMember {
+		out = append(out, ChatMemberTransitionJoined)
+	}
+	if wasMember && !isMember && newMember.Status != "kicked" {
+		out = append(out, ChatMemberTransitionLeft)
+	}
+
+	if oldMember.Status != "kicked" && newMember.Status == "kicked" {
+		out = append(out, ChatMemberTransitionBanned)
+	}
+	if oldMember.Status == "kicked" && newMember.Status != "kicked" {
+		out = append(out, ChatMemberTransitionUnbanned)
+	}
+
+	wasAdmin, isAdmin := isChatAdmin(oldMember), isChatAdmin(newMember)
+	if !wasAdmin && isAdmin {
+		out = append(out, ChatMemberTransitionPromoted)
+	}
+	if wasAdmin && !isAdmin {
+		out = append(out, ChatMemberTransitionDemoted)
+	}
+
+	if oldMember.Status != "restricted" && newMember.Status == "restricted" {
+		out = append(out, ChatMemberTransitionRestricted)
+	}
+	if oldMember.Status == "restricted" && newMember.Status != "restricted" && newMember.Status != "kicked" {
+		out = append(out, ChatMemberTransitionUnrestricted)
+	}
+
+	return out
+}
+
+// HasTransition checks whether the update contains the given transition.
+func (cmu ChatMemberUpdated) HasTransition(t ChatMemberTransition) bool {
+	for _, x := range cmu.Transitions() {
+		if x == t {
+			return true
+		}
+	}
+	return false
+}
+
+// isChatMember checks whether the chat member is currently part of the chat.
+// Restricted users may not be members; this is determined by the IsMember field.
+func isChatMember(m MergedChatMember) bool {
+	switch m.Status {
+	case "creator", "administrator", "member":
+		return true
+	case "restricted":
+		return m.IsMember
+	default:
+		return false
+	}
+}
+
+// isChatAdmin checks whether the chat member is the creator or an administrator of the chat.
+func isChatAdmin(m MergedChatMember) bool {
+	return m.Status == "creator" || m.Status == "administrator"
+}
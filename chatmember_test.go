@@ -0,0 +1,92 @@
+package gotgbot
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestChatMemberTransitions(t *testing.T) {
+	u := User{Id: 1, FirstName: "user"}
+
+	for _, tc := range []struct {
+		name     string
+		old      ChatMember
+		new      ChatMember
+		expected []ChatMemberTransition
+	}{
+		{
+			name:     "joined",
+			old:      ChatMemberLeft{User: u},
+			new:      ChatMemberMember{User: u},
+			expected: []ChatMemberTransition{ChatMemberTransitionJoined},
+		}, {
+			name:     "left",
+			old:      ChatMemberMember{User: u},
+			new:      ChatMemberLeft{User: u},
+			expected: []ChatMemberTransition{ChatMemberTransitionLeft},
+		}, {
+			name:     "banned",
+			old:      ChatMemberMember{User: u},
+			new:      ChatMemberBanned{User: u},
+			expected: []ChatMemberTransition{ChatMemberTransitionBanned},
+		}, {
+			name:     "unbanned",
+			old:      ChatMemberBanned{User: u},
+			new:      ChatMemberLeft{User: u},
+			expected: []ChatMemberTransition{ChatMemberTransitionUnbanned},
+		}, {
+			name:     "added as admin",
+			old:      ChatMemberLeft{User: u},
+			new:      ChatMemberAdministrator{User: u},
+			expected: []ChatMemberTransition{ChatMemberTransitionJoined, ChatMemberTransitionPromoted},
+		}, {
+			name:     "demoted",
+			old:      ChatMemberAdministrator{User: u},
+			new:      ChatMemberMember{User: u},
+			expected: []ChatMemberTransition{ChatMemberTransitionDemoted},
+		}, {
+			name:     "restricted",
+			old:      ChatMemberMember{User: u},
+			new:      ChatMemberRestricted{User: u, IsMember: true},
+			expected: []ChatMemberTransition{ChatMemberTransitionRestricted},
+		}, {
+			name:     "unrestricted",
+			old:      ChatMemberRestricted{User: u, IsMember: true},
+			new:      ChatMemberMember{User: u},
+			expected: []ChatMemberTransition{ChatMemberTransitionUnrestricted},
+		}, {
+			name:     "restricted user left",
+			old:      ChatMemberRestricted{User: u, IsMember: true},
+			new:      ChatMemberRestricted{User: u, IsMember: false},
+			expected: []ChatMemberTransition{ChatMemberTransitionLeft},
+		}, {
+			name:     "restricted user rejoined",
+			old:      ChatMemberRestricted{User: u, IsMember: false},
+			new:      ChatMemberRestricted{User: u, IsMember: true},
+			expected: []ChatMemberTransition{ChatMemberTransitionJoined},
+		}, {
+			name:     "restricted non-member banned",
+			old:      ChatMemberRestricted{User: u, IsMember: false},
+			new:      ChatMemberBanned{User: u},
+			expected: []ChatMemberTransition{ChatMemberTransitionBanned},
+		}, {
+			name:     "admin title changed",
+			old:      ChatMemberAdministrator{User: u, CustomTitle: "old"},
+			new:      ChatMemberAdministrator{User: u, CustomTitle: "new"},
+			expected: nil,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cmu := ChatMemberUpdated{OldChatMember: tc.old, NewChatMember: tc.new}
+			got := cmu.Transitions()
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("expected transitions %v, got %v", tc.expected, got)
+			}
+			for _, tr := range tc.expected {
+				if !cmu.HasTransition(tr) {
+					t.Errorf("expected HasTransition(%s) to be true", tr)
+				}
+			}
+		})
+	}
+}
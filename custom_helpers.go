@@ -20,6 +20,7 @@ func (m Message) GetLink() string {
 }
 
 // Reply is a helper function to easily call Bot.SendMessage as a reply to an existing message.
+// If the message is part of a forum topic, the reply is sent to the same topic.
 func (m Message) Reply(b *Bot, text string, opts *SendMessageOpts) (*Message, error) {
 	if opts == nil {
 		opts = &SendMessageOpts{}
@@ -29,9 +30,32 @@ func (m Message) Reply(b *Bot, text string, opts *SendMessageOpts) (*Message, er
 		opts.ReplyToMessageId = m.MessageId
 	}
 
+	return m.SendToThread(b, text, opts)
+}
+
+// SendToThread is a helper function to easily call Bot.SendMessage in the same chat as an existing message, without
+// replying to it. If the message is part of a forum topic, the new message is sent to the same topic.
+func (m Message) SendToThread(b *Bot, text string, opts *SendMessageOpts) (*Message, error) {
+	if opts == nil {
+		opts = &SendMessageOpts{}
+	}
+
+	if opts.MessageThreadId == 0 {
+		opts.MessageThreadId = m.GetThreadId()
+	}
+
 	return b.SendMessage(m.Chat.Id, text, opts)
 }
 
+// GetThreadId is a helper method to get the ID of the forum topic a message was sent in.
+// Returns 0 if the message isn't part of a forum topic.
+func (m Message) GetThreadId() int64 {
+	if !m.IsTopicMessage {
+		return 0
+	}
+	return m.MessageThreadId
+}
+
 // SendMessage is a helper function to easily call Bot.SendMessage in a chat.
 func (c Chat) SendMessage(b *Bot, text string, opts *SendMessageOpts) (*Message, error) {
 	return b.SendMessage(c.Id, text, opts)
@@ -0,0 +1,384 @@
+// Package callbackdata encodes structured payloads into inline keyboard callback data.
+//
+// Payloads are made of an action, and a set of typed parameters. They are encoded compactly into text, and optionally
+// signed to detect tampering. Payloads which don't fit in telegram's 64 byte callback data limit can be kept in a
+// server-side Store, with only a short ID sent to telegram.
+//
+// Callback queries can be routed to the handler of each action with handlers.CallbackRouter.
+package callbackdata
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+)
+
+// DefaultSignatureLength is the default number of HMAC bytes appended to signed payloads.
+const DefaultSignatureLength = 8
+
+const (
+	// paramSeparator separates the action and each parameter.
+	paramSeparator = ';'
+	// valueSeparator separates parameter names from their values.
+	valueSeparator = '='
+	// prefixTerminator ends every Prefix, so that no prefix can be the start of another; eg "cb:" and "cb2:".
+	prefixTerminator = ':'
+	// signatureSeparator separates the signature from the signed data.
+	signatureSeparator = '#'
+	// storedMarker marks payloads which are kept in the Store; it is followed by the ID of the stored payload.
+	storedMarker = '@'
+	// escapedChars are escaped with percent-encoding when used in actions, parameter names or values.
+	escapedChars = "%;=#@"
+	// storedIdLength is the number of random bytes used for the IDs of stored payloads.
+	storedIdLength = 8
+)
+
+var (
+	ErrPayloadTooLong   = errors.New("payload is too long")
+	ErrInvalidPayload   = errors.New("invalid payload")
+	ErrInvalidSignature = errors.New("invalid payload signature")
+	ErrPayloadExpired   = errors.New("payload not found in store")
+	ErrInvalidPrefix    = errors.New("invalid codec prefix")
+)
+
+// Payload is a callback action, along with its parameters.
+type Payload struct {
+	// Action identifies what the button does; for example, "delete" or "page".
+	Action string
+	// Params holds the encoded parameters of the action. Use the typed getters and setters to access them.
+	Params map[string]string
+}
+
+// NewPayload creates a new Payload for the given action, without any parameters.
+func NewPayload(action string) *Payload {
+	return &Payload{
+		Action: action,
+		Params: map[string]string{},
+	}
+}
+
+// Set sets a string parameter.
+func (p *Payload) Set(name string, value string) *Payload {
+	if p.Params == nil {
+		p.Params = map[string]string{}
+	}
+	p.Params[name] = value
+	return p
+}
+
+// SetInt sets an integer parameter. Integers are encoded in base 36, to save space.
+func (p *Payload) SetInt(name string, value int64) *Payload {
+	return p.Set(name, strconv.FormatInt(value, 36))
+}
+
+// SetBool sets a boolean parameter.
+func (p *Payload) SetBool(name string, value bool) *Payload {
+	if value {
+		return p.Set(name, "1")
+	}
+	return p.Set(name, "0")
+}
+
+// Get returns a string parameter, or an empty string if it isn't set.
+func (p *Payload) Get(name string) string {
+	return p.Params[name]
+}
+
+// GetInt returns an integer parameter set with SetInt.
+func (p *Payload) GetInt(name string) (int64, error) {
+	v, ok := p.Params[name]
+	if !ok {
+		return 0, fmt.Errorf("missing parameter %q", name)
+	}
+	i, err := strconv.ParseInt(v, 36, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid integer parameter %q: %w", name, err)
+	}
+	return i, nil
+}
+
+// GetBool returns a boolean parameter set with SetBool.
+func (p *Payload) GetBool(name string) (bool, error) {
+	switch v, ok := p.Params[name]; {
+	case !ok:
+		return false, fmt.Errorf("missing parameter %q", name)
+	case v == "1":
+		return true, nil
+	case v == "0":
+		return false, nil
+	}
+	return false, fmt.Errorf("invalid boolean parameter %q", name)
+}
+
+// Codec encodes payloads into callback data, and decodes them back.
+//
+// Payloads are encoded as the Prefix, the action, and each parameter, separated by semicolons; for example,
+// "pg:page;n=2". If the encoded payload is too long and a Store is set, the payload is kept in the Store, and the callback
+// data only contains its ID.
+//
+// Use NewCodec to create a Codec with a checked Prefix. Codecs created as struct literals are checked when encoding and
+// decoding.
+type Codec struct {
+	// Prefix is prepended to all encoded payloads. This allows for routing payloads to different handlers.
+	// It must be non-empty, and end with its only ':'; eg "pg:". This ensures that no prefix can be the start of
+	// another, so that each payload is only routed to a single handler.
+	Prefix string
+	// Secret is the key used to sign payloads with an HMAC-SHA256. If empty, payloads are not signed.
+	Secret []byte
+	// SignatureLength is the number of HMAC bytes appended to signed payloads.
+	// If 0, DefaultSignatureLength is used.
+	SignatureLength int
+	// Store keeps the payloads which are too long to fit in the callback data. If nil, encoding such payloads fails.
+	Store Store
+}
+
+// NewCodec creates a Codec with the given prefix, returning ErrInvalidPrefix if the prefix can't be used. Secret,
+// SignatureLength and Store can be set on the returned Codec.
+func NewCodec(prefix string) (Codec, error) {
+	c := Codec{Prefix: prefix}
+	if err := c.Validate(); err != nil {
+		return Codec{}, err
+	}
+	return c, nil
+}
+
+// Validate checks that the Prefix is non-empty and ends with its only ':', that it doesn't contain any of the characters
+// used to separate the parts of a payload, and that it leaves enough room for a payload in the callback data,
+// including the signature and stored payload ID, if used.
+func (c Codec) Validate() error {
+	if len(c.Prefix) < 2 || strings.IndexRune(c.Prefix, prefixTerminator) != len(c.Prefix)-1 {
+		return fmt.Errorf("%w: %q must be non-empty, and end with its only %q", ErrInvalidPrefix, c.Prefix, prefixTerminator)
+	}
+	if strings.ContainsAny(c.Prefix, escapedChars) {
+		return fmt.Errorf("%w: %q must not contain any of %q", ErrInvalidPrefix, c.Prefix, escapedChars)
+	}
+
+	// The shortest payload is a single character action.
+	minData := c.sign(c.Prefix + "a")
+	if c.Store != nil {
+		minData = c.sign(c.Prefix + string(storedMarker) + strings.Repeat("a", base64.RawURLEncoding.EncodedLen(storedIdLength)))
+	}
+	if len(minData) > gotgbot.MaxCallbackDataLength {
+		return fmt.Errorf("%w: %q is too long to fit a payload in %d bytes", ErrInvalidPrefix, c.Prefix, gotgbot.MaxCallbackDataLength)
+	}
+	return nil
+}
+
+// Encode encodes the payload into callback data, returning an error if it is too long to be used, or if the Codec is
+// invalid.
+func (c Codec) Encode(p *Payload) (string, error) {
+	if err := c.Validate(); err != nil {
+		return "", err
+	}
+
+	data := c.sign(c.Prefix + encodePayload(p))
+	if len(data) <= gotgbot.MaxCallbackDataLength {
+		return data, nil
+	}
+
+	if c.Store == nil {
+		return "", fmt.Errorf("%w: %d bytes, maximum is %d", ErrPayloadTooLong, len(data), gotgbot.MaxCallbackDataLength)
+	}
+
+	id, err := newStoredId()
+	if err != nil {
+		return "", err
+	}
+	// The stored payload doesn't need to be signed, as the server-side store can't be tampered with.
+	if err = c.Store.Set(id, encodePayload(p)); err != nil {
+		return "", fmt.Errorf("failed to store payload: %w", err)
+	}
+
+	data = c.sign(c.Prefix + string(storedMarker) + id)
+	if len(data) > gotgbot.MaxCallbackDataLength {
+		return "", fmt.Errorf("%w: prefix is too long for stored payloads", ErrPayloadTooLong)
+	}
+	return data, nil
+}
+
+// Decode decodes callback data generated by Encode, and checks the signature if a Secret is set. Returns an error if
+// the Codec is invalid.
+func (c Codec) Decode(data string) (*Payload, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(data, c.Prefix) {
+		return nil, fmt.Errorf("%w: missing prefix %q", ErrInvalidPayload, c.Prefix)
+	}
+
+	data, err := c.verify(data)
+	if err != nil {
+		return nil, err
+	}
+	data = strings.TrimPrefix(data, c.Prefix)
+
+	if strings.HasPrefix(data, string(storedMarker)) {
+		if c.Store == nil {
+			return nil, fmt.Errorf("%w: no store to load payload from", ErrInvalidPayload)
+		}
+
+		stored, ok, err := c.Store.Get(strings.TrimPrefix(data, string(storedMarker)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load payload: %w", err)
+		}
+		if !ok {
+			return nil, ErrPayloadExpired
+		}
+		data = stored
+	}
+
+	return decodePayload(data)
+}
+
+// Button creates an inline keyboard button which sends the encoded payload.
+func (c Codec) Button(text string, p *Payload) (gotgbot.InlineKeyboardButton, error) {
+	data, err := c.Encode(p)
+	if err != nil {
+		return gotgbot.InlineKeyboardButton{}, err
+	}
+	return gotgbot.InlineKeyboardButton{Text: text, CallbackData: data}, nil
+}
+
+// sign appends the signature of the data, if a Secret is set.
+func (c Codec) sign(data string) string {
+	if len(c.Secret) == 0 {
+		return data
+	}
+	return data + string(signatureSeparator) + base64.RawURLEncoding.EncodeToString(c.mac(data))
+}
+
+// verify checks and removes the signature of the data, if a Secret is set.
+func (c Codec) verify(data string) (string, error) {
+	if len(c.Secret) == 0 {
+		return data, nil
+	}
+
+	idx := strings.LastIndexByte(data, signatureSeparator)
+	if idx < 0 {
+		return "", ErrInvalidSignature
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(data[idx+1:])
+	if err != nil || !hmac.Equal(sig, c.mac(data[:idx])) {
+		return "", ErrInvalidSignature
+	}
+	return data[:idx], nil
+}
+
+// mac generates the truncated HMAC of the data.
+func (c Codec) mac(data string) []byte {
+	mac := hmac.New(sha256.New, c.Secret)
+	mac.Write([]byte(data)) // hash writes never return errors.
+	return mac.Sum(nil)[:c.signatureLength()]
+}
+
+func (c Codec) signatureLength() int {
+	if c.SignatureLength <= 0 || c.SignatureLength > sha256.Size {
+		return DefaultSignatureLength
+	}
+	return c.SignatureLength
+}
+
+// encodePayload encodes the action and parameters of the payload, without any prefix. Parameters are sorted by name,
+// so that equal payloads always have the same encoding.
+func encodePayload(p *Payload) string {
+	names := make([]string, 0, len(p.Params))
+	for name := range p.Params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	bd := strings.Builder{}
+	bd.WriteString(escape(p.Action))
+	for _, name := range names {
+		bd.WriteByte(paramSeparator)
+		bd.WriteString(escape(name))
+		bd.WriteByte(valueSeparator)
+		bd.WriteString(escape(p.Params[name]))
+	}
+	return bd.String()
+}
+
+func decodePayload(data string) (*Payload, error) {
+	parts := strings.Split(data, string(paramSeparator))
+
+	action, err := unescape(parts[0])
+	if err != nil {
+		return nil, err
+	}
+
+	p := NewPayload(action)
+	for _, part := range parts[1:] {
+		idx := strings.IndexByte(part, valueSeparator)
+		if idx < 0 {
+			return nil, fmt.Errorf("%w: parameter %q has no value", ErrInvalidPayload, part)
+		}
+
+		name, err := unescape(part[:idx])
+		if err != nil {
+			return nil, err
+		}
+		value, err := unescape(part[idx+1:])
+		if err != nil {
+			return nil, err
+		}
+		p.Params[name] = value
+	}
+	return p, nil
+}
+
+func escape(s string) string {
+	if !strings.ContainsAny(s, escapedChars) {
+		return s
+	}
+
+	bd := strings.Builder{}
+	for i := 0; i < len(s); i++ {
+		if strings.IndexByte(escapedChars, s[i]) >= 0 {
+			bd.WriteString(fmt.Sprintf("%%%02X", s[i]))
+			continue
+		}
+		bd.WriteByte(s[i])
+	}
+	return bd.String()
+}
+
+func unescape(s string) (string, error) {
+	if !strings.Contains(s, "%") {
+		return s, nil
+	}
+
+	bd := strings.Builder{}
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' {
+			bd.WriteByte(s[i])
+			continue
+		}
+		if i+3 > len(s) {
+			return "", fmt.Errorf("%w: truncated escape sequence", ErrInvalidPayload)
+		}
+		c, err := strconv.ParseUint(s[i+1:i+3], 16, 8)
+		if err != nil {
+			return "", fmt.Errorf("%w: invalid escape sequence %q", ErrInvalidPayload, s[i:i+3])
+		}
+		bd.WriteByte(byte(c))
+		i += 2
+	}
+	return bd.String(), nil
+}
+
+func newStoredId() (string, error) {
+	bs := make([]byte, storedIdLength)
+	if _, err := rand.Read(bs); err != nil {
+		return "", fmt.Errorf("failed to generate payload ID: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(bs), nil
+}
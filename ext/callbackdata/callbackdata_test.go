@@ -0,0 +1,160 @@
+package callbackdata
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+)
+
+func TestCodec(t *testing.T) {
+	for name, c := range map[string]Codec{
+		"plain":  {Prefix: "cb:"},
+		"signed": {Prefix: "cb:", Secret: []byte("secret")},
+	} {
+		t.Run(name, func(t *testing.T) {
+			p := NewPayload("d;l").Set("n", "a=b#c@%").SetInt("id", -123456789).SetBool("ok", true)
+
+			data, err := c.Encode(p)
+			if err != nil {
+				t.Fatalf("failed to encode payload: %v", err)
+			}
+			if !strings.HasPrefix(data, c.Prefix) || len(data) > gotgbot.MaxCallbackDataLength {
+				t.Fatalf("unexpected callback data %q", data)
+			}
+
+			got, err := c.Decode(data)
+			if err != nil {
+				t.Fatalf("failed to decode payload: %v", err)
+			}
+			if !reflect.DeepEqual(got, p) {
+				t.Errorf("expected %+v, got %+v", p, got)
+			}
+
+			if id, err := got.GetInt("id"); err != nil || id != -123456789 {
+				t.Errorf("expected id -123456789, got %d (%v)", id, err)
+			}
+			if confirm, err := got.GetBool("ok"); err != nil || !confirm {
+				t.Errorf("expected ok to be true, got %v (%v)", confirm, err)
+			}
+			if _, err := got.GetInt("missing"); err == nil {
+				t.Errorf("expected an error for a missing parameter")
+			}
+		})
+	}
+}
+
+func TestCodec_signature(t *testing.T) {
+	c := Codec{Prefix: "cb:", Secret: []byte("secret")}
+	data, err := c.Encode(NewPayload("ban").SetInt("user", 1))
+	if err != nil {
+		t.Fatalf("failed to encode payload: %v", err)
+	}
+
+	tampered := strings.Replace(data, "user=1", "user=2", 1)
+	if _, err := c.Decode(tampered); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("expected tampered data to be rejected, got %v", err)
+	}
+	if _, err := c.Decode("cb:ban;user=1"); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("expected unsigned data to be rejected, got %v", err)
+	}
+	if _, err := (Codec{Prefix: "cb:", Secret: []byte("other")}).Decode(data); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("expected data signed with another secret to be rejected, got %v", err)
+	}
+	if _, err := c.Decode("other:ban"); !errors.Is(err, ErrInvalidPayload) {
+		t.Errorf("expected data without the prefix to be rejected, got %v", err)
+	}
+}
+
+func TestCodec_store(t *testing.T) {
+	long := NewPayload("search").Set("query", strings.Repeat("x", 100))
+
+	if _, err := (Codec{Prefix: "cb:"}).Encode(long); !errors.Is(err, ErrPayloadTooLong) {
+		t.Errorf("expected long payloads to be rejected without a store, got %v", err)
+	}
+
+	store := NewInMemoryStore(time.Hour)
+	c := Codec{Prefix: "cb:", Secret: []byte("secret"), Store: store}
+	data, err := c.Encode(long)
+	if err != nil {
+		t.Fatalf("failed to encode payload: %v", err)
+	}
+	if len(data) > gotgbot.MaxCallbackDataLength || strings.Contains(data, "search") {
+		t.Fatalf("expected a short reference to the stored payload, got %q", data)
+	}
+
+	got, err := c.Decode(data)
+	if err != nil {
+		t.Fatalf("failed to decode payload: %v", err)
+	}
+	if !reflect.DeepEqual(got, long) {
+		t.Errorf("expected %+v, got %+v", long, got)
+	}
+
+	// Short payloads are never stored.
+	if data, err := c.Encode(NewPayload("a")); err != nil || !strings.HasPrefix(data, "cb:a#") {
+		t.Errorf("expected short payloads to be encoded inline, got %q (%v)", data, err)
+	}
+
+	// Expired payloads can't be decoded.
+	store.payloads = map[string]storedPayload{}
+	if _, err := c.Decode(data); !errors.Is(err, ErrPayloadExpired) {
+		t.Errorf("expected expired payload error, got %v", err)
+	}
+}
+
+func TestInMemoryStore_expiry(t *testing.T) {
+	s := NewInMemoryStore(time.Minute)
+	if err := s.Set("old", "data"); err != nil {
+		t.Fatalf("failed to set payload: %v", err)
+	}
+	s.payloads["old"] = storedPayload{data: "data", expiry: time.Now().Add(-time.Second)}
+
+	if _, ok, _ := s.Get("old"); ok {
+		t.Errorf("expected expired payload not to be returned")
+	}
+
+	s.lastCleanup = time.Now().Add(-time.Hour)
+	if err := s.Set("new", "data"); err != nil {
+		t.Fatalf("failed to set payload: %v", err)
+	}
+	if _, ok := s.payloads["old"]; ok {
+		t.Errorf("expected expired payload to be cleaned up")
+	}
+}
+
+func TestNewCodec(t *testing.T) {
+	if _, err := NewCodec("cb:"); err != nil {
+		t.Errorf("expected valid prefix to be accepted, got %v", err)
+	}
+
+	for name, prefix := range map[string]string{
+		"empty":               "",
+		"terminator only":     ":",
+		"no terminator":       "cb",
+		"inner terminator":    "cb:x:",
+		"param separator":     "cb;:",
+		"value separator":     "cb=:",
+		"signature separator": "cb#:",
+		"stored marker":       "cb@:",
+		"escape":              "cb%:",
+		"too long":            strings.Repeat("x", gotgbot.MaxCallbackDataLength-1) + ":",
+	} {
+		if _, err := NewCodec(prefix); !errors.Is(err, ErrInvalidPrefix) {
+			t.Errorf("%s: expected ErrInvalidPrefix, got %v", name, err)
+		}
+	}
+
+	// Prefixes must leave room for the signature and stored payload IDs, if used.
+	prefix := strings.Repeat("x", 49) + ":"
+	if _, err := NewCodec(prefix); err != nil {
+		t.Errorf("expected prefix to fit, got %v", err)
+	}
+	c := Codec{Prefix: prefix, Secret: []byte("secret"), Store: NewInMemoryStore(time.Hour)}
+	if _, err := c.Encode(NewPayload("a")); !errors.Is(err, ErrInvalidPrefix) {
+		t.Errorf("expected ErrInvalidPrefix when encoding, got %v", err)
+	}
+}
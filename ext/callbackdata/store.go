@@ -0,0 +1,83 @@
+package callbackdata
+
+import (
+	"sync"
+	"time"
+)
+
+// Store keeps encoded payloads which are too long to fit in callback data, keyed by a short random ID.
+type Store interface {
+	// Get returns the encoded payload with the given ID, if any.
+	Get(id string) (string, bool, error)
+	// Set stores an encoded payload with the given ID.
+	Set(id string, data string) error
+}
+
+// InMemoryStore is a thread-safe in-memory implementation of the Store interface.
+// Since buttons can be pressed long after they were sent, payloads are kept until their TTL expires; stored
+// payloads are lost when the bot restarts.
+type InMemoryStore struct {
+	// TTL is the duration for which payloads are stored. If 0, payloads never expire.
+	TTL time.Duration
+
+	// payloads maps IDs to their stored payloads.
+	payloads map[string]storedPayload
+	// lastCleanup is the last time expired payloads were removed.
+	lastCleanup time.Time
+	// lock allows us to ensure synchronous data access.
+	lock sync.RWMutex
+}
+
+// storedPayload is a payload kept in the InMemoryStore.
+type storedPayload struct {
+	data   string
+	expiry time.Time
+}
+
+var _ Store = &InMemoryStore{}
+
+// NewInMemoryStore creates a new InMemoryStore, where payloads expire after the given TTL.
+func NewInMemoryStore(ttl time.Duration) *InMemoryStore {
+	return &InMemoryStore{
+		TTL:      ttl,
+		payloads: map[string]storedPayload{},
+	}
+}
+
+func (s *InMemoryStore) Get(id string) (string, bool, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	p, ok := s.payloads[id]
+	if !ok || (!p.expiry.IsZero() && time.Now().After(p.expiry)) {
+		return "", false, nil
+	}
+	return p.data, true, nil
+}
+
+func (s *InMemoryStore) Set(id string, data string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.payloads == nil {
+		s.payloads = map[string]storedPayload{}
+	}
+
+	now := time.Now()
+	p := storedPayload{data: data}
+	if s.TTL > 0 {
+		p.expiry = now.Add(s.TTL)
+
+		// Remove expired payloads at most once per TTL, to avoid iterating over the whole map on every call.
+		if now.Sub(s.lastCleanup) > s.TTL {
+			for k, v := range s.payloads {
+				if now.After(v.expiry) {
+					delete(s.payloads, k)
+				}
+			}
+			s.lastCleanup = now
+		}
+	}
+	s.payloads[id] = p
+	return nil
+}
@@ -32,6 +32,9 @@ type Context struct {
 	//  - the linked channel of the current chat
 	//  - an anonymous user, speaking through a channel
 	EffectiveSender *gotgbot.Sender
+	// EffectiveThreadId is the ID of the forum topic (message thread) the update was triggered in, if possible.
+	// This is 0 for updates which aren't part of a forum topic.
+	EffectiveThreadId int64
 }
 
 // NewContext populates a context with the relevant fields from the current update.
@@ -111,13 +114,19 @@ func NewContext(update *gotgbot.Update, data map[string]interface{}) *Context {
 		}
 	}
 
+	var threadId int64
+	if msg != nil {
+		threadId = msg.GetThreadId()
+	}
+
 	return &Context{
-		Update:           update,
-		Data:             data,
-		EffectiveMessage: msg,
-		EffectiveChat:    chat,
-		EffectiveUser:    user,
-		EffectiveSender:  sender,
+		Update:            update,
+		Data:              data,
+		EffectiveMessage:  msg,
+		EffectiveChat:     chat,
+		EffectiveUser:     user,
+		EffectiveSender:   sender,
+		EffectiveThreadId: threadId,
 	}
 }
 
@@ -0,0 +1,35 @@
+package ext
+
+import (
+	"testing"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+)
+
+func TestContextEffectiveThreadId(t *testing.T) {
+	topicMsg := &gotgbot.Message{
+		MessageId:       2,
+		MessageThreadId: 1,
+		IsTopicMessage:  true,
+		Chat:            gotgbot.Chat{Id: -100, Type: "supergroup", IsForum: true},
+	}
+
+	if id := NewContext(&gotgbot.Update{Message: topicMsg}, nil).EffectiveThreadId; id != 1 {
+		t.Errorf("expected message thread ID 1, got %d", id)
+	}
+
+	cq := &gotgbot.CallbackQuery{Id: "cq", Message: topicMsg}
+	if id := NewContext(&gotgbot.Update{CallbackQuery: cq}, nil).EffectiveThreadId; id != 1 {
+		t.Errorf("expected callback query thread ID 1, got %d", id)
+	}
+
+	// Replies in non-forum chats also have a thread ID, but aren't topics.
+	replyMsg := &gotgbot.Message{
+		MessageId:       2,
+		MessageThreadId: 1,
+		Chat:            gotgbot.Chat{Id: -100, Type: "supergroup"},
+	}
+	if id := NewContext(&gotgbot.Update{Message: replyMsg}, nil).EffectiveThreadId; id != 0 {
+		t.Errorf("expected no thread ID for non-topic message, got %d", id)
+	}
+}
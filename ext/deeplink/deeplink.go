@@ -0,0 +1,165 @@
+// Package deeplink provides helpers to build and decode telegram deep links, such as t.me/bot?start=<payload>.
+// See https://core.telegram.org/bots/features#deep-linking for more details.
+package deeplink
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+)
+
+// MaxPayloadLength is the maximum number of characters telegram allows in a start payload.
+const MaxPayloadLength = 64
+
+// DefaultSignatureLength is the default number of HMAC bytes appended to signed payloads.
+const DefaultSignatureLength = 8
+
+var (
+	ErrEmptyUsername    = errors.New("bot username is empty")
+	ErrPayloadTooLong   = errors.New("payload is too long")
+	ErrInvalidPayload   = errors.New("invalid payload")
+	ErrInvalidSignature = errors.New("invalid payload signature")
+)
+
+// ValidatePayload checks that a payload can be used as a start parameter.
+// Payloads may only contain up to 64 characters of A-Z, a-z, 0-9, _ and -.
+func ValidatePayload(payload string) error {
+	if len(payload) > MaxPayloadLength {
+		return fmt.Errorf("%w: %d characters, maximum is %d", ErrPayloadTooLong, len(payload), MaxPayloadLength)
+	}
+
+	for _, r := range payload {
+		if !isPayloadRune(r) {
+			return fmt.Errorf("%w: unexpected character %q", ErrInvalidPayload, r)
+		}
+	}
+	return nil
+}
+
+func isPayloadRune(r rune) bool {
+	return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' || r == '-'
+}
+
+// StartLink builds a link which opens a private chat with the bot, sending it "/start <payload>".
+func StartLink(b *gotgbot.Bot, payload string) (string, error) {
+	return buildLink(b, "start", payload)
+}
+
+// StartGroupLink builds a link which prompts the user to add the bot to a group, sending it "/start <payload>" in the
+// selected group.
+func StartGroupLink(b *gotgbot.Bot, payload string) (string, error) {
+	return buildLink(b, "startgroup", payload)
+}
+
+func buildLink(b *gotgbot.Bot, param string, payload string) (string, error) {
+	if b.User.Username == "" {
+		return "", ErrEmptyUsername
+	}
+
+	if err := ValidatePayload(payload); err != nil {
+		return "", err
+	}
+
+	query := url.Values{}
+	query.Set(param, payload)
+	return "https://t.me/" + b.User.Username + "?" + query.Encode(), nil
+}
+
+// Codec encodes arbitrary data into valid start payloads, using unpadded base64url.
+// Payloads can optionally be signed, to ensure that they were generated by the bot.
+type Codec struct {
+	// Prefix is prepended to all encoded payloads. This allows for routing payloads to different handlers.
+	// Must only contain valid payload characters.
+	Prefix string
+	// Secret is the key used to sign payloads with an HMAC-SHA256. If empty, payloads are not signed.
+	Secret []byte
+	// SignatureLength is the number of HMAC bytes appended to signed payloads.
+	// If 0, DefaultSignatureLength is used.
+	SignatureLength int
+}
+
+// Encode encodes the data into a payload, returning an error if it is too long to be used.
+func (c Codec) Encode(data []byte) (string, error) {
+	blob := data
+	if len(c.Secret) > 0 {
+		blob = append(append([]byte{}, data...), c.sign(data)...)
+	}
+
+	payload := c.Prefix + base64.RawURLEncoding.EncodeToString(blob)
+	if err := ValidatePayload(payload); err != nil {
+		return "", err
+	}
+	return payload, nil
+}
+
+// Decode decodes a payload generated by Encode, and checks the signature if a Secret is set.
+func (c Codec) Decode(payload string) ([]byte, error) {
+	if !strings.HasPrefix(payload, c.Prefix) {
+		return nil, fmt.Errorf("%w: missing prefix %q", ErrInvalidPayload, c.Prefix)
+	}
+
+	blob, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(payload, c.Prefix))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidPayload, err.Error())
+	}
+
+	if len(c.Secret) == 0 {
+		return blob, nil
+	}
+
+	sigLen := c.signatureLength()
+	if len(blob) < sigLen {
+		return nil, ErrInvalidSignature
+	}
+
+	data, sig := blob[:len(blob)-sigLen], blob[len(blob)-sigLen:]
+	if !hmac.Equal(sig, c.sign(data)) {
+		return nil, ErrInvalidSignature
+	}
+	return data, nil
+}
+
+// EncodeJSON marshals v as JSON, and encodes it into a payload.
+func (c Codec) EncodeJSON(v interface{}) (string, error) {
+	bs, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal payload data: %w", err)
+	}
+	return c.Encode(bs)
+}
+
+// DecodeJSON decodes a payload generated by EncodeJSON into v.
+func (c Codec) DecodeJSON(payload string, v interface{}) error {
+	bs, err := c.Decode(payload)
+	if err != nil {
+		return err
+	}
+
+	if err = json.Unmarshal(bs, v); err != nil {
+		return fmt.Errorf("failed to unmarshal payload data: %w", err)
+	}
+	return nil
+}
+
+// sign generates the truncated HMAC of the data. The prefix is included, so that payloads can't be reused across
+// different routes.
+func (c Codec) sign(data []byte) []byte {
+	mac := hmac.New(sha256.New, c.Secret)
+	mac.Write([]byte(c.Prefix)) // hash writes never return errors.
+	mac.Write(data)
+	return mac.Sum(nil)[:c.signatureLength()]
+}
+
+func (c Codec) signatureLength() int {
+	if c.SignatureLength <= 0 || c.SignatureLength > sha256.Size {
+		return DefaultSignatureLength
+	}
+	return c.SignatureLength
+}
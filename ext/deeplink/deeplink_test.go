@@ -0,0 +1,103 @@
+package deeplink
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+)
+
+func TestStartLink(t *testing.T) {
+	b := &gotgbot.Bot{User: gotgbot.User{Username: "gotgbot"}}
+
+	link, err := StartLink(b, "abc_DEF-123")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if link != "https://t.me/gotgbot?start=abc_DEF-123" {
+		t.Errorf("unexpected link: %s", link)
+	}
+
+	link, err = StartGroupLink(b, "group")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if link != "https://t.me/gotgbot?startgroup=group" {
+		t.Errorf("unexpected link: %s", link)
+	}
+
+	if _, err = StartLink(b, "not valid"); !errors.Is(err, ErrInvalidPayload) {
+		t.Errorf("expected invalid payload error, got %v", err)
+	}
+	if _, err = StartLink(b, strings.Repeat("a", MaxPayloadLength+1)); !errors.Is(err, ErrPayloadTooLong) {
+		t.Errorf("expected payload too long error, got %v", err)
+	}
+	if _, err = StartLink(&gotgbot.Bot{}, "abc"); !errors.Is(err, ErrEmptyUsername) {
+		t.Errorf("expected empty username error, got %v", err)
+	}
+}
+
+func TestCodec(t *testing.T) {
+	for name, c := range map[string]Codec{
+		"plain":  {Prefix: "ref-"},
+		"signed": {Prefix: "ref-", Secret: []byte("secret")},
+	} {
+		t.Run(name, func(t *testing.T) {
+			data := []byte{0, 1, 2, 250, 251, 252, 253, 254, 255}
+			payload, err := c.Encode(data)
+			if err != nil {
+				t.Fatalf("failed to encode payload: %v", err)
+			}
+			if err = ValidatePayload(payload); err != nil {
+				t.Fatalf("encoded payload is invalid: %v", err)
+			}
+
+			out, err := c.Decode(payload)
+			if err != nil {
+				t.Fatalf("failed to decode payload: %v", err)
+			}
+			if string(out) != string(data) {
+				t.Errorf("expected %v, got %v", data, out)
+			}
+
+			if _, err = c.Decode("other-" + payload); !errors.Is(err, ErrInvalidPayload) {
+				t.Errorf("expected invalid payload error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestCodecSignature(t *testing.T) {
+	c := Codec{Prefix: "p", Secret: []byte("secret")}
+
+	type ref struct {
+		Id int64 `json:"id"`
+	}
+
+	payload, err := c.EncodeJSON(ref{Id: 42})
+	if err != nil {
+		t.Fatalf("failed to encode payload: %v", err)
+	}
+
+	var r ref
+	if err = c.DecodeJSON(payload, &r); err != nil {
+		t.Fatalf("failed to decode payload: %v", err)
+	}
+	if r.Id != 42 {
+		t.Errorf("expected id 42, got %d", r.Id)
+	}
+
+	// Payloads signed with another secret should be rejected.
+	forged, err := Codec{Prefix: "p", Secret: []byte("other")}.EncodeJSON(ref{Id: 1})
+	if err != nil {
+		t.Fatalf("failed to encode payload: %v", err)
+	}
+	if err = c.DecodeJSON(forged, &r); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("expected invalid signature error, got %v", err)
+	}
+
+	if _, err = c.Encode(make([]byte, MaxPayloadLength)); !errors.Is(err, ErrPayloadTooLong) {
+		t.Errorf("expected payload too long error, got %v", err)
+	}
+}
@@ -26,6 +26,11 @@ type (
 	DispatcherErrorHandler func(b *gotgbot.Bot, ctx *Context, err error) DispatcherAction
 	// DispatcherPanicHandler allows for handling goroutine panics, where the 'r' value contains the reason for the panic.
 	DispatcherPanicHandler func(b *gotgbot.Bot, ctx *Context, r interface{})
+	// DispatcherProcessFunc processes an update through the dispatcher's handler groups.
+	DispatcherProcessFunc func(b *gotgbot.Bot, ctx *Context) error
+	// DispatcherMiddleware wraps the processing of every update, before any handlers are checked; eg, to rate limit
+	// updates. A middleware can stop an update from reaching the handlers by not calling next.
+	DispatcherMiddleware func(next DispatcherProcessFunc) DispatcherProcessFunc
 )
 
 type DispatcherAction string
@@ -57,6 +62,10 @@ type Dispatcher struct {
 	// and is left to determine how to log or handle the errors.
 	// If this field is nil, the error will be passed to UnhandledErrFunc.
 	Panic DispatcherPanicHandler
+	// Middlewares wrap the processing of every update, before any handlers are checked. The first middleware runs
+	// first. Returning EndGroups from a middleware is the same as returning nil; other errors are returned by
+	// ProcessUpdate.
+	Middlewares []DispatcherMiddleware
 
 	// UnhandledErrFunc provides more flexibility for dealing with unhandled update processing errors.
 	// This includes errors when unmarshalling updates, unhandled panics during handler executions, or unknown
@@ -87,6 +96,9 @@ type DispatcherOpts struct {
 	// If no panic handlers are defined, the stack is logged to ErrorLog.
 	// More info at Dispatcher.Panic.
 	Panic DispatcherPanicHandler
+	// Middlewares wrap the processing of every update, before any handlers are checked.
+	// More info at Dispatcher.Middlewares.
+	Middlewares []DispatcherMiddleware
 
 	// UnhandledErrFunc provides more flexibility for dealing with unhandled update processing errors.
 	// This includes errors when unmarshalling updates, unhandled panics during handler executions, or unknown
@@ -109,6 +121,7 @@ type DispatcherOpts struct {
 func NewDispatcher(opts *DispatcherOpts) *Dispatcher {
 	var errHandler DispatcherErrorHandler
 	var panicHandler DispatcherPanicHandler
+	var middlewares []DispatcherMiddleware
 	var unhandledErrFunc ErrorFunc
 	var errLog Logger
 
@@ -121,6 +134,7 @@ func NewDispatcher(opts *DispatcherOpts) *Dispatcher {
 
 		errHandler = opts.Error
 		panicHandler = opts.Panic
+		middlewares = opts.Middlewares
 		unhandledErrFunc = opts.UnhandledErrFunc
 		errLog = opts.ErrorLog
 	}
@@ -138,6 +152,7 @@ func NewDispatcher(opts *DispatcherOpts) *Dispatcher {
 	return &Dispatcher{
 		Error:            errHandler,
 		Panic:            panicHandler,
+		Middlewares:      middlewares,
 		UnhandledErrFunc: unhandledErrFunc,
 		ErrorLog:         errLog,
 		handlers:         make(map[int][]Handler),
@@ -253,7 +268,16 @@ func (d *Dispatcher) ProcessUpdate(b *gotgbot.Bot, update *gotgbot.Update, data
 		}
 	}()
 
-	err = d.iterateOverHandlerGroups(b, ctx)
+	process := DispatcherProcessFunc(d.iterateOverHandlerGroups)
+	for i := len(d.Middlewares) - 1; i >= 0; i-- {
+		// Wrap from the last middleware outwards, so that the first middleware runs first.
+		process = d.Middlewares[i](process)
+	}
+
+	err = process(b, ctx)
+	if errors.Is(err, EndGroups) {
+		err = nil
+	}
 	// We don't inline this, because we want to make sure that the defer function can override the error in the case of
 	// a panic.
 	return err
@@ -2,8 +2,11 @@ package ext
 
 import (
 	"encoding/json"
+	"reflect"
 	"testing"
 	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
 )
 
 func TestDispatcherStop(t *testing.T) {
@@ -56,3 +59,39 @@ func TestUnlimitedDispatcherStop(t *testing.T) {
 	go d.Start(nil, make(chan json.RawMessage))
 	d.Stop() // ensure no panics
 }
+
+func TestDispatcherMiddlewares(t *testing.T) {
+	var calls []string
+	middleware := func(name string, stop bool) DispatcherMiddleware {
+		return func(next DispatcherProcessFunc) DispatcherProcessFunc {
+			return func(b *gotgbot.Bot, ctx *Context) error {
+				calls = append(calls, name)
+				if stop {
+					return EndGroups
+				}
+				return next(b, ctx)
+			}
+		}
+	}
+
+	d := NewDispatcher(&DispatcherOpts{
+		Middlewares: []DispatcherMiddleware{middleware("first", false), middleware("second", false)},
+	})
+	if err := d.ProcessUpdate(nil, &gotgbot.Update{}, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := []string{"first", "second"}; !reflect.DeepEqual(calls, expected) {
+		t.Errorf("expected middlewares to run in order %v, got %v", expected, calls)
+	}
+
+	calls = nil
+	d = NewDispatcher(&DispatcherOpts{
+		Middlewares: []DispatcherMiddleware{middleware("first", true), middleware("second", false)},
+	})
+	if err := d.ProcessUpdate(nil, &gotgbot.Update{}, nil); err != nil {
+		t.Fatalf("expected EndGroups from a middleware to be ignored, got: %v", err)
+	}
+	if expected := []string{"first"}; !reflect.DeepEqual(calls, expected) {
+		t.Errorf("expected only the first middleware to run, got %v", calls)
+	}
+}
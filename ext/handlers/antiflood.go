@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers/antiflood"
+)
+
+// antiFloodResultDataKey is the ext.Context.Data key used to pass the flood state from CheckUpdate to HandleUpdate.
+const antiFloodResultDataKey = "handlers.antiflood.result"
+
+// AntiFloodAction defines how to handle updates which exceed the flood limit.
+// The first parameter is true for the first limited update since the sender was last within the limit.
+type AntiFloodAction func(b *gotgbot.Bot, ctx *ext.Context, first bool) error
+
+// AntiFlood is a handler which limits how many updates can be processed within a sliding time window.
+//
+// It can be used in three ways:
+//   - As a handler in an early group (eg, -1), where it only matches updates which exceed the limit, and executes the
+//     Action on them. All other updates continue through the dispatcher as normal.
+//   - As dispatcher middleware, with AntiFlood.Middleware. All updates are counted, and limited updates never reach
+//     any handlers.
+//   - As a wrapper around another handler, with AntiFlood.Wrap. Only updates matching the wrapped handler are
+//     counted, and the wrapped handler is not called for limited updates.
+type AntiFlood struct {
+	// Limit is the maximum number of updates allowed within the Window.
+	Limit int
+	// Window is the duration of the sliding window over which updates are counted.
+	Window time.Duration
+	// Storage is responsible for keeping track of the recent updates of each key.
+	Storage antiflood.Storage
+	// Action determines how to handle limited updates.
+	Action AntiFloodAction
+}
+
+type AntiFloodOpts struct {
+	// Storage is responsible for keeping track of the recent updates of each key.
+	// If nil, defaults to an in-memory storage with antiflood.KeyStrategySender.
+	Storage antiflood.Storage
+	// Action determines how to handle limited updates.
+	// If nil, defaults to AntiFloodDrop.
+	Action AntiFloodAction
+}
+
+func NewAntiFlood(limit int, window time.Duration, opts *AntiFloodOpts) AntiFlood {
+	a := AntiFlood{
+		Limit:   limit,
+		Window:  window,
+		Storage: antiflood.NewInMemoryStorage(antiflood.KeyStrategySender),
+		Action:  AntiFloodDrop,
+	}
+
+	if opts != nil {
+		if opts.Storage != nil {
+			a.Storage = opts.Storage
+		}
+		if opts.Action != nil {
+			a.Action = opts.Action
+		}
+	}
+
+	return a
+}
+
+func (a AntiFlood) CheckUpdate(b *gotgbot.Bot, ctx *ext.Context) bool {
+	// Note: storage errors are lost here; we prefer letting updates through than blocking everything.
+	res, err := a.Storage.Hit(ctx, a.Window, a.Limit)
+	if err != nil {
+		return false
+	}
+
+	ctx.Data[antiFloodResultDataKey] = res
+	return res.Limited
+}
+
+func (a AntiFlood) HandleUpdate(b *gotgbot.Bot, ctx *ext.Context) error {
+	res, _ := ctx.Data[antiFloodResultDataKey].(antiflood.Result)
+	return a.Action(b, ctx, res.FirstLimited)
+}
+
+func (a AntiFlood) Name() string {
+	return fmt.Sprintf("antiflood_%p", a.Storage)
+}
+
+// Middleware returns a dispatcher middleware which applies the flood limit to all updates, before any handlers are
+// checked; see ext.DispatcherOpts.Middlewares. Limited updates are passed to the Action, and never reach the handlers.
+func (a AntiFlood) Middleware() ext.DispatcherMiddleware {
+	return func(next ext.DispatcherProcessFunc) ext.DispatcherProcessFunc {
+		return func(b *gotgbot.Bot, ctx *ext.Context) error {
+			// Note: as in CheckUpdate, we prefer letting updates through than blocking everything on storage errors.
+			res, err := a.Storage.Hit(ctx, a.Window, a.Limit)
+			if err != nil || !res.Limited {
+				return next(b, ctx)
+			}
+			return a.Action(b, ctx, res.FirstLimited)
+		}
+	}
+}
+
+// Wrap returns a handler which applies the flood limit to the wrapped handler only.
+func (a AntiFlood) Wrap(h ext.Handler) ext.Handler {
+	return antiFloodWrappedHandler{a: a, h: h}
+}
+
+// antiFloodWrappedHandler only calls the wrapped handler if the update is within the flood limit.
+type antiFloodWrappedHandler struct {
+	a AntiFlood
+	h ext.Handler
+}
+
+func (w antiFloodWrappedHandler) CheckUpdate(b *gotgbot.Bot, ctx *ext.Context) bool {
+	return w.h.CheckUpdate(b, ctx)
+}
+
+func (w antiFloodWrappedHandler) HandleUpdate(b *gotgbot.Bot, ctx *ext.Context) error {
+	res, err := w.a.Storage.Hit(ctx, w.a.Window, w.a.Limit)
+	if err != nil {
+		return fmt.Errorf("failed to check flood limit: %w", err)
+	}
+
+	if res.Limited {
+		return w.a.Action(b, ctx, res.FirstLimited)
+	}
+	return w.h.HandleUpdate(b, ctx)
+}
+
+func (w antiFloodWrappedHandler) Name() string {
+	return "antiflood_" + w.h.Name()
+}
+
+// AntiFloodDrop silently drops limited updates, and stops any further handlers from processing them.
+// This is the default action.
+func AntiFloodDrop(_ *gotgbot.Bot, _ *ext.Context, _ bool) error {
+	return ext.EndGroups
+}
+
+// AntiFloodEndGroups silently drops limited updates, and stops any further handlers from processing them.
+// This is the same as AntiFloodDrop.
+func AntiFloodEndGroups(_ *gotgbot.Bot, _ *ext.Context, _ bool) error {
+	return ext.EndGroups
+}
+
+// AntiFloodWarn replies to the first limited message with a warning, and stops any further handlers from processing
+// limited updates.
+func AntiFloodWarn(text string) AntiFloodAction {
+	return func(b *gotgbot.Bot, ctx *ext.Context, first bool) error {
+		if first && ctx.EffectiveMessage != nil && ctx.CallbackQuery == nil {
+			if _, err := ctx.EffectiveMessage.Reply(b, text, nil); err != nil {
+				return fmt.Errorf("failed to send flood warning: %w", err)
+			}
+		}
+		return ext.EndGroups
+	}
+}
+
+// AntiFloodAlert answers limited callback queries, showing the first one an alert with the given text.
+// All limited updates are stopped from being processed by further handlers.
+func AntiFloodAlert(text string) AntiFloodAction {
+	return func(b *gotgbot.Bot, ctx *ext.Context, first bool) error {
+		if ctx.CallbackQuery != nil {
+			opts := &gotgbot.AnswerCallbackQueryOpts{}
+			if first {
+				opts.Text = text
+				opts.ShowAlert = true
+			}
+			if _, err := ctx.CallbackQuery.Answer(b, opts); err != nil {
+				return fmt.Errorf("failed to answer flooding callback query: %w", err)
+			}
+		}
+		return ext.EndGroups
+	}
+}
@@ -0,0 +1,15 @@
+package antiflood
+
+import (
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+)
+
+// Key determines the key to rate limit the current update by.
+// Returns false if the update does not contain the data required by the strategy (eg, inline queries have no chat).
+func Key(ctx *ext.Context, strategy KeyStrategy) (string, bool) {
+	if strategy == nil {
+		// Default to KeyStrategySenderAndChat if no strategy is set.
+		strategy = KeyStrategySenderAndChat
+	}
+	return strategy(ctx)
+}
@@ -0,0 +1,96 @@
+package antiflood
+
+import (
+	"sync"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+)
+
+// InMemoryStorage is a thread-safe in-memory implementation of the Storage interface, using a sliding window.
+type InMemoryStorage struct {
+	// keyStrategy defines how to calculate keys for each update.
+	keyStrategy KeyStrategy
+	// records is a map of key -> record, which tracks the most recent updates of each key.
+	records map[string]*record
+	// lastSweep is the last time stale records were removed.
+	lastSweep time.Time
+	// lock allows us to ensure synchronous data access.
+	lock sync.Mutex
+}
+
+// record keeps track of the recent updates of a single key.
+type record struct {
+	// hits contains the times of the most recent updates, oldest first.
+	hits []time.Time
+	// limited is true if the previous update was limited.
+	limited bool
+}
+
+func NewInMemoryStorage(strategy KeyStrategy) *InMemoryStorage {
+	return &InMemoryStorage{
+		keyStrategy: strategy,
+		records:     map[string]*record{},
+	}
+}
+
+func (s *InMemoryStorage) Hit(ctx *ext.Context, window time.Duration, limit int) (Result, error) {
+	key, ok := Key(ctx, s.keyStrategy)
+	if !ok {
+		return Result{}, nil
+	}
+
+	now := time.Now()
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.records == nil {
+		s.records = map[string]*record{}
+	}
+	s.sweep(now, window)
+
+	r, ok := s.records[key]
+	if !ok {
+		r = &record{}
+		s.records[key] = r
+	}
+
+	// Drop any hits which have left the window.
+	cutoff := now.Add(-window)
+	idx := 0
+	for idx < len(r.hits) && !r.hits[idx].After(cutoff) {
+		idx++
+	}
+	r.hits = append(r.hits[idx:], now)
+
+	// We never need to keep more than limit+1 hits; anything more is still limited.
+	if len(r.hits) > limit+1 {
+		r.hits = r.hits[len(r.hits)-(limit+1):]
+	}
+
+	res := Result{
+		Count:   len(r.hits),
+		Limited: len(r.hits) > limit,
+	}
+	res.FirstLimited = res.Limited && !r.limited
+	r.limited = res.Limited
+
+	return res, nil
+}
+
+// sweep removes all records which have no hits left within the window, to avoid unbounded memory growth.
+// This is only done once per window.
+func (s *InMemoryStorage) sweep(now time.Time, window time.Duration) {
+	if now.Sub(s.lastSweep) < window {
+		return
+	}
+	s.lastSweep = now
+
+	cutoff := now.Add(-window)
+	for k, r := range s.records {
+		if len(r.hits) == 0 || !r.hits[len(r.hits)-1].After(cutoff) {
+			delete(s.records, k)
+		}
+	}
+}
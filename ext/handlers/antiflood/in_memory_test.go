@@ -0,0 +1,125 @@
+package antiflood
+
+import (
+	"testing"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+)
+
+func newMessage(userId int64, chatId int64) *ext.Context {
+	return ext.NewContext(&gotgbot.Update{
+		UpdateId: userId,
+		Message: &gotgbot.Message{
+			From: &gotgbot.User{Id: userId, FirstName: "user"},
+			Chat: gotgbot.Chat{Id: chatId, Type: "supergroup"},
+			Text: "message",
+		},
+	}, nil)
+}
+
+func TestInMemoryStorageLimit(t *testing.T) {
+	s := NewInMemoryStorage(KeyStrategySenderAndChat)
+
+	for i := 1; i <= 4; i++ {
+		res, err := s.Hit(newMessage(1, 10), time.Hour, 2)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if res.Limited != (i > 2) {
+			t.Errorf("hit %d: expected limited to be %v", i, i > 2)
+		}
+		if res.FirstLimited != (i == 3) {
+			t.Errorf("hit %d: expected first limited to be %v", i, i == 3)
+		}
+	}
+
+	// The same sender in another chat has a separate limit.
+	res, err := s.Hit(newMessage(1, 20), time.Hour, 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if res.Limited || res.Count != 1 {
+		t.Errorf("expected separate limit for another chat, got %+v", res)
+	}
+}
+
+func TestInMemoryStorageWindowExpiry(t *testing.T) {
+	s := NewInMemoryStorage(KeyStrategySender)
+	window := 50 * time.Millisecond
+
+	for i := 0; i < 2; i++ {
+		if _, err := s.Hit(newMessage(1, 10), window, 1); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	time.Sleep(2 * window)
+
+	res, err := s.Hit(newMessage(1, 10), window, 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if res.Limited || res.Count != 1 {
+		t.Errorf("expected old hits to leave the window, got %+v", res)
+	}
+
+	// Once limited again, the next limited update is reported as the first one.
+	res, err = s.Hit(newMessage(1, 10), window, 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !res.Limited || !res.FirstLimited {
+		t.Errorf("expected first limited update after expiry, got %+v", res)
+	}
+}
+
+func TestInMemoryStorageSweep(t *testing.T) {
+	s := NewInMemoryStorage(KeyStrategySender)
+	window := 50 * time.Millisecond
+
+	for id := int64(1); id <= 3; id++ {
+		if _, err := s.Hit(newMessage(id, 10), window, 1); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	time.Sleep(2 * window)
+
+	if _, err := s.Hit(newMessage(4, 10), window, 1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(s.records) != 1 {
+		t.Errorf("expected stale records to be swept, got %d records", len(s.records))
+	}
+}
+
+func TestInMemoryStorageMissingKey(t *testing.T) {
+	s := NewInMemoryStorage(KeyStrategyChat)
+
+	ctx := ext.NewContext(&gotgbot.Update{
+		InlineQuery: &gotgbot.InlineQuery{From: gotgbot.User{Id: 1, FirstName: "user"}},
+	}, nil)
+	for i := 0; i < 3; i++ {
+		res, err := s.Hit(ctx, time.Hour, 1)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if res.Limited {
+			t.Errorf("expected updates without a key never to be limited")
+		}
+	}
+}
+
+func TestKeyDefaultStrategy(t *testing.T) {
+	key, ok := Key(newMessage(1, 10), nil)
+	if !ok || key != "1/10" {
+		t.Errorf("expected nil strategy to default to sender and chat, got %q", key)
+	}
+
+	custom := func(ctx *ext.Context) (string, bool) { return "custom", true }
+	if key, _ := Key(newMessage(1, 10), custom); key != "custom" {
+		t.Errorf("expected custom strategy to be used, got %q", key)
+	}
+}
@@ -0,0 +1,27 @@
+package antiflood
+
+import (
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+)
+
+// Result describes the flood state of a key, after recording the latest update.
+type Result struct {
+	// Count is the number of updates seen within the window, including the latest one.
+	// Implementations may cap this value to Limit+1, since any higher value is equivalent.
+	Count int
+	// Limited is true when Count exceeds the limit.
+	Limited bool
+	// FirstLimited is true if this is the first limited update since the key was last within the limit.
+	// This can be used to only warn users once.
+	FirstLimited bool
+}
+
+// Storage allows you to define custom backends for keeping track of update rates.
+// If you are running multiple bot instances, you should implement this interface with a shared backend.
+type Storage interface {
+	// Hit records a new update for the current context, and returns the resulting flood state.
+	// Updates which don't have a key for the storage's strategy should never be limited.
+	Hit(ctx *ext.Context, window time.Duration, limit int) (Result, error)
+}
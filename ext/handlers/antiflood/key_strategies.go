@@ -0,0 +1,40 @@
+package antiflood
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+)
+
+// KeyStrategy determines the key to rate limit an update by; updates with the same key share a single flood limit.
+// Returns false if the update doesn't contain the data required by the strategy (eg, inline queries have no chat), in
+// which case the update is never limited.
+//
+// Custom strategies can be used by any function with this signature. A nil KeyStrategy defaults to
+// KeyStrategySenderAndChat.
+type KeyStrategy func(ctx *ext.Context) (string, bool)
+
+// KeyStrategySender limits each sender across all chats.
+func KeyStrategySender(ctx *ext.Context) (string, bool) {
+	if ctx.EffectiveSender == nil {
+		return "", false
+	}
+	return strconv.FormatInt(ctx.EffectiveSender.Id(), 10), true
+}
+
+// KeyStrategyChat limits each chat, regardless of which sender is flooding it.
+func KeyStrategyChat(ctx *ext.Context) (string, bool) {
+	if ctx.EffectiveChat == nil {
+		return "", false
+	}
+	return strconv.FormatInt(ctx.EffectiveChat.Id, 10), true
+}
+
+// KeyStrategySenderAndChat limits each sender separately in each chat.
+func KeyStrategySenderAndChat(ctx *ext.Context) (string, bool) {
+	if ctx.EffectiveSender == nil || ctx.EffectiveChat == nil {
+		return "", false
+	}
+	return fmt.Sprintf("%d/%d", ctx.EffectiveSender.Id(), ctx.EffectiveChat.Id), true
+}
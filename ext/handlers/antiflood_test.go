@@ -0,0 +1,151 @@
+package handlers_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers/antiflood"
+)
+
+func TestAntiFlood(t *testing.T) {
+	b := NewTestBot()
+
+	var firsts int
+	a := handlers.NewAntiFlood(2, time.Hour, &handlers.AntiFloodOpts{
+		Action: func(b *gotgbot.Bot, ctx *ext.Context, first bool) error {
+			if first {
+				firsts++
+			}
+			return ext.EndGroups
+		},
+	})
+
+	for i := 0; i < 2; i++ {
+		if a.CheckUpdate(b, NewMessage(1, 1, "spam")) {
+			t.Fatalf("did not expect message %d to be limited", i)
+		}
+	}
+
+	for i := 0; i < 3; i++ {
+		ctx := NewMessage(1, 1, "spam")
+		if !a.CheckUpdate(b, ctx) {
+			t.Fatalf("expected message to be limited")
+		}
+		if err := a.HandleUpdate(b, ctx); !errors.Is(err, ext.EndGroups) {
+			t.Fatalf("expected EndGroups, got %v", err)
+		}
+	}
+	if firsts != 1 {
+		t.Errorf("expected a single first limited update, got %d", firsts)
+	}
+
+	// Other users are not affected.
+	if a.CheckUpdate(b, NewMessage(2, 1, "hello")) {
+		t.Errorf("did not expect another user to be limited")
+	}
+}
+
+func TestAntiFloodWindow(t *testing.T) {
+	b := NewTestBot()
+
+	a := handlers.NewAntiFlood(1, 50*time.Millisecond, &handlers.AntiFloodOpts{
+		Storage: antiflood.NewInMemoryStorage(antiflood.KeyStrategyChat),
+	})
+
+	if a.CheckUpdate(b, NewMessage(1, 1, "first")) {
+		t.Fatalf("did not expect first message to be limited")
+	}
+	// Different user, same chat.
+	if !a.CheckUpdate(b, NewMessage(2, 1, "second")) {
+		t.Fatalf("expected second message in chat to be limited")
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if a.CheckUpdate(b, NewMessage(1, 1, "third")) {
+		t.Errorf("did not expect message to be limited once the window has passed")
+	}
+}
+
+func TestAntiFloodWrap(t *testing.T) {
+	b := NewTestBot()
+
+	var count int
+	h := handlers.NewAntiFlood(1, time.Hour, &handlers.AntiFloodOpts{Action: handlers.AntiFloodDrop}).
+		Wrap(handlers.NewCommand("start", func(b *gotgbot.Bot, ctx *ext.Context) error {
+			count++
+			return nil
+		}))
+
+	// Non-matching updates are not counted.
+	if h.CheckUpdate(b, NewMessage(1, 1, "hello")) {
+		t.Fatalf("did not expect wrapped handler to match plain text")
+	}
+
+	for i := 0; i < 3; i++ {
+		ctx := NewCommandMessage(1, 1, "start", nil)
+		if !h.CheckUpdate(b, ctx) {
+			t.Fatalf("expected wrapped handler to match")
+		}
+		if err := h.HandleUpdate(b, ctx); err != nil && !errors.Is(err, ext.EndGroups) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if count != 1 {
+		t.Errorf("expected wrapped handler to run once, ran %d times", count)
+	}
+}
+
+func TestAntiFloodDropEndsGroups(t *testing.T) {
+	b := NewTestBot()
+
+	var handled int
+	d := ext.NewDispatcher(nil)
+	d.AddHandlerToGroup(handlers.NewAntiFlood(1, time.Hour, nil), -1)
+	d.AddHandler(handlers.NewMessage(nil, func(b *gotgbot.Bot, ctx *ext.Context) error {
+		handled++
+		return nil
+	}))
+
+	for i := 0; i < 3; i++ {
+		if err := d.ProcessUpdate(b, NewMessage(1, 1, "spam").Update, nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if handled != 1 {
+		t.Errorf("expected dropped updates not to reach later groups, handled %d", handled)
+	}
+}
+
+func TestAntiFloodMiddleware(t *testing.T) {
+	b := NewTestBot()
+
+	var handled int
+	d := ext.NewDispatcher(&ext.DispatcherOpts{
+		Middlewares: []ext.DispatcherMiddleware{handlers.NewAntiFlood(2, time.Hour, nil).Middleware()},
+	})
+	d.AddHandler(handlers.NewMessage(nil, func(b *gotgbot.Bot, ctx *ext.Context) error {
+		handled++
+		return nil
+	}))
+
+	for i := 0; i < 5; i++ {
+		if err := d.ProcessUpdate(b, NewMessage(1, 1, "spam").Update, nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if handled != 2 {
+		t.Errorf("expected only updates within the limit to reach the handlers, handled %d", handled)
+	}
+
+	// Other senders are not affected.
+	if err := d.ProcessUpdate(b, NewMessage(2, 1, "hello").Update, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if handled != 3 {
+		t.Errorf("expected another sender's update to be handled, handled %d", handled)
+	}
+}
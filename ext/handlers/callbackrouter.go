@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/callbackdata"
+)
+
+const (
+	// callbackPayloadDataKey is the ext.Context.Data key used to store the decoded callback payload.
+	callbackPayloadDataKey = "handlers.callbackrouter.payload"
+	// callbackPayloadErrorDataKey is the ext.Context.Data key used to store the callback payload decoding error.
+	callbackPayloadErrorDataKey = "handlers.callbackrouter.error"
+)
+
+// CallbackRouter handles callback queries with payloads encoded by a callbackdata.Codec, and routes each payload to
+// the response registered for its action. The decoded payload can be obtained with CallbackPayload.
+type CallbackRouter struct {
+	AllowChannel bool
+	Codec        callbackdata.Codec
+	// Invalid handles callback queries which have the codec's prefix, but can't be decoded; for example, because they
+	// have been tampered with, or their stored payload has expired. The error can be obtained with
+	// CallbackPayloadError. If nil, such callback queries are not handled.
+	Invalid Response
+
+	// routes maps payload actions to their responses.
+	routes map[string]Response
+}
+
+// NewCallbackRouter creates a CallbackRouter for the payloads encoded by the given codec. Use On to add routes, and
+// callbackdata.NewCodec to check the codec's prefix; routers with an invalid codec never match any updates.
+func NewCallbackRouter(c callbackdata.Codec) *CallbackRouter {
+	return &CallbackRouter{
+		Codec:  c,
+		routes: map[string]Response{},
+	}
+}
+
+// On sets the response for payloads with the given action.
+func (r *CallbackRouter) On(action string, resp Response) *CallbackRouter {
+	if r.routes == nil {
+		r.routes = map[string]Response{}
+	}
+	r.routes[action] = resp
+	return r
+}
+
+func (r *CallbackRouter) CheckUpdate(b *gotgbot.Bot, ctx *ext.Context) bool {
+	payload, ok, err := r.decode(ctx)
+	if !ok {
+		return false
+	}
+	if err != nil {
+		if r.Invalid == nil {
+			return false
+		}
+	} else if _, ok = r.routes[payload.Action]; !ok {
+		return false
+	}
+
+	// Store the decoding results, so HandleUpdate doesn't decode the payload again; loading stored payloads can be
+	// slow, and they may have expired in the meantime.
+	ctx.Data[callbackPayloadDataKey] = payload
+	ctx.Data[callbackPayloadErrorDataKey] = err
+	return true
+}
+
+func (r *CallbackRouter) HandleUpdate(b *gotgbot.Bot, ctx *ext.Context) error {
+	if err := CallbackPayloadError(ctx); err != nil {
+		if r.Invalid == nil {
+			return nil
+		}
+		return r.Invalid(b, ctx)
+	}
+
+	payload := CallbackPayload(ctx)
+	if payload == nil {
+		return nil
+	}
+	resp, ok := r.routes[payload.Action]
+	if !ok {
+		return nil
+	}
+	return resp(b, ctx)
+}
+
+func (r *CallbackRouter) Name() string {
+	return fmt.Sprintf("callbackrouter_%p", r)
+}
+
+// CallbackPayload returns the payload decoded by the CallbackRouter handling the current update.
+func CallbackPayload(ctx *ext.Context) *callbackdata.Payload {
+	payload, _ := ctx.Data[callbackPayloadDataKey].(*callbackdata.Payload)
+	return payload
+}
+
+// CallbackPayloadError returns the reason why the CallbackRouter handling the current update couldn't decode the
+// payload; for use in CallbackRouter.Invalid.
+func CallbackPayloadError(ctx *ext.Context) error {
+	err, _ := ctx.Data[callbackPayloadErrorDataKey].(error)
+	return err
+}
+
+// decode decodes the payload of the current callback query. Returns false if the callback query doesn't belong to
+// this router.
+func (r *CallbackRouter) decode(ctx *ext.Context) (*callbackdata.Payload, bool, error) {
+	cq := ctx.CallbackQuery
+	if cq == nil || !strings.HasPrefix(cq.Data, r.Codec.Prefix) {
+		return nil, false, nil
+	}
+	if r.Codec.Validate() != nil {
+		// Invalid prefixes may overlap with other routers' prefixes, so the update can't be claimed.
+		return nil, false, nil
+	}
+
+	if !r.AllowChannel && cq.Message != nil && cq.Message.Chat.Type == "channel" {
+		return nil, false, nil
+	}
+
+	payload, err := r.Codec.Decode(cq.Data)
+	return payload, true, err
+}
@@ -0,0 +1,163 @@
+package handlers_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/callbackdata"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers"
+)
+
+func newCallbackQuery(data string) *ext.Context {
+	return ext.NewContext(&gotgbot.Update{
+		CallbackQuery: &gotgbot.CallbackQuery{
+			Id:   "1",
+			From: gotgbot.User{Id: 1},
+			Data: data,
+		},
+	}, nil)
+}
+
+func TestCallbackRouter(t *testing.T) {
+	b := NewTestBot()
+	codec := callbackdata.Codec{Prefix: "r:", Secret: []byte("secret")}
+
+	var deleted int64
+	var invalid error
+	router := handlers.NewCallbackRouter(codec).
+		On("del", func(b *gotgbot.Bot, ctx *ext.Context) error {
+			var err error
+			deleted, err = handlers.CallbackPayload(ctx).GetInt("id")
+			return err
+		})
+
+	data, err := codec.Encode(callbackdata.NewPayload("del").SetInt("id", 42))
+	if err != nil {
+		t.Fatalf("failed to encode payload: %v", err)
+	}
+
+	ctx := newCallbackQuery(data)
+	if !router.CheckUpdate(b, ctx) {
+		t.Fatalf("expected payload to match")
+	}
+	if err := router.HandleUpdate(b, ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if deleted != 42 {
+		t.Errorf("expected id 42, got %d", deleted)
+	}
+
+	tampered := strings.Replace(data, "id=16", "id=17", 1)
+	unknown, err := codec.Encode(callbackdata.NewPayload("other"))
+	if err != nil {
+		t.Fatalf("failed to encode payload: %v", err)
+	}
+	for name, data := range map[string]string{
+		"unknown action": unknown,
+		"other prefix":   "x:del",
+		"tampered":       tampered,
+	} {
+		if router.CheckUpdate(b, newCallbackQuery(data)) {
+			t.Errorf("%s: did not expect callback query to match", name)
+		}
+	}
+
+	// Invalid payloads are matched once an Invalid response is set.
+	router.Invalid = func(b *gotgbot.Bot, ctx *ext.Context) error {
+		invalid = handlers.CallbackPayloadError(ctx)
+		return nil
+	}
+	ctx = newCallbackQuery(tampered)
+	if !router.CheckUpdate(b, ctx) {
+		t.Fatalf("expected tampered payload to match the invalid response")
+	}
+	if err := router.HandleUpdate(b, ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !errors.Is(invalid, callbackdata.ErrInvalidSignature) {
+		t.Errorf("expected invalid signature error, got %v", invalid)
+	}
+}
+
+func TestCallbackRouterPrefixes(t *testing.T) {
+	b := NewTestBot()
+
+	// Both routers handle invalid payloads, so each must only claim the payloads with its own prefix.
+	var handled []string
+	newRouter := func(prefix string) *handlers.CallbackRouter {
+		router := handlers.NewCallbackRouter(callbackdata.Codec{Prefix: prefix}).
+			On("a", func(b *gotgbot.Bot, ctx *ext.Context) error {
+				handled = append(handled, prefix)
+				return nil
+			})
+		router.Invalid = func(b *gotgbot.Bot, ctx *ext.Context) error {
+			handled = append(handled, prefix+"invalid")
+			return nil
+		}
+		return router
+	}
+	d := ext.NewDispatcher(nil)
+	d.AddHandler(newRouter("cb:"))
+	d.AddHandler(newRouter("cb2:"))
+
+	for _, data := range []string{"cb:a", "cb2:a", "cb2:a;x"} {
+		if err := d.ProcessUpdate(b, newCallbackQuery(data).Update, nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if expected := []string{"cb:", "cb2:", "cb2:invalid"}; strings.Join(handled, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected payloads to be routed to %v, got %v", expected, handled)
+	}
+
+	// Routers with an invalid prefix could claim other routers' payloads, so they never match.
+	if newRouter("cb").CheckUpdate(b, newCallbackQuery("cb2:a")) {
+		t.Errorf("did not expect a router with an invalid prefix to match")
+	}
+}
+
+// countingStore is a callbackdata.Store which counts how many payloads are loaded.
+type countingStore struct {
+	*callbackdata.InMemoryStore
+	gets int
+}
+
+func (s *countingStore) Get(id string) (string, bool, error) {
+	s.gets++
+	return s.InMemoryStore.Get(id)
+}
+
+func TestCallbackRouterDecodesOnce(t *testing.T) {
+	b := NewTestBot()
+	store := &countingStore{InMemoryStore: callbackdata.NewInMemoryStore(0)}
+	codec := callbackdata.Codec{Prefix: "r:", Store: store}
+
+	var query string
+	router := handlers.NewCallbackRouter(codec).
+		On("search", func(b *gotgbot.Bot, ctx *ext.Context) error {
+			query = handlers.CallbackPayload(ctx).Get("q")
+			return nil
+		})
+
+	long := strings.Repeat("x", 100)
+	data, err := codec.Encode(callbackdata.NewPayload("search").Set("q", long))
+	if err != nil {
+		t.Fatalf("failed to encode payload: %v", err)
+	}
+
+	ctx := newCallbackQuery(data)
+	if !router.CheckUpdate(b, ctx) {
+		t.Fatalf("expected stored payload to match")
+	}
+	if err := router.HandleUpdate(b, ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if query != long {
+		t.Errorf("expected the stored query, got %q", query)
+	}
+	if store.gets != 1 {
+		t.Errorf("expected the payload to be loaded once, got %d", store.gets)
+	}
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"fmt"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers/filters"
+)
+
+// ChatMemberTransition handles chat member updates which contain a specific transition, such as a user joining or
+// being promoted. It can handle both ChatMember and MyChatMember updates.
+type ChatMemberTransition struct {
+	Transition        gotgbot.ChatMemberTransition
+	AllowChatMember   bool
+	AllowMyChatMember bool
+	// Filter is an optional additional filter, applied once the transition has been matched.
+	Filter   filters.ChatMember
+	Response Response
+}
+
+func NewChatMemberTransition(t gotgbot.ChatMemberTransition, r Response) ChatMemberTransition {
+	return ChatMemberTransition{
+		Transition:        t,
+		AllowChatMember:   true,
+		AllowMyChatMember: true,
+		Response:          r,
+	}
+}
+
+// NewBotAdded handles the bot being added to a chat.
+func NewBotAdded(r Response) ChatMemberTransition {
+	return ChatMemberTransition{
+		Transition:        gotgbot.ChatMemberTransitionJoined,
+		AllowChatMember:   false,
+		AllowMyChatMember: true,
+		Response:          r,
+	}
+}
+
+func (c ChatMemberTransition) CheckUpdate(b *gotgbot.Bot, ctx *ext.Context) bool {
+	var cmu *gotgbot.ChatMemberUpdated
+	if c.AllowChatMember && ctx.ChatMember != nil {
+		cmu = ctx.ChatMember
+	} else if c.AllowMyChatMember && ctx.MyChatMember != nil {
+		cmu = ctx.MyChatMember
+	}
+	if cmu == nil || !cmu.HasTransition(c.Transition) {
+		return false
+	}
+
+	return c.Filter == nil || c.Filter(cmu)
+}
+
+func (c ChatMemberTransition) HandleUpdate(b *gotgbot.Bot, ctx *ext.Context) error {
+	return c.Response(b, ctx)
+}
+
+func (c ChatMemberTransition) Name() string {
+	return fmt.Sprintf("chatmembertransition_%s_%p", c.Transition, c.Response)
+}
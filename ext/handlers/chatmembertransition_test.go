@@ -0,0 +1,33 @@
+package handlers_test
+
+import (
+	"testing"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers"
+)
+
+func TestBotAdded(t *testing.T) {
+	b := NewTestBot()
+
+	cmu := &gotgbot.ChatMemberUpdated{
+		Chat:          gotgbot.Chat{Id: -100, Type: "supergroup"},
+		From:          gotgbot.User{Id: 1},
+		OldChatMember: gotgbot.ChatMemberLeft{User: b.User},
+		NewChatMember: gotgbot.ChatMemberMember{User: b.User},
+	}
+
+	h := handlers.NewBotAdded(func(b *gotgbot.Bot, ctx *ext.Context) error { return nil })
+	if !h.CheckUpdate(b, ext.NewContext(&gotgbot.Update{MyChatMember: cmu}, nil)) {
+		t.Errorf("expected bot added handler to match my_chat_member update")
+	}
+	if h.CheckUpdate(b, ext.NewContext(&gotgbot.Update{ChatMember: cmu}, nil)) {
+		t.Errorf("did not expect bot added handler to match chat_member update")
+	}
+
+	left := handlers.NewChatMemberTransition(gotgbot.ChatMemberTransitionLeft, func(b *gotgbot.Bot, ctx *ext.Context) error { return nil })
+	if left.CheckUpdate(b, ext.NewContext(&gotgbot.Update{ChatMember: cmu}, nil)) {
+		t.Errorf("did not expect left handler to match a join")
+	}
+}
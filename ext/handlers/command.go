@@ -1,19 +1,34 @@
 package handlers
 
 import (
+	"fmt"
+	"regexp"
 	"strings"
+	"unicode"
+	"unicode/utf16"
 	"unicode/utf8"
 
 	"github.com/PaulSonOfLars/gotgbot/v2"
 	"github.com/PaulSonOfLars/gotgbot/v2/ext"
 )
 
+const (
+	// commandAliasDataKey is the ext.Context.Data key used to store the command alias matched by a Command handler.
+	commandAliasDataKey = "handlers.command.alias"
+	// commandArgsDataKey is the ext.Context.Data key used to store the raw arguments of a Command handler.
+	commandArgsDataKey = "handlers.command.args"
+)
+
 type Command struct {
 	Triggers     []rune
 	AllowEdited  bool
 	AllowChannel bool
 	Command      string // should be lowercase for case-insensitivity
-	Response     Response
+	// Aliases are additional command names which should trigger this handler; these should also be lowercase.
+	Aliases []string
+	// Regex, if set, is matched against the lowercase command name, without the trigger or the bot username.
+	Regex    *regexp.Regexp
+	Response Response
 }
 
 func NewCommand(c string, r Response) Command {
@@ -26,73 +41,189 @@ func NewCommand(c string, r Response) Command {
 	}
 }
 
+// NewCommandAliases creates a Command handler which triggers on any of the given aliases.
+// The first alias is used as the main command name.
+func NewCommandAliases(aliases []string, r Response) Command {
+	lowerAliases := make([]string, 0, len(aliases))
+	for _, a := range aliases {
+		lowerAliases = append(lowerAliases, strings.ToLower(a))
+	}
+
+	var c Command
+	if len(lowerAliases) > 0 {
+		c = NewCommand(lowerAliases[0], r)
+		c.Aliases = lowerAliases[1:]
+	} else {
+		c = NewCommand("", r)
+	}
+	return c
+}
+
+// NewCommandRegex creates a Command handler which triggers on any command name matching the given regex.
+// The regex is matched against the lowercase command name, so "/Start@bot foo" would be checked as "start".
+func NewCommandRegex(p string, r Response) (Command, error) {
+	rgx, err := regexp.Compile(p)
+	if err != nil {
+		return Command{}, fmt.Errorf("failed to compile regex: %w", err)
+	}
+
+	c := NewCommand("", r)
+	c.Regex = rgx
+	return c, nil
+}
+
 func (c Command) CheckUpdate(b *gotgbot.Bot, ctx *ext.Context) bool {
-	if ctx.Message != nil {
-		if ctx.Message.Text == "" && ctx.Message.Caption == "" {
-			return false
+	msg := c.getMessage(ctx)
+	if msg == nil {
+		return false
+	}
+
+	_, _, ok := c.matchCommand(b, msg)
+	return ok
+}
+
+func (c Command) HandleUpdate(b *gotgbot.Bot, ctx *ext.Context) error {
+	if msg := c.getMessage(ctx); msg != nil {
+		if alias, args, ok := c.matchCommand(b, msg); ok {
+			ctx.Data[commandAliasDataKey] = alias
+			ctx.Data[commandArgsDataKey] = args
 		}
-		return c.checkMessage(b, ctx.Message)
+	}
+	return c.Response(b, ctx)
+}
+
+func (c Command) Name() string {
+	if c.Command == "" && c.Regex != nil {
+		return "command_" + c.Regex.String()
+	}
+	return "command_" + c.Command
+}
+
+// CommandAlias returns the command name which was matched by the Command handler handling the current update.
+// This is useful when a handler has multiple aliases, or uses a regex.
+func CommandAlias(ctx *ext.Context) string {
+	alias, _ := ctx.Data[commandAliasDataKey].(string)
+	return alias
+}
+
+// CommandArgs returns the raw argument string following the command matched by the Command handler handling the
+// current update, with any leading whitespace removed.
+func CommandArgs(ctx *ext.Context) string {
+	args, _ := ctx.Data[commandArgsDataKey].(string)
+	return args
+}
+
+// getMessage returns the message to check, based on the handler's settings.
+func (c Command) getMessage(ctx *ext.Context) *gotgbot.Message {
+	if ctx.Message != nil {
+		return ctx.Message
 	}
 
 	// if no edits and message is edited
 	if c.AllowEdited && ctx.EditedMessage != nil {
-		if ctx.EditedMessage.Text == "" && ctx.EditedMessage.Caption == "" {
-			return false
-		}
-		return c.checkMessage(b, ctx.EditedMessage)
+		return ctx.EditedMessage
 	}
 	// if no channel and message is channel message
 	if c.AllowChannel && ctx.ChannelPost != nil {
-		if ctx.ChannelPost.Text == "" && ctx.ChannelPost.Caption == "" {
-			return false
-		}
-		return c.checkMessage(b, ctx.ChannelPost)
+		return ctx.ChannelPost
 	}
 	// if no channel, no edits, and post is edited
 	if c.AllowChannel && c.AllowEdited && ctx.EditedChannelPost != nil {
-		if ctx.EditedChannelPost.Text == "" && ctx.EditedChannelPost.Caption == "" {
-			return false
-		}
-		return c.checkMessage(b, ctx.EditedChannelPost)
+		return ctx.EditedChannelPost
 	}
 
-	return false
+	return nil
 }
 
-func (c Command) HandleUpdate(b *gotgbot.Bot, ctx *ext.Context) error {
-	return c.Response(b, ctx)
-}
+// matchCommand checks whether the message contains a matching command, and returns the matched command name along
+// with the raw argument string.
+func (c Command) matchCommand(b *gotgbot.Bot, msg *gotgbot.Message) (string, string, bool) {
+	name, args, ok := c.parseCommand(b, msg)
+	if !ok || name == "" {
+		return "", "", false
+	}
 
-func (c Command) Name() string {
-	return "command_" + c.Command
+	if name == c.Command {
+		return name, args, true
+	}
+	for _, a := range c.Aliases {
+		if name == a {
+			return name, args, true
+		}
+	}
+	if c.Regex != nil && c.Regex.MatchString(name) {
+		return name, args, true
+	}
+
+	return "", "", false
 }
 
-func (c Command) checkMessage(b *gotgbot.Bot, msg *gotgbot.Message) bool {
-	text := msg.Text
-	if msg.Caption != "" {
-		text = msg.Caption
+// parseCommand extracts the lowercase command name and raw arguments from a message's text or caption.
+// Text and caption are checked against their respective entities.
+func (c Command) parseCommand(b *gotgbot.Bot, msg *gotgbot.Message) (string, string, bool) {
+	text, entities := msg.Text, msg.Entities
+	if text == "" {
+		text, entities = msg.Caption, msg.CaptionEntities
+	}
+	if text == "" {
+		return "", "", false
 	}
 
-	var cmd string
-	for _, t := range c.Triggers {
-		if r, _ := utf8.DecodeRuneInString(text); r != t {
-			continue
-		}
+	trigger, triggerSize := utf8.DecodeRuneInString(text)
+	if !containsRune(c.Triggers, trigger) {
+		return "", "", false
+	}
 
-		split := strings.Split(strings.ToLower(strings.Fields(text)[0]), "@")
-		if len(split) > 1 && split[1] != strings.ToLower(b.User.Username) {
-			return false
+	var token string
+	if ent := startEntity(entities); ent != nil {
+		if ent.Type != "bot_command" {
+			return "", "", false
 		}
-		cmd = split[0][1:]
-		break
+		utf16Text := utf16.Encode([]rune(text))
+		if ent.Length > int64(len(utf16Text)) {
+			return "", "", false
+		}
+		token = string(utf16.Decode(utf16Text[:ent.Length]))
+	} else {
+		token = strings.Fields(text)[0]
 	}
-	if cmd == "" {
-		return false
+
+	// Entities which are too short to hold a command name, or which don't align with the text's characters, are not
+	// commands.
+	if len(token) <= triggerSize || !strings.HasPrefix(text, token) {
+		return "", "", false
 	}
 
-	if len(msg.Entities) != 0 && msg.Entities[0].Offset == 0 && msg.Entities[0].Type != "bot_command" {
-		return false
+	split := strings.SplitN(strings.ToLower(token[triggerSize:]), "@", 2)
+	if len(split) > 1 && split[1] != strings.ToLower(b.User.Username) {
+		return "", "", false
+	}
+
+	return split[0], strings.TrimLeftFunc(text[len(token):], unicode.IsSpace), true
+}
+
+// startEntity returns the entity at the start of the message, if any. bot_command entities are preferred.
+func startEntity(entities []gotgbot.MessageEntity) *gotgbot.MessageEntity {
+	var first *gotgbot.MessageEntity
+	for i := range entities {
+		if entities[i].Offset != 0 {
+			continue
+		}
+		if entities[i].Type == "bot_command" {
+			return &entities[i]
+		}
+		if first == nil {
+			first = &entities[i]
+		}
 	}
+	return first
+}
 
-	return cmd == c.Command
+func containsRune(rs []rune, r rune) bool {
+	for _, x := range rs {
+		if x == r {
+			return true
+		}
+	}
+	return false
 }
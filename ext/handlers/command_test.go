@@ -0,0 +1,121 @@
+package handlers_test
+
+import (
+	"testing"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers"
+)
+
+func TestCommandAliases(t *testing.T) {
+	b := NewTestBot()
+
+	var alias string
+	var args string
+	cmd := handlers.NewCommandAliases([]string{"help", "H", "info"}, func(b *gotgbot.Bot, ctx *ext.Context) error {
+		alias = handlers.CommandAlias(ctx)
+		args = handlers.CommandArgs(ctx)
+		return nil
+	})
+
+	for name, expected := range map[string]string{"help": "help", "h": "h", "INFO": "info"} {
+		ctx := NewCommandMessage(1, 1, name, []string{"some", "args"})
+		if !cmd.CheckUpdate(b, ctx) {
+			t.Fatalf("expected command %s to match", name)
+		}
+		if err := cmd.HandleUpdate(b, ctx); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if alias != expected {
+			t.Errorf("expected alias %s, got %s", expected, alias)
+		}
+		if args != "some args" {
+			t.Errorf("expected args 'some args', got '%s'", args)
+		}
+	}
+
+	if cmd.CheckUpdate(b, NewCommandMessage(1, 1, "helper", nil)) {
+		t.Errorf("did not expect command 'helper' to match")
+	}
+}
+
+func TestCommandRegex(t *testing.T) {
+	b := NewTestBot()
+
+	cmd, err := handlers.NewCommandRegex("^ban[0-9]+$", func(b *gotgbot.Bot, ctx *ext.Context) error { return nil })
+	if err != nil {
+		t.Fatalf("failed to create regex command: %v", err)
+	}
+
+	if !cmd.CheckUpdate(b, NewCommandMessage(1, 1, "ban10", nil)) {
+		t.Errorf("expected command 'ban10' to match")
+	}
+	if cmd.CheckUpdate(b, NewCommandMessage(1, 1, "ban", nil)) {
+		t.Errorf("did not expect command 'ban' to match")
+	}
+	if !cmd.CheckUpdate(b, NewCommandMessage(1, 1, "ban1@gotgbot", nil)) {
+		t.Errorf("expected command 'ban1@gotgbot' to match")
+	}
+	if cmd.CheckUpdate(b, NewCommandMessage(1, 1, "ban1@otherbot", nil)) {
+		t.Errorf("did not expect command addressed to another bot to match")
+	}
+}
+
+func TestCommandCaption(t *testing.T) {
+	b := NewTestBot()
+
+	var args string
+	cmd := handlers.NewCommand("start", func(b *gotgbot.Bot, ctx *ext.Context) error {
+		args = handlers.CommandArgs(ctx)
+		return nil
+	})
+
+	text, ents := buildCommand("start", []string{"caption", "args"})
+	ctx := ext.NewContext(&gotgbot.Update{
+		Message: &gotgbot.Message{
+			Caption:         text,
+			CaptionEntities: ents,
+			Photo:           []gotgbot.PhotoSize{{FileId: "file"}},
+			Chat:            gotgbot.Chat{Id: 1, Type: "private"},
+		},
+	}, nil)
+
+	if !cmd.CheckUpdate(b, ctx) {
+		t.Fatalf("expected caption command to match")
+	}
+	if err := cmd.HandleUpdate(b, ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if args != "caption args" {
+		t.Errorf("expected args 'caption args', got '%s'", args)
+	}
+
+	// A non-command entity at the start of the caption should not match.
+	ctx.Message.CaptionEntities = []gotgbot.MessageEntity{{Type: "bold", Offset: 0, Length: 6}}
+	if cmd.CheckUpdate(b, ctx) {
+		t.Errorf("did not expect a bold caption to match")
+	}
+}
+
+func TestCommandShortEntity(t *testing.T) {
+	b := NewTestBot()
+
+	cmd := handlers.NewCommand("start", func(b *gotgbot.Bot, ctx *ext.Context) error { return nil })
+	cmd.Triggers = []rune("/→")
+
+	for name, tc := range map[string]struct {
+		text   string
+		length int64
+	}{
+		"zero length":         {text: "/start", length: 0},
+		"multibyte trigger":   {text: "→start", length: 1},
+		"half of a surrogate": {text: "/😀start", length: 2},
+	} {
+		ctx := NewMessage(1, 1, tc.text)
+		ctx.Message.Entities = []gotgbot.MessageEntity{{Type: "bot_command", Offset: 0, Length: tc.length}}
+		if cmd.CheckUpdate(b, ctx) {
+			t.Errorf("%s: did not expect entity to match", name)
+		}
+	}
+}
@@ -1,16 +1,20 @@
 package handlers
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"reflect"
+	"sync"
+	"time"
 
 	"github.com/PaulSonOfLars/gotgbot/v2"
 	"github.com/PaulSonOfLars/gotgbot/v2/ext"
 	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers/conversation"
 )
 
-// TODO: Add a "block" option to force linear processing. Also a "waiting" state to handle blocked handlers.
-// TODO: Allow for timeouts (and a "timeout" state to handle that)
+// conversationDataKey is the ext.Context.Data key used to store the data of the current conversation.
+const conversationDataKey = "handlers.conversation.data"
 
 // The Conversation handler is an advanced handler which allows for running a sequence of commands in a stateful manner.
 // An example of this flow can be found at t.me/Botfather; upon receiving the "/newbot" command, the user is asked for
@@ -33,6 +37,20 @@ type Conversation struct {
 	Fallbacks []ext.Handler
 	// If True, a user can restart the conversation by hitting one of the entry points.
 	AllowReEntry bool
+	// Timeout is the duration after which an idle conversation is ended. A zero value disables timeouts.
+	Timeout time.Duration
+	// TimeoutHandlers is the list of handlers to run when a conversation times out, with the last update handled by
+	// the conversation. The first matching handler is run.
+	TimeoutHandlers []ext.Handler
+	// If True, each conversation processes a single update at a time.
+	Block bool
+	// WaitingHandlers is the list of handlers to handle the updates of blocking conversations which arrive while
+	// another update is being processed. If empty, such updates are queued instead.
+	WaitingHandlers []ext.Handler
+
+	// locks holds the per-key locks of blocking conversations. It is nil for conversations created as struct literals,
+	// which use lockSet instead.
+	locks *conversationLocks
 }
 
 type ConversationOpts struct {
@@ -44,13 +62,31 @@ type ConversationOpts struct {
 	// If True, a user can restart the conversation at any time by hitting one of the entry points again.
 	AllowReEntry bool
 	// StateStorage is responsible for storing all running conversations.
+	// If it implements conversation.VersionedStorage, state changes fail with a conversation.ConflictError when the
+	// conversation was changed concurrently (eg by another replica); the update can then be retried.
 	StateStorage conversation.Storage
+	// Timeout is the duration after which an idle conversation is ended. A zero value disables timeouts.
+	// Timed out conversations are ended when their next update arrives, or when CheckTimeouts is called; use
+	// StartTimeoutChecker to end them as soon as they time out.
+	Timeout time.Duration
+	// TimeoutHandlers is the list of handlers to run when a conversation times out (eg to tell the user that their
+	// session has expired). These are run with the last update handled by the conversation.
+	TimeoutHandlers []ext.Handler
+	// If True, each conversation processes a single update at a time, so that two quick updates can't both advance the
+	// same state. Conversations are identified by the StateStorage's keys if it implements
+	// conversation.KeyedStorage, or by sender and chat otherwise.
+	Block bool
+	// WaitingHandlers is the list of handlers to handle the updates of blocking conversations which arrive while
+	// another update is being processed (eg to ask the user to wait). State changes returned by these handlers are
+	// ignored. If empty, such updates are queued, and handled once the conversation is free.
+	WaitingHandlers []ext.Handler
 }
 
 func NewConversation(entryPoints []ext.Handler, states map[string][]ext.Handler, opts *ConversationOpts) Conversation {
 	c := Conversation{
 		EntryPoints: entryPoints,
 		States:      states,
+		locks:       newConversationLocks(),
 		// Setup a default storage medium
 		StateStorage: conversation.NewInMemoryStorage(conversation.KeyStrategySenderAndChat),
 	}
@@ -59,6 +95,10 @@ func NewConversation(entryPoints []ext.Handler, states map[string][]ext.Handler,
 		c.Exits = opts.Exits
 		c.Fallbacks = opts.Fallbacks
 		c.AllowReEntry = opts.AllowReEntry
+		c.Timeout = opts.Timeout
+		c.TimeoutHandlers = opts.TimeoutHandlers
+		c.Block = opts.Block
+		c.WaitingHandlers = opts.WaitingHandlers
 
 		// If no StateStorage is specified, we should keep the default.
 		if opts.StateStorage != nil {
@@ -70,35 +110,77 @@ func NewConversation(entryPoints []ext.Handler, states map[string][]ext.Handler,
 }
 
 func (c Conversation) CheckUpdate(b *gotgbot.Bot, ctx *ext.Context) bool {
+	if key, ok := c.key(ctx); ok && c.Block && c.lockSet().busy(key) {
+		if len(c.WaitingHandlers) > 0 {
+			return checkHandlerList(c.WaitingHandlers, b, ctx) != nil
+		}
+		// The state is about to change, so updates which could be part of the conversation once it has changed are
+		// queued, and checked again once the conversation is free. Other updates are left to the next handlers.
+		return c.matchesAnyState(b, ctx)
+	}
+
 	// Note: Kinda sad that this error gets lost.
-	h, _ := c.getNextHandler(b, ctx)
+	_, h, _, _ := c.getNextHandler(b, ctx)
 	return h != nil
 }
 
 func (c Conversation) HandleUpdate(b *gotgbot.Bot, ctx *ext.Context) error {
-	next, err := c.getNextHandler(b, ctx)
+	// Updates without a key aren't part of any conversation, so don't need to be blocked.
+	if key, ok := c.key(ctx); ok && c.Block {
+		locks := c.lockSet()
+		if len(c.WaitingHandlers) == 0 {
+			locks.acquire(key)
+		} else if !locks.tryAcquire(key) {
+			return c.handleWaiting(b, ctx)
+		}
+		defer locks.release(key)
+	}
+
+	return c.handleUpdate(b, ctx)
+}
+
+// handleUpdate handles the update as part of the conversation.
+func (c Conversation) handleUpdate(b *gotgbot.Bot, ctx *ext.Context) error {
+	// End the current conversation first if it has timed out, so that this update can start a new one.
+	if err := c.endTimedOut(b, ctx); err != nil {
+		return err
+	}
+
+	currState, next, reEntry, err := c.getNextHandler(b, ctx)
 	if err != nil {
 		return fmt.Errorf("failed to get next handler in conversation: %w", err)
 	}
 	if next == nil {
-		// Note: this should be impossible
-		return nil
+		// The state changed since CheckUpdate was called (eg while a blocking conversation was busy), so the update no
+		// longer matches.
+		return ext.ContinueGroups
+	}
+
+	var origData map[string]string
+	if currState != nil {
+		origData = currState.Data
+	}
+	data := copyData(origData)
+	if reEntry {
+		// Restarted conversations don't keep the data of the abandoned run.
+		data = map[string]string{}
 	}
 
 	var stateChange *ConversationStateChange
-	err = next.HandleUpdate(b, ctx)
+	err = handleWithData(next, b, ctx, data)
 	if !errors.As(err, &stateChange) {
+		// The conversation stays in the same state, but is no longer idle, and its data may have changed.
+		if currState != nil && (c.Timeout > 0 || !reflect.DeepEqual(data, copyData(origData))) {
+			if err := c.setState(ctx, currState, c.newState(ctx, currState.Key, data)); err != nil {
+				return fmt.Errorf("failed to update conversation state: %w", err)
+			}
+		}
 		// We don't wrap this error, as users might want to handle it explicitly
 		return err
 	}
 
-	if stateChange.End {
-		// Mark the conversation as ended by deleting the conversation reference.
-		err := c.StateStorage.Delete(ctx)
-		if err != nil {
-			return fmt.Errorf("failed to end conversation: %w", err)
-		}
-	}
+	// Nested conversations which change this conversation's state pass their data on.
+	mergeData(data, stateChange.data)
 
 	if stateChange.NextState != nil {
 		// If the next state is defined, then move to it.
@@ -106,15 +188,35 @@ func (c Conversation) HandleUpdate(b *gotgbot.Bot, ctx *ext.Context) error {
 			// Check if the "next" state is a supported state.
 			return fmt.Errorf("unknown state: %w", stateChange)
 		}
-		err := c.StateStorage.Set(ctx, conversation.State{Key: *stateChange.NextState})
+		// Ended conversations start over without any data.
+		nextData := data
+		if stateChange.End {
+			nextData = nil
+		}
+		err := c.setState(ctx, currState, c.newState(ctx, *stateChange.NextState, nextData))
+		if err != nil {
+			return fmt.Errorf("failed to update conversation state: %w", err)
+		}
+	} else if stateChange.End {
+		// Mark the conversation as ended by deleting the conversation reference.
+		err := c.deleteState(ctx, currState)
+		if err != nil {
+			return fmt.Errorf("failed to end conversation: %w", err)
+		}
+	} else if currState != nil {
+		// The state is unchanged, but the data and timeout still need updating.
+		err := c.setState(ctx, currState, c.newState(ctx, currState.Key, data))
 		if err != nil {
 			return fmt.Errorf("failed to update conversation state: %w", err)
 		}
 	}
 
 	if stateChange.ParentState != nil {
-		// If a parent state is set, return that state for it to be handled.
-		return stateChange.ParentState
+		// If a parent state is set, return that state for it to be handled, along with this conversation's data.
+		parentState := *stateChange.ParentState
+		parentState.data = copyData(parentState.data)
+		mergeData(parentState.data, data)
+		return &parentState
 	}
 
 	return nil
@@ -128,6 +230,10 @@ type ConversationStateChange struct {
 	End bool
 	// Move the parent conversation (if any) to the desired state.
 	ParentState *ConversationStateChange
+
+	// data is the data of the nested conversation which returned this state change, to be merged into the parent
+	// conversation's data.
+	data map[string]string
 }
 
 func (s *ConversationStateChange) Error() string {
@@ -167,43 +273,301 @@ func (c Conversation) Name() string {
 }
 
 // getNextHandler goes through all the handlers in the conversation, until it finds a handler that matches.
-// If no matching handler is found, returns nil.
-func (c Conversation) getNextHandler(b *gotgbot.Bot, ctx *ext.Context) (ext.Handler, error) {
+// If no matching handler is found, returns nil. The current state is also returned, or nil if the conversation hasn't
+// started, as well as whether the handler is an entry point restarting the current conversation.
+func (c Conversation) getNextHandler(b *gotgbot.Bot, ctx *ext.Context) (*conversation.State, ext.Handler, bool, error) {
 	// Check if a conversation has already started for this user.
 	currState, err := c.StateStorage.Get(ctx)
+	if err == nil && currState.TimedOut(time.Now()) {
+		// Timed out conversations are about to be ended, so the update is handled as part of a new conversation.
+		err = conversation.KeyNotFound
+	}
 	if err != nil {
 		if errors.Is(err, conversation.KeyNotFound) {
 			// If this is an unknown conversation key, then we know this is a new conversation, so we check all
 			// entrypoints.
-			return checkHandlerList(c.EntryPoints, b, ctx), nil
+			return nil, checkHandlerList(c.EntryPoints, b, ctx), false, nil
+		}
+		if errors.Is(err, conversation.ErrNoKey) {
+			// Updates without a key can't be part of a conversation.
+			return nil, nil, false, nil
 		}
 		// Else, we need to handle the error.
-		return nil, fmt.Errorf("failed to get state from conversation storage: %w", err)
+		return nil, nil, false, fmt.Errorf("failed to get state from conversation storage: %w", err)
 	}
 
 	// If reentry is allowed, check the entrypoints again.
 	if c.AllowReEntry {
 		if next := checkHandlerList(c.EntryPoints, b, ctx); next != nil {
-			return next, nil
+			return currState, next, true, nil
 		}
 	}
 
 	// Else, exits -> handle any conversation exits/cancellations.
 	if next := checkHandlerList(c.Exits, b, ctx); next != nil {
-		return wrappedExitHandler{h: next}, nil
+		return currState, wrappedExitHandler{h: next}, false, nil
 	}
 
 	// Else, check state mappings (the magic happens here!).
 	if next := checkHandlerList(c.States[currState.Key], b, ctx); next != nil {
-		return next, nil
+		return currState, next, false, nil
 	}
 
 	// Else, fallbacks -> handle any updates which haven't been caught by the state or exit handlers.
 	if next := checkHandlerList(c.Fallbacks, b, ctx); next != nil {
-		return next, nil
+		return currState, next, false, nil
+	}
+
+	return currState, nil, false, nil
+}
+
+// newState creates the state to store when moving to the given state key with the given data. If the conversation
+// has a timeout, the expiry is set, and the current update is kept for the timeout handlers.
+func (c Conversation) newState(ctx *ext.Context, key string, data map[string]string) conversation.State {
+	s := conversation.State{Key: key}
+	if len(data) > 0 {
+		s.Data = data
+	}
+	if c.Timeout > 0 {
+		s.Expiry = time.Now().Add(c.Timeout)
+		s.LastUpdate = ctx.Update
+	}
+	return s
+}
+
+// setState stores the new state of the conversation. If the StateStorage supports it, this fails with a
+// conversation.ConflictError if the stored state is no longer the current state.
+func (c Conversation) setState(ctx *ext.Context, currState *conversation.State, s conversation.State) error {
+	if storage, ok := c.StateStorage.(conversation.VersionedStorage); ok {
+		return storage.CompareAndSet(ctx, stateVersion(currState), s)
+	}
+	return c.StateStorage.Set(ctx, s)
+}
+
+// deleteState ends the conversation. If the StateStorage supports it, this fails with a conversation.ConflictError if
+// the stored state is no longer the current state.
+func (c Conversation) deleteState(ctx *ext.Context, currState *conversation.State) error {
+	if storage, ok := c.StateStorage.(conversation.VersionedStorage); ok {
+		return storage.CompareAndDelete(ctx, stateVersion(currState))
 	}
+	return c.StateStorage.Delete(ctx)
+}
+
+// stateVersion returns the version of the given state, or 0 if the conversation hasn't started.
+func stateVersion(s *conversation.State) uint64 {
+	if s == nil {
+		return 0
+	}
+	return s.Version
+}
 
-	return nil, nil
+// endTimedOut ends the current conversation if it has timed out, and runs the timeout handlers.
+func (c Conversation) endTimedOut(b *gotgbot.Bot, ctx *ext.Context) error {
+	currState, err := c.StateStorage.Get(ctx)
+	if err != nil {
+		if errors.Is(err, conversation.KeyNotFound) || errors.Is(err, conversation.ErrNoKey) {
+			return nil
+		}
+		return fmt.Errorf("failed to get state from conversation storage: %w", err)
+	}
+	if !currState.TimedOut(time.Now()) {
+		return nil
+	}
+
+	// The conversation is ended before running the timeout handlers, so that failing handlers aren't retried.
+	if err := c.deleteState(ctx, currState); err != nil {
+		var conflict *conversation.ConflictError
+		if errors.As(err, &conflict) {
+			// The conversation was changed or ended concurrently (eg by another replica), so it is no longer ours to
+			// time out.
+			return nil
+		}
+		return fmt.Errorf("failed to end timed out conversation: %w", err)
+	}
+	return c.handleTimeout(b, currState)
+}
+
+// handleTimeout runs the first matching timeout handler with the last update of the timed out conversation.
+func (c Conversation) handleTimeout(b *gotgbot.Bot, s *conversation.State) error {
+	if s.LastUpdate == nil {
+		return nil
+	}
+
+	ctx := ext.NewContext(s.LastUpdate, nil)
+	next := checkHandlerList(c.TimeoutHandlers, b, ctx)
+	if next == nil {
+		return nil
+	}
+
+	// The data of the timed out conversation is made available, eg to save partially completed forms.
+	err := handleWithData(next, b, ctx, copyData(s.Data))
+	var stateChange *ConversationStateChange
+	if errors.As(err, &stateChange) {
+		// The conversation has already ended; state changes are meaningless here.
+		return nil
+	}
+	return err
+}
+
+// CheckTimeouts ends all the conversations which have timed out, and runs the timeout handlers for each of them.
+// This allows for users to be notified without waiting for their next update; it should be called periodically, eg
+// with StartTimeoutChecker.
+//
+// This requires the StateStorage to implement conversation.TimeoutStorage; other storages are only checked for
+// timeouts when the next update of each conversation arrives.
+func (c Conversation) CheckTimeouts(b *gotgbot.Bot) error {
+	storage, ok := c.StateStorage.(conversation.TimeoutStorage)
+	if !ok {
+		return nil
+	}
+
+	states, err := storage.TimedOut(time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to get timed out conversations: %w", err)
+	}
+
+	var firstErr error
+	for _, s := range states {
+		if s.LastUpdate == nil {
+			// Without an update, we can't tell which conversation this state belongs to.
+			continue
+		}
+		if err := c.endTimedOutBlocking(b, ext.NewContext(s.LastUpdate, nil)); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// StartTimeoutChecker calls CheckTimeouts at every interval in a new goroutine, so that idle conversations are ended,
+// and their TimeoutHandlers run, without waiting for the users' next updates. The checker stops once the context is
+// done. Errors are passed to onError, if set.
+//
+// As with CheckTimeouts, this requires the StateStorage to implement conversation.TimeoutStorage.
+func (c Conversation) StartTimeoutChecker(ctx context.Context, b *gotgbot.Bot, interval time.Duration, onError func(err error)) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := c.CheckTimeouts(b); err != nil && onError != nil {
+					onError(err)
+				}
+			}
+		}
+	}()
+}
+
+// endTimedOutBlocking ends the conversation if it has timed out, waiting for it to be free if it is blocking.
+func (c Conversation) endTimedOutBlocking(b *gotgbot.Bot, ctx *ext.Context) error {
+	if key, ok := c.key(ctx); ok && c.Block {
+		locks := c.lockSet()
+		locks.acquire(key)
+		defer locks.release(key)
+	}
+	return c.endTimedOut(b, ctx)
+}
+
+// literalConversationLocks holds the locks of blocking conversations created as struct literals, keyed by the pointer
+// of their States map; this identifies all copies of the same conversation, as in Name.
+var literalConversationLocks sync.Map
+
+// lockSet returns the per-key locks of blocking conversations.
+func (c Conversation) lockSet() *conversationLocks {
+	if c.locks != nil {
+		return c.locks
+	}
+
+	id := reflect.ValueOf(c.States).Pointer()
+	if l, ok := literalConversationLocks.Load(id); ok {
+		return l.(*conversationLocks)
+	}
+	l, _ := literalConversationLocks.LoadOrStore(id, newConversationLocks())
+	return l.(*conversationLocks)
+}
+
+// matchesAnyState returns true if the update matches the conversation as it currently is, or any of its states; ie,
+// if it could be part of the conversation once a pending state change is done.
+func (c Conversation) matchesAnyState(b *gotgbot.Bot, ctx *ext.Context) bool {
+	if _, h, _, _ := c.getNextHandler(b, ctx); h != nil {
+		return true
+	}
+	for _, stateHandlers := range c.States {
+		if checkHandlerList(stateHandlers, b, ctx) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// key returns the key used to identify the conversation of the current update, or false if it has none.
+func (c Conversation) key(ctx *ext.Context) (string, bool) {
+	if s, ok := c.StateStorage.(conversation.KeyedStorage); ok {
+		return s.Key(ctx)
+	}
+	return conversation.StateKey(ctx, conversation.KeyStrategySenderAndChat)
+}
+
+// handleWaiting runs the first matching waiting handler, for updates which arrive while the conversation is busy.
+func (c Conversation) handleWaiting(b *gotgbot.Bot, ctx *ext.Context) error {
+	next := checkHandlerList(c.WaitingHandlers, b, ctx)
+	if next == nil {
+		return ext.ContinueGroups
+	}
+
+	err := next.HandleUpdate(b, ctx)
+	var stateChange *ConversationStateChange
+	if errors.As(err, &stateChange) {
+		// The conversation is busy, so its state can't be changed.
+		return nil
+	}
+	return err
+}
+
+// handleWithData runs the handler with the given conversation data, which is made available through
+// ConversationData. The data of any parent conversation is restored afterwards.
+func handleWithData(h ext.Handler, b *gotgbot.Bot, ctx *ext.Context, data map[string]string) error {
+	parentData, ok := ctx.Data[conversationDataKey]
+	ctx.Data[conversationDataKey] = data
+	defer func() {
+		if ok {
+			ctx.Data[conversationDataKey] = parentData
+		} else {
+			delete(ctx.Data, conversationDataKey)
+		}
+	}()
+
+	return h.HandleUpdate(b, ctx)
+}
+
+// ConversationData returns the data of the current conversation, which its handlers can read and modify. Changes are
+// stored along with the conversation state, and the data is cleared when the conversation ends.
+// When a nested conversation changes the state of its parent, its data is merged into the parent's data.
+//
+// Returns nil outside of conversation handlers.
+func ConversationData(ctx *ext.Context) map[string]string {
+	data, _ := ctx.Data[conversationDataKey].(map[string]string)
+	return data
+}
+
+// copyData returns a copy of the given conversation data, which is never nil.
+func copyData(data map[string]string) map[string]string {
+	c := make(map[string]string, len(data))
+	for k, v := range data {
+		c[k] = v
+	}
+	return c
+}
+
+// mergeData copies all the values of src into dst.
+func mergeData(dst map[string]string, src map[string]string) {
+	for k, v := range src {
+		dst[k] = v
+	}
 }
 
 // checkHandlerList iterates over a list of handlers until a match is found; at which point it is returned.
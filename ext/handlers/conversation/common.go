@@ -1,22 +1,15 @@
 package conversation
 
 import (
-	"fmt"
-	"strconv"
-
 	"github.com/PaulSonOfLars/gotgbot/v2/ext"
 )
 
-func StateKey(ctx *ext.Context, strategy KeyStrategy) string {
-	switch strategy {
-	case KeyStrategySender:
-		return strconv.FormatInt(ctx.EffectiveSender.Id(), 10)
-	case KeyStrategyChat:
-		return strconv.FormatInt(ctx.EffectiveChat.Id, 10)
-	case KeyStrategySenderAndChat:
-		fallthrough
-	default:
-		// Default to KeyStrategySenderAndChat if unknown strategy
-		return fmt.Sprintf("%d/%d", ctx.EffectiveSender.Id(), ctx.EffectiveChat.Id)
+// StateKey determines the key of the conversation the current update belongs to, using the given strategy.
+// Returns false if the update does not contain the data required by the strategy.
+func StateKey(ctx *ext.Context, strategy KeyStrategy) (string, bool) {
+	if strategy == nil {
+		// Default to KeyStrategySenderAndChat if no strategy is set.
+		strategy = KeyStrategySenderAndChat
 	}
+	return strategy(ctx)
 }
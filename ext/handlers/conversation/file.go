@@ -0,0 +1,385 @@
+package conversation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+)
+
+var (
+	_ TimeoutStorage   = &FileStorage{}
+	_ KeyedStorage     = &FileStorage{}
+	_ VersionedStorage = &FileStorage{}
+)
+
+// fileStorageVersion is the version of the file format written by FileStorage.
+const fileStorageVersion = 1
+
+// FileStorage is a thread-safe implementation of the Storage interface, which persists all conversations to a JSON
+// file so that they survive restarts.
+//
+// It is also intended as a reference for other persistent backends. Like FileStorage, these should:
+//   - store the entire State struct (eg as JSON), keyed by StateKey;
+//   - return KeyNotFound for unknown or expired keys;
+//   - record when each state was last set, to expire stale conversations.
+//
+// In a Redis backend, for example, this maps to GET, SET with an expiry, and DEL on the conversation key.
+type FileStorage struct {
+	// keyStrategy defines how to calculate keys for each conversation.
+	keyStrategy KeyStrategy
+	// path is the file the conversations are stored in.
+	path string
+	// ttl is the duration after which conversations which haven't been updated are removed. Zero means never.
+	ttl time.Duration
+
+	// conversations is a map of key -> state, which tracks at which point of each conversation a user/chat is.
+	conversations map[string]fileState
+	// dirty is true if conversations has changed since the last flush.
+	dirty bool
+	// lock allows us to ensure synchronous data access.
+	lock sync.RWMutex
+	// writeLock ensures that the file is only written by one flush at a time.
+	writeLock sync.Mutex
+
+	// stop stops the periodic flushes, if any.
+	stop chan struct{}
+	// stopped is closed once the periodic flushes have stopped.
+	stopped chan struct{}
+}
+
+// FileStorageOpts represents the optional fields of a FileStorage.
+type FileStorageOpts struct {
+	// TTL is the duration after which conversations which haven't been updated are removed, so that abandoned
+	// conversations don't accumulate. Zero means that conversations are kept until they end.
+	TTL time.Duration
+	// FlushInterval is the interval at which changes are written to the file. Zero means that the file is written on
+	// every change, which is safest, but slow for busy bots. Changes made since the last flush are lost on crashes;
+	// Close should be called on shutdown to write them.
+	FlushInterval time.Duration
+}
+
+// fileStorageContents is the contents of the FileStorage file.
+type fileStorageContents struct {
+	Version       int                  `json:"version"`
+	Conversations map[string]fileState `json:"conversations"`
+}
+
+// fileState is a conversation state, as stored by FileStorage.
+type fileState struct {
+	State     State     `json:"state"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// NewFileStorage creates a FileStorage which stores conversations in the given file, loading any conversations it
+// already contains. The file is created on the first change if it doesn't exist.
+func NewFileStorage(path string, strategy KeyStrategy, opts *FileStorageOpts) (*FileStorage, error) {
+	s := &FileStorage{
+		keyStrategy:   strategy,
+		path:          path,
+		conversations: map[string]fileState{},
+	}
+
+	var flushInterval time.Duration
+	if opts != nil {
+		s.ttl = opts.TTL
+		flushInterval = opts.FlushInterval
+	}
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+
+	if flushInterval > 0 {
+		s.stop = make(chan struct{})
+		s.stopped = make(chan struct{})
+		go s.flushPeriodically(flushInterval)
+	}
+
+	return s, nil
+}
+
+func (s *FileStorage) Key(ctx *ext.Context) (string, bool) {
+	return StateKey(ctx, s.keyStrategy)
+}
+
+func (s *FileStorage) Get(ctx *ext.Context) (*State, error) {
+	key, ok := StateKey(ctx, s.keyStrategy)
+	if !ok {
+		return nil, ErrNoKey
+	}
+
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	fs, ok := s.conversations[key]
+	if !ok || s.expired(fs, time.Now()) {
+		return nil, KeyNotFound
+	}
+	return &fs.State, nil
+}
+
+func (s *FileStorage) Set(ctx *ext.Context, state State) error {
+	key, ok := StateKey(ctx, s.keyStrategy)
+	if !ok {
+		return ErrNoKey
+	}
+
+	newVersion, err := NextVersion()
+	if err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	s.set(key, state, newVersion)
+	s.lock.Unlock()
+
+	return s.flushOnChange()
+}
+
+func (s *FileStorage) CompareAndSet(ctx *ext.Context, version uint64, state State) error {
+	key, ok := StateKey(ctx, s.keyStrategy)
+	if !ok {
+		return ErrNoKey
+	}
+
+	newVersion, err := NextVersion()
+	if err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	if err := s.checkVersion(key, version); err != nil {
+		s.lock.Unlock()
+		return err
+	}
+	s.set(key, state, newVersion)
+	s.lock.Unlock()
+
+	return s.flushOnChange()
+}
+
+func (s *FileStorage) CompareAndDelete(ctx *ext.Context, version uint64) error {
+	key, ok := StateKey(ctx, s.keyStrategy)
+	if !ok {
+		return ErrNoKey
+	}
+
+	s.lock.Lock()
+	if err := s.checkVersion(key, version); err != nil {
+		s.lock.Unlock()
+		return err
+	}
+	changed := s.delete(key)
+	s.lock.Unlock()
+
+	if !changed {
+		return nil
+	}
+	return s.flushOnChange()
+}
+
+func (s *FileStorage) Delete(ctx *ext.Context) error {
+	key, ok := StateKey(ctx, s.keyStrategy)
+	if !ok {
+		return ErrNoKey
+	}
+
+	s.lock.Lock()
+	changed := s.delete(key)
+	s.lock.Unlock()
+
+	if !changed {
+		return nil
+	}
+	return s.flushOnChange()
+}
+
+func (s *FileStorage) TimedOut(now time.Time) ([]State, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	var states []State
+	for _, fs := range s.conversations {
+		if fs.State.TimedOut(now) && !s.expired(fs, now) {
+			states = append(states, fs.State)
+		}
+	}
+	return states, nil
+}
+
+// Flush removes expired conversations, and writes all changes to the file.
+func (s *FileStorage) Flush() error {
+	// Hold the write lock first, so that concurrent flushes write their snapshots in order.
+	s.writeLock.Lock()
+	defer s.writeLock.Unlock()
+
+	s.lock.Lock()
+	s.removeExpired(time.Now())
+	if !s.dirty {
+		s.lock.Unlock()
+		return nil
+	}
+	data, err := json.Marshal(fileStorageContents{
+		Version:       fileStorageVersion,
+		Conversations: s.conversations,
+	})
+	s.dirty = false
+	s.lock.Unlock()
+
+	if err != nil {
+		s.markDirty()
+		return fmt.Errorf("failed to encode conversations: %w", err)
+	}
+
+	if err := writeFileAtomic(s.path, data); err != nil {
+		s.markDirty()
+		return fmt.Errorf("failed to write conversations: %w", err)
+	}
+	return nil
+}
+
+// Close stops the periodic flushes, and writes any pending changes to the file.
+func (s *FileStorage) Close() error {
+	if s.stop != nil {
+		select {
+		case <-s.stop:
+			// Already closed.
+		default:
+			close(s.stop)
+		}
+		<-s.stopped
+	}
+	return s.Flush()
+}
+
+// load reads the conversations from the file, if it exists.
+func (s *FileStorage) load() error {
+	data, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("failed to read conversations: %w", err)
+	}
+
+	var contents fileStorageContents
+	if err := json.Unmarshal(data, &contents); err != nil {
+		return fmt.Errorf("failed to decode conversations from %s: %w", s.path, err)
+	}
+	if contents.Version != fileStorageVersion {
+		return fmt.Errorf("unsupported conversation file version %d in %s", contents.Version, s.path)
+	}
+
+	if contents.Conversations != nil {
+		s.conversations = contents.Conversations
+	}
+	return nil
+}
+
+// flushOnChange writes the changes to the file, unless they are flushed periodically.
+func (s *FileStorage) flushOnChange() error {
+	if s.stop != nil {
+		return nil
+	}
+	return s.Flush()
+}
+
+// flushPeriodically flushes the changes at every interval, until the storage is closed. Errors are retried at the
+// next interval.
+func (s *FileStorage) flushPeriodically(interval time.Duration) {
+	defer close(s.stopped)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			_ = s.Flush()
+		}
+	}
+}
+
+// markDirty marks the conversations as changed, so the next flush writes them.
+func (s *FileStorage) markDirty() {
+	s.lock.Lock()
+	s.dirty = true
+	s.lock.Unlock()
+}
+
+// set stores the state with the given new version. The lock must be held.
+func (s *FileStorage) set(key string, state State, version uint64) {
+	state.Version = version
+	s.conversations[key] = fileState{State: state, UpdatedAt: time.Now()}
+	s.dirty = true
+}
+
+// delete removes the conversation. Returns false if it didn't exist. The lock must be held.
+func (s *FileStorage) delete(key string) bool {
+	if _, ok := s.conversations[key]; !ok {
+		return false
+	}
+	delete(s.conversations, key)
+	s.dirty = true
+	return true
+}
+
+// checkVersion returns a ConflictError if the stored state doesn't have the given version. Expired conversations
+// don't exist, so have a version of 0. The lock must be held.
+func (s *FileStorage) checkVersion(key string, version uint64) error {
+	var actual uint64
+	if fs, ok := s.conversations[key]; ok && !s.expired(fs, time.Now()) {
+		actual = fs.State.Version
+	}
+	if actual != version {
+		return &ConflictError{Key: key, Expected: version, Actual: actual}
+	}
+	return nil
+}
+
+// expired returns true if the conversation hasn't been updated within the TTL.
+func (s *FileStorage) expired(fs fileState, now time.Time) bool {
+	return s.ttl > 0 && now.Sub(fs.UpdatedAt) >= s.ttl
+}
+
+// removeExpired removes all the conversations which haven't been updated within the TTL. The lock must be held.
+func (s *FileStorage) removeExpired(now time.Time) {
+	for key, fs := range s.conversations {
+		if s.expired(fs, now) {
+			delete(s.conversations, key)
+			s.dirty = true
+		}
+	}
+}
+
+// writeFileAtomic writes the data to a temporary file, and renames it to the given path, so that the file is never
+// left partially written.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // Fails once renamed; this is only for cleanup on errors.
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,157 @@
+package conversation
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+)
+
+func newMessage(userId int64, chatId int64) *ext.Context {
+	return ext.NewContext(&gotgbot.Update{
+		UpdateId: userId,
+		Message: &gotgbot.Message{
+			From: &gotgbot.User{Id: userId, FirstName: "user"},
+			Chat: gotgbot.Chat{Id: chatId, Type: "supergroup"},
+			Text: "message",
+		},
+	}, nil)
+}
+
+func TestFileStorage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "conversations.json")
+	s, err := NewFileStorage(path, KeyStrategySenderAndChat, nil)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+
+	ctx := newMessage(1, 10)
+	if _, err := s.Get(ctx); !errors.Is(err, KeyNotFound) {
+		t.Fatalf("expected KeyNotFound, got %v", err)
+	}
+
+	expiry := time.Now().Add(time.Hour).Round(0)
+	state := State{Key: "step", Data: map[string]string{"name": "John"}, Expiry: expiry, LastUpdate: ctx.Update}
+	if err := s.Set(ctx, state); err != nil {
+		t.Fatalf("failed to set state: %v", err)
+	}
+	if err := s.Set(newMessage(2, 10), State{Key: "other"}); err != nil {
+		t.Fatalf("failed to set state: %v", err)
+	}
+	if err := s.Delete(newMessage(2, 10)); err != nil {
+		t.Fatalf("failed to delete state: %v", err)
+	}
+
+	// Conversations survive restarts.
+	s, err = NewFileStorage(path, KeyStrategySenderAndChat, nil)
+	if err != nil {
+		t.Fatalf("failed to reopen storage: %v", err)
+	}
+	got, err := s.Get(ctx)
+	if err != nil {
+		t.Fatalf("failed to get state: %v", err)
+	}
+	if got.Key != "step" || got.Data["name"] != "John" || !got.Expiry.Equal(expiry) {
+		t.Errorf("unexpected state after restart: %+v", got)
+	}
+	if got.LastUpdate == nil || got.LastUpdate.Message == nil || got.LastUpdate.Message.From.Id != 1 {
+		t.Errorf("expected the last update to be stored, got %+v", got.LastUpdate)
+	}
+	if _, err := s.Get(newMessage(2, 10)); !errors.Is(err, KeyNotFound) {
+		t.Errorf("expected deleted state to stay deleted, got %v", err)
+	}
+}
+
+func TestFileStorage_ttl(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "conversations.json")
+	s, err := NewFileStorage(path, KeyStrategySenderAndChat, &FileStorageOpts{TTL: time.Hour})
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+
+	stale, fresh := newMessage(1, 10), newMessage(2, 10)
+	for _, ctx := range []*ext.Context{stale, fresh} {
+		if err := s.Set(ctx, State{Key: "step", Expiry: time.Now().Add(-time.Minute), LastUpdate: ctx.Update}); err != nil {
+			t.Fatalf("failed to set state: %v", err)
+		}
+	}
+	staleKey, _ := s.Key(stale)
+	s.lock.Lock()
+	fs := s.conversations[staleKey]
+	fs.UpdatedAt = time.Now().Add(-2 * time.Hour)
+	s.conversations[staleKey] = fs
+	s.lock.Unlock()
+
+	if _, err := s.Get(stale); !errors.Is(err, KeyNotFound) {
+		t.Errorf("expected stale conversation to be expired, got %v", err)
+	}
+	if _, err := s.Get(fresh); err != nil {
+		t.Errorf("expected fresh conversation to be kept, got %v", err)
+	}
+	if states, _ := s.TimedOut(time.Now()); len(states) != 1 {
+		t.Errorf("expected only the fresh conversation to time out, got %+v", states)
+	}
+
+	if err := s.Flush(); err != nil {
+		t.Fatalf("failed to flush: %v", err)
+	}
+	if _, ok := s.conversations[staleKey]; ok {
+		t.Errorf("expected stale conversation to be removed on flush")
+	}
+}
+
+func TestFileStorage_flushInterval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "conversations.json")
+	s, err := NewFileStorage(path, KeyStrategySenderAndChat, &FileStorageOpts{FlushInterval: time.Hour})
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+
+	// Concurrent access is safe.
+	var wg sync.WaitGroup
+	for i := int64(0); i < 20; i++ {
+		wg.Add(1)
+		go func(i int64) {
+			defer wg.Done()
+			ctx := newMessage(i, 10)
+			if err := s.Set(ctx, State{Key: fmt.Sprintf("step%d", i)}); err != nil {
+				t.Errorf("failed to set state: %v", err)
+			}
+			if _, err := s.Get(ctx); err != nil {
+				t.Errorf("failed to get state: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if _, err := ioutil.ReadFile(path); err == nil {
+		t.Fatalf("expected changes not to be written before the flush interval")
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatalf("failed to close storage: %v", err)
+	}
+	s, err = NewFileStorage(path, KeyStrategySenderAndChat, nil)
+	if err != nil {
+		t.Fatalf("failed to reopen storage: %v", err)
+	}
+	if got, err := s.Get(newMessage(7, 10)); err != nil || got.Key != "step7" {
+		t.Errorf("expected changes to be written on close, got %+v (%v)", got, err)
+	}
+}
+
+func TestNewFileStorage_invalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "conversations.json")
+	if err := ioutil.WriteFile(path, []byte("{"), 0o600); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	if _, err := NewFileStorage(path, KeyStrategySenderAndChat, nil); err == nil {
+		t.Errorf("expected an error for a corrupted file")
+	}
+}
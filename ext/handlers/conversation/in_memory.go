@@ -3,12 +3,23 @@ package conversation
 import (
 	"errors"
 	"sync"
+	"time"
 
 	"github.com/PaulSonOfLars/gotgbot/v2/ext"
 )
 
 var KeyNotFound = errors.New("conversation key not found")
 
+// ErrNoKey is returned when the key strategy can't determine a conversation key for an update (eg, inline queries
+// have no chat); such updates can't be part of a conversation.
+var ErrNoKey = errors.New("update has no conversation key")
+
+var (
+	_ TimeoutStorage   = &InMemoryStorage{}
+	_ KeyedStorage     = &InMemoryStorage{}
+	_ VersionedStorage = &InMemoryStorage{}
+)
+
 // InMemoryStorage is a thread-safe in-memory implementation of the Storage interface.
 type InMemoryStorage struct {
 	// keyStrategy defines how to calculate keys for each conversation.
@@ -27,8 +38,15 @@ func NewInMemoryStorage(strategy KeyStrategy) *InMemoryStorage {
 	}
 }
 
+func (c *InMemoryStorage) Key(ctx *ext.Context) (string, bool) {
+	return StateKey(ctx, c.keyStrategy)
+}
+
 func (c *InMemoryStorage) Get(ctx *ext.Context) (*State, error) {
-	key := StateKey(ctx, c.keyStrategy)
+	key, ok := StateKey(ctx, c.keyStrategy)
+	if !ok {
+		return nil, ErrNoKey
+	}
 
 	c.lock.RLock()
 	defer c.lock.RUnlock()
@@ -45,7 +63,15 @@ func (c *InMemoryStorage) Get(ctx *ext.Context) (*State, error) {
 }
 
 func (c *InMemoryStorage) Set(ctx *ext.Context, state State) error {
-	key := StateKey(ctx, c.keyStrategy)
+	key, ok := StateKey(ctx, c.keyStrategy)
+	if !ok {
+		return ErrNoKey
+	}
+
+	newVersion, err := NextVersion()
+	if err != nil {
+		return err
+	}
 
 	c.lock.Lock()
 	defer c.lock.Unlock()
@@ -54,12 +80,60 @@ func (c *InMemoryStorage) Set(ctx *ext.Context, state State) error {
 		c.conversations = map[string]State{}
 	}
 
+	state.Version = newVersion
 	c.conversations[key] = state
 	return nil
 }
 
+func (c *InMemoryStorage) CompareAndSet(ctx *ext.Context, version uint64, state State) error {
+	key, ok := StateKey(ctx, c.keyStrategy)
+	if !ok {
+		return ErrNoKey
+	}
+
+	newVersion, err := NextVersion()
+	if err != nil {
+		return err
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if actual := c.conversations[key].Version; actual != version {
+		return &ConflictError{Key: key, Expected: version, Actual: actual}
+	}
+
+	if c.conversations == nil {
+		c.conversations = map[string]State{}
+	}
+
+	state.Version = newVersion
+	c.conversations[key] = state
+	return nil
+}
+
+func (c *InMemoryStorage) CompareAndDelete(ctx *ext.Context, version uint64) error {
+	key, ok := StateKey(ctx, c.keyStrategy)
+	if !ok {
+		return ErrNoKey
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if actual := c.conversations[key].Version; actual != version {
+		return &ConflictError{Key: key, Expected: version, Actual: actual}
+	}
+
+	delete(c.conversations, key)
+	return nil
+}
+
 func (c *InMemoryStorage) Delete(ctx *ext.Context) error {
-	key := StateKey(ctx, c.keyStrategy)
+	key, ok := StateKey(ctx, c.keyStrategy)
+	if !ok {
+		return ErrNoKey
+	}
 
 	c.lock.Lock()
 	defer c.lock.Unlock()
@@ -71,3 +145,16 @@ func (c *InMemoryStorage) Delete(ctx *ext.Context) error {
 	delete(c.conversations, key)
 	return nil
 }
+
+func (c *InMemoryStorage) TimedOut(now time.Time) ([]State, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	var states []State
+	for _, s := range c.conversations {
+		if s.TimedOut(now) {
+			states = append(states, s)
+		}
+	}
+	return states, nil
+}
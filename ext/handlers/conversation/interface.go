@@ -1,6 +1,9 @@
 package conversation
 
 import (
+	"fmt"
+	"time"
+
 	"github.com/PaulSonOfLars/gotgbot/v2/ext"
 )
 
@@ -12,7 +15,7 @@ type Storage interface {
 	// Note that this is checked at each incoming message, so may be a bottleneck for some implementations.
 	//
 	// If the key is not found (and as such, this conversation has not yet started), this method should return the
-	// ConversationKeyNotFound error.
+	// KeyNotFound error. If the update has no key, it should return the ErrNoKey error.
 	// Get(key string) (*State, error)
 	Get(ctx *ext.Context) (*State, error)
 
@@ -22,3 +25,59 @@ type Storage interface {
 	// Delete ends the conversation, removing the key from the storage.
 	Delete(ctx *ext.Context) error
 }
+
+// TimeoutStorage is an optional extension of the Storage interface, which allows for finding all the conversations
+// which have timed out, so they can be ended without waiting for the user's next update.
+// Storage implementations which don't implement it only have their timeouts checked when the next update for that
+// conversation arrives.
+type TimeoutStorage interface {
+	Storage
+	// TimedOut returns the states of all the conversations which have timed out at the given time.
+	TimedOut(now time.Time) ([]State, error)
+}
+
+// KeyedStorage is an optional extension of the Storage interface, which exposes the key used to store the state of
+// each conversation. This allows for blocking conversations to use the same keys as their storage.
+type KeyedStorage interface {
+	Storage
+	// Key returns the conversation key of the given update, or false if the update has no key.
+	Key(ctx *ext.Context) (string, bool)
+}
+
+// VersionedStorage is an optional extension of the Storage interface, for storages which can atomically check that a
+// conversation hasn't changed before updating it. When several bot replicas share a storage, this ensures that two
+// updates can't both advance the same state; the losing update fails with a ConflictError.
+//
+// Implementations must guarantee that:
+//   - Get returns the stored State.Version.
+//   - Every change stores a new, non-zero version, which is unique across all the processes sharing the storage;
+//     versions from NextVersion are. Versions are only compared for equality, so they don't need to increase.
+//   - The version check and the change are atomic across all processes sharing the storage; eg, a database
+//     transaction or a conditional write, rather than a process-local lock.
+type VersionedStorage interface {
+	Storage
+	// CompareAndSet updates the conversation state, only if the stored state has the given version. A version of 0
+	// means that the conversation must not exist. Returns a ConflictError otherwise.
+	CompareAndSet(ctx *ext.Context, version uint64, state State) error
+	// CompareAndDelete ends the conversation, only if the stored state has the given version. A version of 0 means
+	// that the conversation must not exist. Returns a ConflictError otherwise.
+	CompareAndDelete(ctx *ext.Context, version uint64) error
+}
+
+// ConflictError is returned by VersionedStorage implementations when a conversation was changed concurrently, eg by
+// another replica handling an update for the same conversation.
+//
+// The update which caused it can be retried, for example from the dispatcher's error handler; note that the handler
+// which was run may have already had side effects.
+type ConflictError struct {
+	// Key is the conversation key.
+	Key string
+	// Expected is the version the state was expected to have.
+	Expected uint64
+	// Actual is the version of the stored state, or 0 if the conversation doesn't exist.
+	Actual uint64
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("conversation %s was changed concurrently: expected version %d, got %d", e.Key, e.Expected, e.Actual)
+}
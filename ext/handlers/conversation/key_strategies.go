@@ -1,13 +1,100 @@
 package conversation
 
-type KeyStrategy int64
-
-// Note: If you add a new keystrategy here, make sure to add it to the getStateKey method!
-const (
-	// KeyStrategySenderAndChat ensures that each sender get a unique conversation in each chats.
-	KeyStrategySenderAndChat KeyStrategy = iota
-	// KeyStrategySender gives a unique conversation to each sender, but that conversation is available in all chats.
-	KeyStrategySender
-	// KeyStrategyChat gives a unique conversation to each chat, which all senders can interact in together.
-	KeyStrategyChat
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
 )
+
+// KeyStrategy determines the key of the conversation an update belongs to; updates with the same key share a single
+// conversation. Returns false if the update doesn't contain the data required by the strategy (eg, inline queries have
+// no chat), in which case the update can't be part of a conversation.
+//
+// Custom strategies can be used by any function with this signature. A nil KeyStrategy defaults to
+// KeyStrategySenderAndChat.
+type KeyStrategy func(ctx *ext.Context) (string, bool)
+
+// KeyStrategySenderAndChat ensures that each sender get a unique conversation in each chats.
+func KeyStrategySenderAndChat(ctx *ext.Context) (string, bool) {
+	if ctx.EffectiveSender == nil || ctx.EffectiveChat == nil {
+		return "", false
+	}
+	return fmt.Sprintf("%d/%d", ctx.EffectiveSender.Id(), ctx.EffectiveChat.Id), true
+}
+
+// KeyStrategySender gives a unique conversation to each sender, but that conversation is available in all chats.
+func KeyStrategySender(ctx *ext.Context) (string, bool) {
+	if ctx.EffectiveSender == nil {
+		return "", false
+	}
+	return strconv.FormatInt(ctx.EffectiveSender.Id(), 10), true
+}
+
+// KeyStrategyUser gives a unique conversation to each user, which follows them across all chats, as well as inline
+// queries and the buttons of inline messages. Unlike KeyStrategySender, updates sent on behalf of chats (eg, by
+// channels or anonymous admins) aren't part of any conversation.
+func KeyStrategyUser(ctx *ext.Context) (string, bool) {
+	if ctx.EffectiveUser == nil || (ctx.EffectiveSender != nil && !ctx.EffectiveSender.IsUser()) {
+		return "", false
+	}
+	return strconv.FormatInt(ctx.EffectiveUser.Id, 10), true
+}
+
+// KeyStrategyChat gives a unique conversation to each chat, which all senders can interact in together.
+func KeyStrategyChat(ctx *ext.Context) (string, bool) {
+	if ctx.EffectiveChat == nil {
+		return "", false
+	}
+	return strconv.FormatInt(ctx.EffectiveChat.Id, 10), true
+}
+
+// KeyStrategySenderAndChatAndThread ensures that each sender gets a unique conversation in each forum topic of
+// each chat. Outside of forum topics, this behaves like KeyStrategySenderAndChat.
+func KeyStrategySenderAndChatAndThread(ctx *ext.Context) (string, bool) {
+	if ctx.EffectiveSender == nil || ctx.EffectiveChat == nil {
+		return "", false
+	}
+	return fmt.Sprintf("%d/%d/%d", ctx.EffectiveSender.Id(), ctx.EffectiveChat.Id, ctx.EffectiveThreadId), true
+}
+
+// KeyStrategyChatAndThread gives a unique conversation to each forum topic, which all senders can interact in
+// together. Outside of forum topics, this behaves like KeyStrategyChat.
+func KeyStrategyChatAndThread(ctx *ext.Context) (string, bool) {
+	if ctx.EffectiveChat == nil {
+		return "", false
+	}
+	return fmt.Sprintf("%d/%d", ctx.EffectiveChat.Id, ctx.EffectiveThreadId), true
+}
+
+// KeyStrategyInlineMessage gives a unique conversation to each message sent via inline mode, which is shared by
+// everyone who presses its buttons. Only applies to callback queries and chosen inline results of inline messages.
+func KeyStrategyInlineMessage(ctx *ext.Context) (string, bool) {
+	var inlineMessageId string
+	switch {
+	case ctx.CallbackQuery != nil:
+		inlineMessageId = ctx.CallbackQuery.InlineMessageId
+	case ctx.ChosenInlineResult != nil:
+		inlineMessageId = ctx.ChosenInlineResult.InlineMessageId
+	}
+	if inlineMessageId == "" {
+		return "", false
+	}
+	return "inline/" + inlineMessageId, true
+}
+
+// KeyStrategyCallbackMessage gives a unique conversation to each message with buttons, so that several independent
+// menus can be open at once, even in the same chat. Only applies to callback queries.
+func KeyStrategyCallbackMessage(ctx *ext.Context) (string, bool) {
+	cq := ctx.CallbackQuery
+	if cq == nil {
+		return "", false
+	}
+	if cq.InlineMessageId != "" {
+		return "inline/" + cq.InlineMessageId, true
+	}
+	if cq.Message == nil {
+		return "", false
+	}
+	return fmt.Sprintf("message/%d/%d", cq.Message.Chat.Id, cq.Message.MessageId), true
+}
@@ -0,0 +1,114 @@
+package conversation
+
+import (
+	"testing"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+)
+
+func TestKeyStrategies(t *testing.T) {
+	user := gotgbot.User{Id: 1, FirstName: "user"}
+	chat := gotgbot.Chat{Id: 10, Type: "supergroup", IsForum: true}
+
+	updates := map[string]*gotgbot.Update{
+		"message": {Message: &gotgbot.Message{From: &user, Chat: chat, Text: "text"}},
+		"topic message": {Message: &gotgbot.Message{
+			From:            &user,
+			Chat:            chat,
+			MessageThreadId: 5,
+			IsTopicMessage:  true,
+			Text:            "text",
+		}},
+		"channel message": {Message: &gotgbot.Message{
+			SenderChat: &gotgbot.Chat{Id: 20, Type: "channel"},
+			Chat:       chat,
+			Text:       "text",
+		}},
+		"callback query": {CallbackQuery: &gotgbot.CallbackQuery{
+			From:    user,
+			Message: &gotgbot.Message{MessageId: 100, Chat: chat},
+		}},
+		"inline callback query": {CallbackQuery: &gotgbot.CallbackQuery{From: user, InlineMessageId: "abc"}},
+		"inline query":          {InlineQuery: &gotgbot.InlineQuery{From: user, Query: "query"}},
+		"poll":                  {Poll: &gotgbot.Poll{Id: "poll"}},
+	}
+
+	// expected maps update names to their keys; an empty key means that the update has none.
+	for name, test := range map[string]struct {
+		strategy KeyStrategy
+		expected map[string]string
+	}{
+		"default": {
+			strategy: nil,
+			expected: map[string]string{"message": "1/10", "callback query": "1/10", "inline query": "", "poll": ""},
+		},
+		"sender": {
+			strategy: KeyStrategySender,
+			expected: map[string]string{"message": "1", "channel message": "20", "inline query": "1", "poll": ""},
+		},
+		"user": {
+			strategy: KeyStrategyUser,
+			expected: map[string]string{"message": "1", "inline query": "1", "inline callback query": "1", "channel message": "", "poll": ""},
+		},
+		"chat": {
+			strategy: KeyStrategyChat,
+			expected: map[string]string{"message": "10", "channel message": "10", "callback query": "10", "inline query": "", "poll": ""},
+		},
+		"sender and chat and thread": {
+			strategy: KeyStrategySenderAndChatAndThread,
+			expected: map[string]string{"message": "1/10/0", "topic message": "1/10/5", "inline query": "", "poll": ""},
+		},
+		"chat and thread": {
+			strategy: KeyStrategyChatAndThread,
+			expected: map[string]string{"message": "10/0", "topic message": "10/5", "channel message": "10/0", "inline query": "", "poll": ""},
+		},
+		"inline message": {
+			strategy: KeyStrategyInlineMessage,
+			expected: map[string]string{"inline callback query": "inline/abc", "callback query": "", "message": "", "poll": ""},
+		},
+		"callback message": {
+			strategy: KeyStrategyCallbackMessage,
+			expected: map[string]string{
+				"callback query":        "message/10/100",
+				"inline callback query": "inline/abc",
+				"message":               "",
+				"inline query":          "",
+				"poll":                  "",
+			},
+		},
+		"custom": {
+			strategy: func(ctx *ext.Context) (string, bool) {
+				if ctx.InlineQuery == nil {
+					return "", false
+				}
+				return "query/" + ctx.InlineQuery.Query, true
+			},
+			expected: map[string]string{"inline query": "query/query", "message": ""},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			for updateName, expected := range test.expected {
+				key, ok := StateKey(ext.NewContext(updates[updateName], nil), test.strategy)
+				if ok != (expected != "") || key != expected {
+					t.Errorf("%s: expected key %q, got %q (%v)", updateName, expected, key, ok)
+				}
+			}
+		})
+	}
+}
+
+func TestStorage_noKey(t *testing.T) {
+	ctx := ext.NewContext(&gotgbot.Update{Poll: &gotgbot.Poll{Id: "poll"}}, nil)
+	s := NewInMemoryStorage(KeyStrategySenderAndChat)
+
+	if _, err := s.Get(ctx); err != ErrNoKey {
+		t.Errorf("expected ErrNoKey from Get, got %v", err)
+	}
+	if err := s.Set(ctx, State{Key: "step"}); err != ErrNoKey {
+		t.Errorf("expected ErrNoKey from Set, got %v", err)
+	}
+	if err := s.Delete(ctx); err != ErrNoKey {
+		t.Errorf("expected ErrNoKey from Delete, got %v", err)
+	}
+}
@@ -1,5 +1,14 @@
 package conversation
 
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+)
+
 // State stores all the variables relevant to the current conversation state.
 //
 // Note: More keys may be added in the future to support additional features.
@@ -8,4 +17,36 @@ package conversation
 type State struct {
 	// Key represents the name of the current state, as defined in the States map of handlers.Conversation.
 	Key string
+	// Data holds the values collected over the course of the conversation, such as the user's previous answers.
+	// It is available to handlers through handlers.ConversationData, and is cleared when the conversation ends.
+	Data map[string]string
+	// Expiry is the time at which the conversation times out. The zero value means the conversation never times out.
+	Expiry time.Time
+	// LastUpdate is the last update handled by the conversation. It is only stored for conversations with a timeout,
+	// so that the timeout handlers can be run with the last known context.
+	LastUpdate *gotgbot.Update
+	// Version identifies the stored revision of the state; it is set by the storage on every change, and is used by
+	// VersionedStorage implementations to detect concurrent changes. It should not be modified.
+	Version uint64
+}
+
+// NextVersion returns a new random, non-zero state version. Storage implementations can use it to set State.Version.
+// Versions are random rather than sequential, so that several processes sharing a storage never generate the same
+// version, and a conversation which is ended and restarted can't be mistaken for the original one.
+func NextVersion() (uint64, error) {
+	bs := make([]byte, 8)
+	for {
+		if _, err := rand.Read(bs); err != nil {
+			return 0, fmt.Errorf("failed to generate state version: %w", err)
+		}
+		// 0 is reserved for conversations which don't exist.
+		if v := binary.BigEndian.Uint64(bs); v != 0 {
+			return v, nil
+		}
+	}
+}
+
+// TimedOut returns true if the conversation has timed out at the given time.
+func (s State) TimedOut(now time.Time) bool {
+	return !s.Expiry.IsZero() && !now.Before(s.Expiry)
 }
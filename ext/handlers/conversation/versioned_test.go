@@ -0,0 +1,63 @@
+package conversation
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestVersionedStorage(t *testing.T) {
+	fileStorage, err := NewFileStorage(filepath.Join(t.TempDir(), "conversations.json"), KeyStrategySenderAndChat, nil)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+
+	for name, s := range map[string]VersionedStorage{
+		"in memory": NewInMemoryStorage(KeyStrategySenderAndChat),
+		"file":      fileStorage,
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx := newMessage(1, 10)
+
+			var conflict *ConflictError
+			if err := s.CompareAndSet(ctx, 1, State{Key: "step"}); !errors.As(err, &conflict) {
+				t.Fatalf("expected a conflict for a missing conversation, got %v", err)
+			}
+			if err := s.CompareAndSet(ctx, 0, State{Key: "step"}); err != nil {
+				t.Fatalf("failed to start conversation: %v", err)
+			}
+			first, err := s.Get(ctx)
+			if err != nil || first.Version == 0 {
+				t.Fatalf("expected a versioned state, got %+v (%v)", first, err)
+			}
+
+			// Starting the conversation again conflicts, as it already exists.
+			if err := s.CompareAndSet(ctx, 0, State{Key: "other"}); !errors.As(err, &conflict) || conflict.Actual != first.Version {
+				t.Fatalf("expected a conflict with the stored version, got %v", err)
+			}
+
+			if err := s.CompareAndSet(ctx, first.Version, State{Key: "next"}); err != nil {
+				t.Fatalf("failed to update conversation: %v", err)
+			}
+			second, err := s.Get(ctx)
+			if err != nil || second.Key != "next" || second.Version == first.Version {
+				t.Fatalf("expected the version to change, got %+v (%v)", second, err)
+			}
+
+			// Stale versions can't update or delete the conversation.
+			if err := s.CompareAndSet(ctx, first.Version, State{Key: "stale"}); !errors.As(err, &conflict) {
+				t.Fatalf("expected a conflict for a stale version, got %v", err)
+			}
+			if err := s.CompareAndDelete(ctx, first.Version); !errors.As(err, &conflict) {
+				t.Fatalf("expected a conflict for a stale version, got %v", err)
+			}
+
+			if err := s.CompareAndDelete(ctx, second.Version); err != nil {
+				t.Fatalf("failed to end conversation: %v", err)
+			}
+			if _, err := s.Get(ctx); !errors.Is(err, KeyNotFound) {
+				t.Fatalf("expected the conversation to have ended, got %v", err)
+			}
+		})
+	}
+}
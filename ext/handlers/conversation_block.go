@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"sync"
+)
+
+// conversationLocks allows for processing a single update at a time for each conversation key. Waiting updates are
+// processed in the order they arrived.
+type conversationLocks struct {
+	// lock protects the keys map.
+	lock sync.Mutex
+	// keys maps conversation keys to their lock.
+	keys map[string]*keyLock
+}
+
+// keyLock is the lock of a single conversation key.
+type keyLock struct {
+	// sem is a semaphore of size 1; it is held while an update is being processed.
+	sem chan struct{}
+	// refs is the number of updates holding or waiting for the lock, so it can be removed once unused.
+	refs int
+}
+
+func newConversationLocks() *conversationLocks {
+	return &conversationLocks{keys: map[string]*keyLock{}}
+}
+
+// acquire locks the given key, waiting for it to be released if it is currently held.
+func (l *conversationLocks) acquire(key string) {
+	k := l.ref(key)
+	k.sem <- struct{}{}
+}
+
+// tryAcquire locks the given key if it isn't currently held. Returns true if the lock was acquired.
+func (l *conversationLocks) tryAcquire(key string) bool {
+	k := l.ref(key)
+	select {
+	case k.sem <- struct{}{}:
+		return true
+	default:
+		l.unref(key, k)
+		return false
+	}
+}
+
+// release unlocks the given key, which must be held.
+func (l *conversationLocks) release(key string) {
+	l.lock.Lock()
+	k := l.keys[key]
+	l.lock.Unlock()
+
+	<-k.sem
+	l.unref(key, k)
+}
+
+// busy returns true if an update is currently being processed for the given key.
+func (l *conversationLocks) busy(key string) bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	k, ok := l.keys[key]
+	return ok && len(k.sem) > 0
+}
+
+// ref returns the lock for the given key, creating it if needed, and marks it as in use.
+func (l *conversationLocks) ref(key string) *keyLock {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	k, ok := l.keys[key]
+	if !ok {
+		k = &keyLock{sem: make(chan struct{}, 1)}
+		l.keys[key] = k
+	}
+	k.refs++
+	return k
+}
+
+// unref marks the lock for the given key as no longer used by the caller, and removes it once unused.
+func (l *conversationLocks) unref(key string, k *keyLock) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	k.refs--
+	if k.refs == 0 {
+		delete(l.keys, key)
+	}
+}
@@ -1,13 +1,16 @@
 package handlers_test
 
 import (
+	"context"
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/PaulSonOfLars/gotgbot/v2"
 	"github.com/PaulSonOfLars/gotgbot/v2/ext"
 	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers"
 	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers/conversation"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers/filters/callbackquery"
 	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers/filters/message"
 )
 
@@ -90,6 +93,45 @@ func TestBasicKeyedConversation(t *testing.T) {
 	checkExpectedState(t, &conv, messageFromTwo, "")
 }
 
+func TestThreadKeyedConversation(t *testing.T) {
+	b := NewTestBot()
+
+	const nextStep = "nextStep"
+
+	conv := handlers.NewConversation(
+		[]ext.Handler{handlers.NewCommand("start", func(b *gotgbot.Bot, ctx *ext.Context) error {
+			return handlers.NextConversationState(nextStep)
+		})},
+		map[string][]ext.Handler{
+			nextStep: {handlers.NewMessage(message.Contains("message"), func(b *gotgbot.Bot, ctx *ext.Context) error {
+				return handlers.EndConversation()
+			})},
+		},
+		&handlers.ConversationOpts{
+			// Make sure that we key by sender in each topic
+			StateStorage: conversation.NewInMemoryStorage(conversation.KeyStrategySenderAndChatAndThread),
+		},
+	)
+
+	var userId int64 = 123
+	var chatId int64 = 1234
+
+	startInTopic := NewCommandMessage(userId, chatId, "start", []string{})
+	startInTopic.Message.IsTopicMessage = true
+	startInTopic.Message.MessageThreadId = 10
+	startInTopic.EffectiveThreadId = 10
+
+	messageInOtherTopic := NewMessage(userId, chatId, "message")
+	messageInOtherTopic.Message.IsTopicMessage = true
+	messageInOtherTopic.Message.MessageThreadId = 20
+	messageInOtherTopic.EffectiveThreadId = 20
+
+	runHandler(t, b, &conv, startInTopic, "", nextStep)
+
+	// The conversation only exists in the first topic.
+	checkExpectedState(t, &conv, messageInOtherTopic, "")
+}
+
 func TestBasicConversationExit(t *testing.T) {
 	b := NewTestBot()
 
@@ -312,6 +354,569 @@ func TestNestedConversation(t *testing.T) {
 	checkExpectedState(t, &conv, textMessage, "")
 }
 
+func TestConversationData(t *testing.T) {
+	b := NewTestBot()
+
+	const nameStep = "nameStep"
+	const petStep = "petStep"
+	const confirmStep = "confirmStep"
+	var summary string
+
+	petConv := handlers.NewConversation(
+		[]ext.Handler{handlers.NewCommand("pet", func(b *gotgbot.Bot, ctx *ext.Context) error {
+			if _, ok := handlers.ConversationData(ctx)["name"]; ok {
+				t.Errorf("did not expect the nested conversation to see the parent's data")
+			}
+			return handlers.NextConversationState(petStep)
+		})},
+		map[string][]ext.Handler{
+			petStep: {handlers.NewMessage(message.Text, func(b *gotgbot.Bot, ctx *ext.Context) error {
+				handlers.ConversationData(ctx)["pet"] = ctx.EffectiveMessage.Text
+				return handlers.EndConversationToParentState(handlers.NextConversationState(confirmStep))
+			})},
+		},
+		nil,
+	)
+
+	conv := handlers.NewConversation(
+		[]ext.Handler{handlers.NewCommand("start", func(b *gotgbot.Bot, ctx *ext.Context) error {
+			if len(handlers.ConversationData(ctx)) != 0 {
+				t.Errorf("expected new conversations to have no data, got %v", handlers.ConversationData(ctx))
+			}
+			handlers.ConversationData(ctx)["started"] = "yes"
+			return handlers.NextConversationState(nameStep)
+		})},
+		map[string][]ext.Handler{
+			nameStep: {
+				petConv,
+				handlers.NewMessage(message.Text, func(b *gotgbot.Bot, ctx *ext.Context) error {
+					// Handlers which don't change the state can still store data.
+					handlers.ConversationData(ctx)["name"] = ctx.EffectiveMessage.Text
+					return nil
+				}),
+			},
+			confirmStep: {handlers.NewMessage(message.Text, func(b *gotgbot.Bot, ctx *ext.Context) error {
+				data := handlers.ConversationData(ctx)
+				summary = data["started"] + "," + data["name"] + "," + data["pet"]
+				return handlers.EndConversation()
+			})},
+		},
+		nil,
+	)
+
+	var userId int64 = 123
+	var chatId int64 = 1234
+
+	start := NewCommandMessage(userId, chatId, "start", []string{})
+	runHandler(t, b, &conv, start, "", nameStep)
+	runHandler(t, b, &conv, NewMessage(userId, chatId, "John"), nameStep, nameStep)
+	runHandler(t, b, &conv, NewCommandMessage(userId, chatId, "pet", []string{}), nameStep, nameStep)
+
+	// The nested conversation's data is merged into the parent's data when it moves the parent to the next state.
+	runHandler(t, b, &conv, NewMessage(userId, chatId, "Rex"), nameStep, confirmStep)
+	state, err := conv.StateStorage.Get(start)
+	if err != nil {
+		t.Fatalf("failed to get conversation state: %s", err.Error())
+	}
+	if state.Data["name"] != "John" || state.Data["pet"] != "Rex" {
+		t.Fatalf("expected the state to hold the collected data, got %v", state.Data)
+	}
+
+	runHandler(t, b, &conv, NewMessage(userId, chatId, "ok"), confirmStep, "")
+	if summary != "yes,John,Rex" {
+		t.Fatalf("unexpected summary: %s", summary)
+	}
+
+	// The data was cleared when the conversation ended.
+	runHandler(t, b, &conv, start, "", nameStep)
+	state, err = conv.StateStorage.Get(start)
+	if err != nil {
+		t.Fatalf("failed to get conversation state: %s", err.Error())
+	}
+	if len(state.Data) != 1 {
+		t.Fatalf("expected the previous conversation's data to be cleared, got %v", state.Data)
+	}
+}
+
+func TestReEntryConversationData(t *testing.T) {
+	b := NewTestBot()
+
+	const nameStep = "nameStep"
+	const ageStep = "ageStep"
+	var startData []map[string]string
+
+	conv := handlers.NewConversation(
+		[]ext.Handler{handlers.NewCommand("start", func(b *gotgbot.Bot, ctx *ext.Context) error {
+			data := handlers.ConversationData(ctx)
+			seen := map[string]string{}
+			for k, v := range data {
+				seen[k] = v
+			}
+			startData = append(startData, seen)
+			return handlers.NextConversationState(nameStep)
+		})},
+		map[string][]ext.Handler{
+			nameStep: {handlers.NewMessage(message.Text, func(b *gotgbot.Bot, ctx *ext.Context) error {
+				handlers.ConversationData(ctx)["name"] = ctx.EffectiveMessage.Text
+				return handlers.NextConversationState(ageStep)
+			})},
+			ageStep: {},
+		},
+		&handlers.ConversationOpts{AllowReEntry: true},
+	)
+
+	var userId int64 = 123
+	var chatId int64 = 1234
+
+	start := NewCommandMessage(userId, chatId, "start", []string{})
+	runHandler(t, b, &conv, start, "", nameStep)
+	runHandler(t, b, &conv, NewMessage(userId, chatId, "John"), nameStep, ageStep)
+
+	// Restarting mid-flow drops the answers of the abandoned run.
+	runHandler(t, b, &conv, start, ageStep, nameStep)
+	if len(startData) != 2 || len(startData[1]) != 0 {
+		t.Fatalf("expected the restarted conversation to have no data, got %v", startData)
+	}
+	state, err := conv.StateStorage.Get(start)
+	if err != nil {
+		t.Fatalf("failed to get conversation state: %s", err.Error())
+	}
+	if len(state.Data) != 0 {
+		t.Fatalf("expected the restarted conversation's state to have no data, got %v", state.Data)
+	}
+}
+
+func TestConversationConflict(t *testing.T) {
+	b := NewTestBot()
+
+	const nextStep = "nextStep"
+	const otherStep = "otherStep"
+	var conv handlers.Conversation
+	conv = handlers.NewConversation(
+		[]ext.Handler{handlers.NewCommand("start", func(b *gotgbot.Bot, ctx *ext.Context) error {
+			return handlers.NextConversationState(nextStep)
+		})},
+		map[string][]ext.Handler{
+			nextStep: {handlers.NewMessage(message.Contains("message"), func(b *gotgbot.Bot, ctx *ext.Context) error {
+				// Emulate another replica moving the conversation on while this update is being handled.
+				if err := conv.StateStorage.Set(ctx, conversation.State{Key: otherStep}); err != nil {
+					t.Fatalf("failed to set state: %s", err.Error())
+				}
+				return handlers.EndConversation()
+			})},
+			otherStep: {},
+		},
+		nil,
+	)
+
+	var userId int64 = 123
+	var chatId int64 = 1234
+
+	runHandler(t, b, &conv, NewCommandMessage(userId, chatId, "start", []string{}), "", nextStep)
+
+	textMessage := NewMessage(userId, chatId, "message")
+	willRunHandler(t, b, &conv, textMessage, nextStep)
+	var conflict *conversation.ConflictError
+	if err := conv.HandleUpdate(b, textMessage); !errors.As(err, &conflict) {
+		t.Fatalf("expected a conflict error, got %v", err)
+	}
+
+	// The concurrent change was kept.
+	checkExpectedState(t, &conv, textMessage, otherStep)
+}
+
+func TestCallbackMessageKeyedConversation(t *testing.T) {
+	b := NewTestBot()
+
+	const nextStep = "nextStep"
+
+	conv := handlers.NewConversation(
+		[]ext.Handler{handlers.NewCallback(callbackquery.Equal("open"), func(b *gotgbot.Bot, ctx *ext.Context) error {
+			return handlers.NextConversationState(nextStep)
+		})},
+		map[string][]ext.Handler{
+			nextStep: {handlers.NewCallback(callbackquery.Equal("close"), func(b *gotgbot.Bot, ctx *ext.Context) error {
+				return handlers.EndConversation()
+			})},
+		},
+		&handlers.ConversationOpts{
+			// Each message with buttons gets its own conversation.
+			StateStorage: conversation.NewInMemoryStorage(conversation.KeyStrategyCallbackMessage),
+		},
+	)
+
+	callback := func(messageId int64, data string) *ext.Context {
+		return ext.NewContext(&gotgbot.Update{CallbackQuery: &gotgbot.CallbackQuery{
+			Id:      "cq",
+			From:    gotgbot.User{Id: 123},
+			Message: &gotgbot.Message{MessageId: messageId, Chat: gotgbot.Chat{Id: 1234, Type: "supergroup"}},
+			Data:    data,
+		}}, nil)
+	}
+
+	// Two menus of the same user in the same chat are independent.
+	for _, ctx := range []*ext.Context{callback(1, "open"), callback(2, "open"), callback(1, "close")} {
+		if !conv.CheckUpdate(b, ctx) {
+			t.Fatalf("expected callback %s on message %d to match", ctx.CallbackQuery.Data, ctx.CallbackQuery.Message.MessageId)
+		}
+		if err := conv.HandleUpdate(b, ctx); err != nil {
+			t.Fatalf("unexpected error from handler: %s", err.Error())
+		}
+	}
+	checkExpectedState(t, &conv, callback(1, "close"), "")
+	checkExpectedState(t, &conv, callback(2, "close"), nextStep)
+
+	// Updates without a key are safely ignored.
+	message := NewMessage(123, 1234, "open")
+	if conv.CheckUpdate(b, message) {
+		t.Fatalf("did not expect an update without a key to match")
+	}
+	if err := conv.HandleUpdate(b, message); !errors.Is(err, ext.ContinueGroups) {
+		t.Fatalf("expected an update without a key to continue groups, got %v", err)
+	}
+}
+
+func TestConversationWithoutKey(t *testing.T) {
+	b := NewTestBot()
+
+	conv := handlers.NewConversation(
+		[]ext.Handler{handlers.NewInlineQuery(nil, func(b *gotgbot.Bot, ctx *ext.Context) error {
+			return handlers.NextConversationState("nextStep")
+		})},
+		map[string][]ext.Handler{"nextStep": {}},
+		&handlers.ConversationOpts{Block: true},
+	)
+
+	// Inline queries have no chat, so can't be part of conversations keyed by chat.
+	inlineQuery := ext.NewContext(&gotgbot.Update{InlineQuery: &gotgbot.InlineQuery{
+		Id:   "iq",
+		From: gotgbot.User{Id: 123},
+	}}, nil)
+	if conv.CheckUpdate(b, inlineQuery) {
+		t.Fatalf("did not expect an inline query to match")
+	}
+}
+
+func TestConversationTimeout(t *testing.T) {
+	b := NewTestBot()
+
+	const nextStep = "nextStep"
+	var timedOut []int64
+
+	conv := handlers.NewConversation(
+		[]ext.Handler{handlers.NewCommand("start", func(b *gotgbot.Bot, ctx *ext.Context) error {
+			return handlers.NextConversationState(nextStep)
+		})},
+		map[string][]ext.Handler{
+			nextStep: {handlers.NewMessage(message.Contains("message"), func(b *gotgbot.Bot, ctx *ext.Context) error {
+				return handlers.EndConversation()
+			})},
+		},
+		&handlers.ConversationOpts{
+			Timeout: time.Hour,
+			TimeoutHandlers: []ext.Handler{handlers.NewMessage(message.All, func(b *gotgbot.Bot, ctx *ext.Context) error {
+				timedOut = append(timedOut, ctx.EffectiveSender.Id())
+				return handlers.EndConversation()
+			})},
+		},
+	)
+
+	var userIdOne int64 = 123
+	var userIdTwo int64 = 456
+	var chatId int64 = 1234
+
+	// expire makes the user's conversation time out, as though it had been idle for too long.
+	expire := func(ctx *ext.Context) {
+		s, err := conv.StateStorage.Get(ctx)
+		if err != nil {
+			t.Fatalf("failed to get conversation state: %s", err.Error())
+		}
+		if s.Expiry.IsZero() || s.LastUpdate == nil {
+			t.Fatalf("expected the conversation state to have a timeout, got %+v", s)
+		}
+		s.Expiry = time.Now().Add(-time.Second)
+		if err := conv.StateStorage.Set(ctx, *s); err != nil {
+			t.Fatalf("failed to set conversation state: %s", err.Error())
+		}
+	}
+
+	// Timed out conversations are ended when the next update arrives, which is then handled as a new conversation.
+	startOne := NewCommandMessage(userIdOne, chatId, "start", []string{})
+	runHandler(t, b, &conv, startOne, "", nextStep)
+	expire(startOne)
+	if conv.CheckUpdate(b, NewMessage(userIdOne, chatId, "message")) {
+		t.Fatalf("did not expect the timed out state to handle the message")
+	}
+	if !conv.CheckUpdate(b, startOne) {
+		t.Fatalf("expected the entrypoint to handle the timed out conversation")
+	}
+	if err := conv.HandleUpdate(b, startOne); err != nil {
+		t.Fatalf("unexpected error from handler: %s", err.Error())
+	}
+	checkExpectedState(t, &conv, startOne, nextStep)
+	if len(timedOut) != 1 || timedOut[0] != userIdOne {
+		t.Fatalf("expected the timeout handler to run once for user one, got %v", timedOut)
+	}
+
+	// Timed out conversations can also be ended without an update.
+	startTwo := NewCommandMessage(userIdTwo, chatId, "start", []string{})
+	runHandler(t, b, &conv, startTwo, "", nextStep)
+	expire(startTwo)
+	if err := conv.CheckTimeouts(b); err != nil {
+		t.Fatalf("unexpected error while checking timeouts: %s", err.Error())
+	}
+	checkExpectedState(t, &conv, startTwo, "")
+	checkExpectedState(t, &conv, startOne, nextStep)
+	if len(timedOut) != 2 || timedOut[1] != userIdTwo {
+		t.Fatalf("expected the timeout handler to run for user two, got %v", timedOut)
+	}
+
+	// Ended conversations don't time out.
+	runHandler(t, b, &conv, NewMessage(userIdOne, chatId, "message"), nextStep, "")
+	if err := conv.CheckTimeouts(b); err != nil {
+		t.Fatalf("unexpected error while checking timeouts: %s", err.Error())
+	}
+	if len(timedOut) != 2 {
+		t.Fatalf("expected no more timeouts, got %v", timedOut)
+	}
+}
+
+func TestConversationTimeoutChecker(t *testing.T) {
+	b := NewTestBot()
+
+	const nextStep = "nextStep"
+	timedOut := make(chan int64, 1)
+
+	conv := handlers.NewConversation(
+		[]ext.Handler{handlers.NewCommand("start", func(b *gotgbot.Bot, ctx *ext.Context) error {
+			return handlers.NextConversationState(nextStep)
+		})},
+		map[string][]ext.Handler{
+			nextStep: {handlers.NewMessage(message.Contains("message"), func(b *gotgbot.Bot, ctx *ext.Context) error {
+				return handlers.EndConversation()
+			})},
+		},
+		&handlers.ConversationOpts{
+			Timeout: 20 * time.Millisecond,
+			TimeoutHandlers: []ext.Handler{handlers.NewMessage(message.All, func(b *gotgbot.Bot, ctx *ext.Context) error {
+				timedOut <- ctx.EffectiveSender.Id()
+				return nil
+			})},
+		},
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	conv.StartTimeoutChecker(ctx, b, 5*time.Millisecond, func(err error) {
+		t.Errorf("unexpected error while checking timeouts: %v", err)
+	})
+
+	var userId int64 = 123
+	var chatId int64 = 1234
+	start := NewCommandMessage(userId, chatId, "start", []string{})
+	runHandler(t, b, &conv, start, "", nextStep)
+
+	// The user goes silent; the conversation still times out.
+	select {
+	case id := <-timedOut:
+		if id != userId {
+			t.Fatalf("expected the timeout handler to run for user %d, got %d", userId, id)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected the timeout handler to run without further updates")
+	}
+	checkExpectedState(t, &conv, start, "")
+}
+
+func TestBlockingConversation(t *testing.T) {
+	b := NewTestBot()
+
+	const nextStep = "nextStep"
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var ended bool
+
+	conv := handlers.NewConversation(
+		[]ext.Handler{handlers.NewCommand("start", func(b *gotgbot.Bot, ctx *ext.Context) error {
+			close(started)
+			<-release
+			return handlers.NextConversationState(nextStep)
+		})},
+		map[string][]ext.Handler{
+			nextStep: {handlers.NewMessage(message.Contains("message"), func(b *gotgbot.Bot, ctx *ext.Context) error {
+				ended = true
+				return handlers.EndConversation()
+			})},
+		},
+		&handlers.ConversationOpts{Block: true},
+	)
+
+	var userId int64 = 123
+	var chatId int64 = 1234
+
+	startCommand := NewCommandMessage(userId, chatId, "start", []string{})
+	textMessage := NewMessage(userId, chatId, "message")
+	if conv.CheckUpdate(b, textMessage) {
+		t.Fatalf("did not expect the message to match before the conversation started")
+	}
+
+	startErr := make(chan error)
+	go func() {
+		startErr <- conv.HandleUpdate(b, startCommand)
+	}()
+	<-started
+
+	// While the entrypoint is running, the message is queued rather than dropped.
+	if !conv.CheckUpdate(b, textMessage) {
+		t.Fatalf("expected the message to be queued while the conversation is busy")
+	}
+	// Updates which can't be part of the conversation are left to other handlers.
+	if conv.CheckUpdate(b, NewMessage(userId, chatId, "unrelated")) {
+		t.Fatalf("did not expect an unrelated message to be claimed while the conversation is busy")
+	}
+	textErr := make(chan error)
+	go func() {
+		textErr <- conv.HandleUpdate(b, textMessage)
+	}()
+
+	select {
+	case <-textErr:
+		t.Fatalf("expected the message to wait for the entrypoint to complete")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	close(release)
+	if err := <-startErr; err != nil {
+		t.Fatalf("unexpected error from handler: %s", err.Error())
+	}
+	if err := <-textErr; err != nil {
+		t.Fatalf("unexpected error from handler: %s", err.Error())
+	}
+	if !ended {
+		t.Fatalf("expected the queued message to be handled in the next state")
+	}
+	checkExpectedState(t, &conv, textMessage, "")
+
+	// Queued updates which no longer match are passed on to the next handlers.
+	if err := conv.HandleUpdate(b, textMessage); !errors.Is(err, ext.ContinueGroups) {
+		t.Fatalf("expected unmatched updates to continue groups, got %v", err)
+	}
+}
+
+func TestBlockingConversationLiteral(t *testing.T) {
+	b := NewTestBot()
+
+	const nextStep = "nextStep"
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	// Conversations created as struct literals also block.
+	conv := handlers.Conversation{
+		EntryPoints: []ext.Handler{handlers.NewCommand("start", func(b *gotgbot.Bot, ctx *ext.Context) error {
+			close(started)
+			<-release
+			return handlers.NextConversationState(nextStep)
+		})},
+		States: map[string][]ext.Handler{
+			nextStep: {handlers.NewMessage(message.Contains("message"), func(b *gotgbot.Bot, ctx *ext.Context) error {
+				return handlers.EndConversation()
+			})},
+		},
+		StateStorage: conversation.NewInMemoryStorage(conversation.KeyStrategySenderAndChat),
+		Block:        true,
+	}
+
+	var userId int64 = 123
+	var chatId int64 = 1234
+
+	startErr := make(chan error)
+	go func() {
+		startErr <- conv.HandleUpdate(b, NewCommandMessage(userId, chatId, "start", []string{}))
+	}()
+	<-started
+
+	textErr := make(chan error)
+	go func() {
+		textErr <- conv.HandleUpdate(b, NewMessage(userId, chatId, "message"))
+	}()
+	select {
+	case <-textErr:
+		t.Fatalf("expected the message to wait for the entrypoint to complete")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	close(release)
+	if err := <-startErr; err != nil {
+		t.Fatalf("unexpected error from handler: %s", err.Error())
+	}
+	if err := <-textErr; err != nil {
+		t.Fatalf("expected the queued message to be handled in the next state, got %v", err)
+	}
+}
+
+func TestBlockingConversationWaiting(t *testing.T) {
+	b := NewTestBot()
+
+	const nextStep = "nextStep"
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var waited bool
+
+	conv := handlers.NewConversation(
+		[]ext.Handler{handlers.NewCommand("start", func(b *gotgbot.Bot, ctx *ext.Context) error {
+			if ctx.EffectiveSender.Id() == 123 {
+				close(started)
+				<-release
+			}
+			return handlers.NextConversationState(nextStep)
+		})},
+		map[string][]ext.Handler{
+			nextStep: {handlers.NewMessage(message.Contains("message"), func(b *gotgbot.Bot, ctx *ext.Context) error {
+				return handlers.EndConversation()
+			})},
+		},
+		&handlers.ConversationOpts{
+			Block: true,
+			WaitingHandlers: []ext.Handler{handlers.NewMessage(message.Text, func(b *gotgbot.Bot, ctx *ext.Context) error {
+				waited = true
+				return handlers.EndConversation()
+			})},
+		},
+	)
+
+	var userId int64 = 123
+	var chatId int64 = 1234
+
+	startCommand := NewCommandMessage(userId, chatId, "start", []string{})
+	startErr := make(chan error)
+	go func() {
+		startErr <- conv.HandleUpdate(b, startCommand)
+	}()
+	<-started
+
+	// While the entrypoint is running, updates go to the waiting handlers.
+	textMessage := NewMessage(userId, chatId, "message")
+	if !conv.CheckUpdate(b, textMessage) {
+		t.Fatalf("expected the waiting handler to match")
+	}
+	if err := conv.HandleUpdate(b, textMessage); err != nil {
+		t.Fatalf("unexpected error from waiting handler: %s", err.Error())
+	}
+	if !waited {
+		t.Fatalf("expected the waiting handler to have run")
+	}
+
+	// Other conversations aren't blocked.
+	runHandler(t, b, &conv, NewCommandMessage(456, chatId, "start", []string{}), "", nextStep)
+
+	close(release)
+	if err := <-startErr; err != nil {
+		t.Fatalf("unexpected error from handler: %s", err.Error())
+	}
+	// The waiting handler's state change was ignored.
+	checkExpectedState(t, &conv, textMessage, nextStep)
+}
+
 // runHandler ensures that the incoming update will trigger the conversation.
 func runHandler(t *testing.T, b *gotgbot.Bot, conv *handlers.Conversation, message *ext.Context, currentState string, nextState string) {
 	willRunHandler(t, b, conv, message, currentState)
@@ -337,11 +942,11 @@ func checkExpectedState(t *testing.T, conv *handlers.Conversation, message *ext.
 	currentState, err := conv.StateStorage.Get(message)
 	if nextState == "" {
 		if !errors.Is(err, conversation.KeyNotFound) {
-			t.Fatalf("expected not to have a conversation, but got currentState: %s", currentState)
+			t.Fatalf("expected not to have a conversation, but got currentState: %v", currentState)
 		}
 	} else if err != nil {
 		t.Fatalf("unexpected error while checking the current currentState of the conversation")
 	} else if currentState == nil || currentState.Key != nextState {
-		t.Fatalf("expected the conversation to be at '%s', was '%s'", nextState, currentState)
+		t.Fatalf("expected the conversation to be at '%s', was '%v'", nextState, currentState)
 	}
 }
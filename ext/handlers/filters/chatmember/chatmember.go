@@ -58,3 +58,41 @@ func OldStatus(status string) filters.ChatMember {
 		return cm.OldChatMember.GetStatus() == status
 	}
 }
+
+func Transition(t gotgbot.ChatMemberTransition) filters.ChatMember {
+	return func(cm *gotgbot.ChatMemberUpdated) bool {
+		return cm.HasTransition(t)
+	}
+}
+
+func Joined(cm *gotgbot.ChatMemberUpdated) bool {
+	return cm.HasTransition(gotgbot.ChatMemberTransitionJoined)
+}
+
+func Left(cm *gotgbot.ChatMemberUpdated) bool {
+	return cm.HasTransition(gotgbot.ChatMemberTransitionLeft)
+}
+
+func Banned(cm *gotgbot.ChatMemberUpdated) bool {
+	return cm.HasTransition(gotgbot.ChatMemberTransitionBanned)
+}
+
+func Unbanned(cm *gotgbot.ChatMemberUpdated) bool {
+	return cm.HasTransition(gotgbot.ChatMemberTransitionUnbanned)
+}
+
+func Promoted(cm *gotgbot.ChatMemberUpdated) bool {
+	return cm.HasTransition(gotgbot.ChatMemberTransitionPromoted)
+}
+
+func Demoted(cm *gotgbot.ChatMemberUpdated) bool {
+	return cm.HasTransition(gotgbot.ChatMemberTransitionDemoted)
+}
+
+func Restricted(cm *gotgbot.ChatMemberUpdated) bool {
+	return cm.HasTransition(gotgbot.ChatMemberTransitionRestricted)
+}
+
+func Unrestricted(cm *gotgbot.ChatMemberUpdated) bool {
+	return cm.HasTransition(gotgbot.ChatMemberTransitionUnrestricted)
+}
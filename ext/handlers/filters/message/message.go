@@ -273,3 +273,37 @@ func UserShared(msg *gotgbot.Message) bool {
 func ChatShared(msg *gotgbot.Message) bool {
 	return msg.ChatShared != nil
 }
+
+func TopicMessage(msg *gotgbot.Message) bool {
+	return msg.IsTopicMessage
+}
+
+func ThreadID(id int64) filters.Message {
+	return func(m *gotgbot.Message) bool {
+		return m.IsTopicMessage && m.MessageThreadId == id
+	}
+}
+
+func ForumTopicCreated(msg *gotgbot.Message) bool {
+	return msg.ForumTopicCreated != nil
+}
+
+func ForumTopicEdited(msg *gotgbot.Message) bool {
+	return msg.ForumTopicEdited != nil
+}
+
+func ForumTopicClosed(msg *gotgbot.Message) bool {
+	return msg.ForumTopicClosed != nil
+}
+
+func ForumTopicReopened(msg *gotgbot.Message) bool {
+	return msg.ForumTopicReopened != nil
+}
+
+func GeneralForumTopicHidden(msg *gotgbot.Message) bool {
+	return msg.GeneralForumTopicHidden != nil
+}
+
+func GeneralForumTopicUnhidden(msg *gotgbot.Message) bool {
+	return msg.GeneralForumTopicUnhidden != nil
+}
@@ -0,0 +1,23 @@
+package startpayload
+
+import (
+	"strings"
+
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers/filters"
+)
+
+func All(_ string) bool {
+	return true
+}
+
+func Prefix(prefix string) filters.StartPayload {
+	return func(payload string) bool {
+		return strings.HasPrefix(payload, prefix)
+	}
+}
+
+func Equal(match string) filters.StartPayload {
+	return func(payload string) bool {
+		return payload == match
+	}
+}
@@ -11,4 +11,5 @@ type (
 	Poll               func(poll *gotgbot.Poll) bool
 	PollAnswer         func(pa *gotgbot.PollAnswer) bool
 	ChatJoinRequest    func(cjr *gotgbot.ChatJoinRequest) bool
+	StartPayload       func(payload string) bool
 )
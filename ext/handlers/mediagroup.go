@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers/filters"
+)
+
+const (
+	// DefaultMediaGroupQuietWindow is the default time to wait for more album items before handling the album.
+	DefaultMediaGroupQuietWindow = time.Second
+	// DefaultMediaGroupMaxSize is the default maximum number of items in an album; this is telegram's own limit.
+	DefaultMediaGroupMaxSize = 10
+)
+
+// mediaGroupMessagesDataKey is the ext.Context.Data key used to store the buffered album messages.
+const mediaGroupMessagesDataKey = "handlers.mediagroup.messages"
+
+// MediaGroup handles albums, which telegram sends as separate messages sharing the same MediaGroupId.
+// Messages are buffered until no new items have been received for the QuietWindow, or until MaxSize items have been
+// received. The Response is then called once, with the context of the first message received; all album messages can
+// be obtained with MediaGroupMessages.
+//
+// Note: the update handling the first message of an album waits for the rest of the album, so it occupies one of the
+// dispatcher's routines until the album is complete. All other album messages return immediately.
+type MediaGroup struct {
+	AllowChannel bool
+	// Filter is checked against each album message. Messages which don't match are not added to the album.
+	Filter filters.Message
+	// QuietWindow is the time to wait for more album items, after the last item was received. If zero,
+	// DefaultMediaGroupQuietWindow is used.
+	QuietWindow time.Duration
+	// MaxSize is the maximum number of items in an album. Once it is reached, the album is handled immediately.
+	MaxSize  int
+	Response Response
+
+	// albums keeps track of the albums currently being buffered. Its zero value is ready to use, so MediaGroup
+	// handlers can also be created as struct literals.
+	albums mediaGroupBuffer
+}
+
+func NewMediaGroup(f filters.Message, r Response) *MediaGroup {
+	return &MediaGroup{
+		AllowChannel: false,
+		Filter:       f,
+		QuietWindow:  DefaultMediaGroupQuietWindow,
+		MaxSize:      DefaultMediaGroupMaxSize,
+		Response:     r,
+	}
+}
+
+// MediaGroupMessages returns all the messages of the album handled by the MediaGroup handler, ordered by message ID.
+func MediaGroupMessages(ctx *ext.Context) []*gotgbot.Message {
+	msgs, _ := ctx.Data[mediaGroupMessagesDataKey].([]*gotgbot.Message)
+	return msgs
+}
+
+func (m *MediaGroup) CheckUpdate(b *gotgbot.Bot, ctx *ext.Context) bool {
+	msg := ctx.Message
+	if m.AllowChannel && ctx.ChannelPost != nil {
+		msg = ctx.ChannelPost
+	}
+	if msg == nil || msg.MediaGroupId == "" {
+		return false
+	}
+	return m.Filter == nil || m.Filter(msg)
+}
+
+func (m *MediaGroup) HandleUpdate(b *gotgbot.Bot, ctx *ext.Context) error {
+	msg := ctx.Message
+	if msg == nil {
+		msg = ctx.ChannelPost
+	}
+
+	key := fmt.Sprintf("%d/%d/%s", b.Id, msg.Chat.Id, msg.MediaGroupId)
+	album, first := m.albums.add(key, msg, m.MaxSize)
+	if !first {
+		// This message was added to an album which is being handled by another update.
+		return nil
+	}
+
+	quietWindow := m.QuietWindow
+	if quietWindow <= 0 {
+		quietWindow = DefaultMediaGroupQuietWindow
+	}
+	msgs := m.albums.wait(key, album, quietWindow)
+	ctx.Data[mediaGroupMessagesDataKey] = msgs
+	return m.Response(b, ctx)
+}
+
+func (m *MediaGroup) Name() string {
+	return fmt.Sprintf("mediagroup_%p", m)
+}
+
+// mediaGroupBuffer stores the albums currently being received. The zero value is ready to use.
+type mediaGroupBuffer struct {
+	// albums maps bot/chat/media group keys to the album messages received so far.
+	albums map[string]*pendingMediaGroup
+	// lock allows us to ensure synchronous data access.
+	lock sync.Mutex
+}
+
+// pendingMediaGroup is an album which is still being received.
+type pendingMediaGroup struct {
+	msgs []*gotgbot.Message
+	// received is notified whenever a new message is added.
+	received chan struct{}
+	// full is closed once the album has reached its maximum size.
+	full chan struct{}
+}
+
+// add adds a message to the album with the given key. The returned boolean is true if this is the first message of
+// the album, in which case the caller is responsible for waiting for the album to complete.
+func (mb *mediaGroupBuffer) add(key string, msg *gotgbot.Message, maxSize int) (*pendingMediaGroup, bool) {
+	mb.lock.Lock()
+	defer mb.lock.Unlock()
+
+	if mb.albums == nil {
+		mb.albums = map[string]*pendingMediaGroup{}
+	}
+
+	album, ok := mb.albums[key]
+	if !ok {
+		album = &pendingMediaGroup{
+			received: make(chan struct{}, 1),
+			full:     make(chan struct{}),
+		}
+		mb.albums[key] = album
+	}
+
+	album.msgs = append(album.msgs, msg)
+	if maxSize > 0 && len(album.msgs) >= maxSize {
+		// The album is complete; any further messages with the same key start a new album.
+		delete(mb.albums, key)
+		close(album.full)
+	} else if ok {
+		select {
+		case album.received <- struct{}{}:
+		default:
+		}
+	}
+
+	return album, !ok
+}
+
+// wait blocks until the album is full, or until no new messages have been received for the quiet window. It then
+// returns the album's messages, ordered by message ID.
+func (mb *mediaGroupBuffer) wait(key string, album *pendingMediaGroup, quietWindow time.Duration) []*gotgbot.Message {
+	timer := time.NewTimer(quietWindow)
+	defer timer.Stop()
+
+waitLoop:
+	for {
+		select {
+		case <-album.full:
+			break waitLoop
+		case <-album.received:
+			if !timer.Stop() {
+				<-timer.C
+			}
+			timer.Reset(quietWindow)
+		case <-timer.C:
+			break waitLoop
+		}
+	}
+
+	mb.lock.Lock()
+	defer mb.lock.Unlock()
+
+	if mb.albums[key] == album {
+		delete(mb.albums, key)
+	}
+
+	msgs := make([]*gotgbot.Message, len(album.msgs))
+	copy(msgs, album.msgs)
+	sort.SliceStable(msgs, func(i, j int) bool {
+		return msgs[i].MessageId < msgs[j].MessageId
+	})
+	return msgs
+}
@@ -0,0 +1,129 @@
+package handlers_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers"
+)
+
+func newAlbumMessage(chatId int64, messageId int64, mediaGroupId string) *ext.Context {
+	ctx := NewMessage(1, chatId, "")
+	ctx.Message.MessageId = messageId
+	ctx.Message.MediaGroupId = mediaGroupId
+	return ctx
+}
+
+// handleConcurrently handles all the updates concurrently, as the dispatcher would.
+func handleConcurrently(t *testing.T, b *gotgbot.Bot, h ext.Handler, ctxs []*ext.Context) {
+	var wg sync.WaitGroup
+	for _, ctx := range ctxs {
+		if !h.CheckUpdate(b, ctx) {
+			t.Fatalf("expected album message to match")
+		}
+
+		wg.Add(1)
+		go func(ctx *ext.Context) {
+			defer wg.Done()
+			if err := h.HandleUpdate(b, ctx); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		}(ctx)
+		// Ensure the first message is handled first.
+		time.Sleep(5 * time.Millisecond)
+	}
+	wg.Wait()
+}
+
+func TestMediaGroup(t *testing.T) {
+	b := NewTestBot()
+
+	var lock sync.Mutex
+	var albums [][]*gotgbot.Message
+	h := handlers.NewMediaGroup(nil, func(b *gotgbot.Bot, ctx *ext.Context) error {
+		lock.Lock()
+		defer lock.Unlock()
+		albums = append(albums, handlers.MediaGroupMessages(ctx))
+		return nil
+	})
+	h.QuietWindow = 50 * time.Millisecond
+
+	if h.CheckUpdate(b, NewMessage(1, 1, "not an album")) {
+		t.Fatalf("did not expect a regular message to match")
+	}
+
+	handleConcurrently(t, b, h, []*ext.Context{
+		newAlbumMessage(1, 10, "a"),
+		newAlbumMessage(2, 20, "b"),
+		newAlbumMessage(1, 12, "a"),
+		newAlbumMessage(1, 11, "a"),
+	})
+
+	if len(albums) != 2 {
+		t.Fatalf("expected 2 albums, got %d", len(albums))
+	}
+	for _, album := range albums {
+		switch album[0].Chat.Id {
+		case 1:
+			if len(album) != 3 || album[0].MessageId != 10 || album[1].MessageId != 11 || album[2].MessageId != 12 {
+				t.Errorf("expected ordered album of 3 messages, got %d", len(album))
+			}
+		case 2:
+			if len(album) != 1 {
+				t.Errorf("expected album of 1 message, got %d", len(album))
+			}
+		}
+	}
+}
+
+func TestMediaGroupMaxSize(t *testing.T) {
+	b := NewTestBot()
+
+	var lock sync.Mutex
+	var sizes []int
+	h := handlers.NewMediaGroup(nil, func(b *gotgbot.Bot, ctx *ext.Context) error {
+		lock.Lock()
+		defer lock.Unlock()
+		sizes = append(sizes, len(handlers.MediaGroupMessages(ctx)))
+		return nil
+	})
+	h.QuietWindow = time.Hour
+	h.MaxSize = 2
+
+	start := time.Now()
+	handleConcurrently(t, b, h, []*ext.Context{
+		newAlbumMessage(1, 1, "a"),
+		newAlbumMessage(1, 2, "a"),
+	})
+	if time.Since(start) > time.Minute {
+		t.Errorf("expected full album to be handled immediately")
+	}
+	if len(sizes) != 1 || sizes[0] != 2 {
+		t.Errorf("expected a single album of 2 messages, got %v", sizes)
+	}
+}
+
+func TestMediaGroupStructLiteral(t *testing.T) {
+	b := NewTestBot()
+
+	var lock sync.Mutex
+	var sizes []int
+	// A zero QuietWindow uses the default, rather than handling each message as its own album.
+	h := &handlers.MediaGroup{Response: func(b *gotgbot.Bot, ctx *ext.Context) error {
+		lock.Lock()
+		defer lock.Unlock()
+		sizes = append(sizes, len(handlers.MediaGroupMessages(ctx)))
+		return nil
+	}}
+
+	handleConcurrently(t, b, h, []*ext.Context{
+		newAlbumMessage(1, 1, "a"),
+		newAlbumMessage(1, 2, "a"),
+	})
+	if len(sizes) != 1 || sizes[0] != 2 {
+		t.Errorf("expected a single album of 2 messages, got %v", sizes)
+	}
+}
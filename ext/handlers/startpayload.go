@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/deeplink"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers/filters"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers/filters/startpayload"
+)
+
+const (
+	// startPayloadTextDataKey is the ext.Context.Data key used to store the raw start payload.
+	startPayloadTextDataKey = "handlers.startpayload.text"
+	// startPayloadDataDataKey is the ext.Context.Data key used to store the decoded start payload.
+	startPayloadDataDataKey = "handlers.startpayload.data"
+)
+
+// StartPayload handles "/start <payload>" commands, as sent by deep links such as t.me/bot?start=<payload>.
+// Deep links can be generated with the deeplink package.
+type StartPayload struct {
+	// Filter is checked against the raw payload.
+	Filter filters.StartPayload
+	// Codec is used to decode the payload. If set, payloads which cannot be decoded are not matched.
+	Codec    *deeplink.Codec
+	Response Response
+}
+
+func NewStartPayload(f filters.StartPayload, r Response) StartPayload {
+	return StartPayload{
+		Filter:   f,
+		Response: r,
+	}
+}
+
+// NewStartPayloadCodec creates a StartPayload handler which only matches payloads starting with the codec's prefix,
+// and decodes them. The decoded data can then be obtained with StartPayloadData.
+func NewStartPayloadCodec(c deeplink.Codec, r Response) StartPayload {
+	return StartPayload{
+		Filter:   startpayload.Prefix(c.Prefix),
+		Codec:    &c,
+		Response: r,
+	}
+}
+
+func (s StartPayload) CheckUpdate(b *gotgbot.Bot, ctx *ext.Context) bool {
+	_, _, ok := s.parsePayload(b, ctx)
+	return ok
+}
+
+func (s StartPayload) HandleUpdate(b *gotgbot.Bot, ctx *ext.Context) error {
+	if payload, data, ok := s.parsePayload(b, ctx); ok {
+		ctx.Data[startPayloadTextDataKey] = payload
+		ctx.Data[startPayloadDataDataKey] = data
+	}
+	return s.Response(b, ctx)
+}
+
+func (s StartPayload) Name() string {
+	return fmt.Sprintf("startpayload_%p", s.Response)
+}
+
+// StartPayloadText returns the raw payload matched by the StartPayload handler handling the current update.
+func StartPayloadText(ctx *ext.Context) string {
+	payload, _ := ctx.Data[startPayloadTextDataKey].(string)
+	return payload
+}
+
+// StartPayloadData returns the payload data decoded by the StartPayload handler handling the current update.
+// If the handler has no Codec, this is the raw payload.
+func StartPayloadData(ctx *ext.Context) []byte {
+	data, _ := ctx.Data[startPayloadDataDataKey].([]byte)
+	return data
+}
+
+// parsePayload extracts the payload from a start command, and decodes it if necessary.
+func (s StartPayload) parsePayload(b *gotgbot.Bot, ctx *ext.Context) (string, []byte, bool) {
+	if ctx.Message == nil {
+		return "", nil, false
+	}
+
+	_, args, ok := NewCommand("start", nil).matchCommand(b, ctx.Message)
+	if !ok {
+		return "", nil, false
+	}
+
+	payload := strings.TrimSpace(args)
+	if payload == "" {
+		return "", nil, false
+	}
+
+	if s.Filter != nil && !s.Filter(payload) {
+		return "", nil, false
+	}
+
+	if s.Codec == nil {
+		return payload, []byte(payload), true
+	}
+
+	data, err := s.Codec.Decode(payload)
+	if err != nil {
+		return "", nil, false
+	}
+	return payload, data, true
+}
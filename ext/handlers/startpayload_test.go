@@ -0,0 +1,70 @@
+package handlers_test
+
+import (
+	"testing"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/deeplink"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers/filters/startpayload"
+)
+
+func TestStartPayload(t *testing.T) {
+	b := NewTestBot()
+
+	var payload string
+	h := handlers.NewStartPayload(startpayload.Prefix("ref"), func(b *gotgbot.Bot, ctx *ext.Context) error {
+		payload = handlers.StartPayloadText(ctx)
+		return nil
+	})
+
+	ctx := NewCommandMessage(1, 1, "start", []string{"ref123"})
+	if !h.CheckUpdate(b, ctx) {
+		t.Fatalf("expected start payload to match")
+	}
+	if err := h.HandleUpdate(b, ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if payload != "ref123" {
+		t.Errorf("expected payload ref123, got %s", payload)
+	}
+
+	if h.CheckUpdate(b, NewCommandMessage(1, 1, "start", nil)) {
+		t.Errorf("did not expect start without payload to match")
+	}
+	if h.CheckUpdate(b, NewCommandMessage(1, 1, "start", []string{"other"})) {
+		t.Errorf("did not expect start with other payload to match")
+	}
+}
+
+func TestStartPayloadCodec(t *testing.T) {
+	b := NewTestBot()
+
+	codec := deeplink.Codec{Prefix: "inv-", Secret: []byte("secret")}
+	encoded, err := codec.Encode([]byte("hello"))
+	if err != nil {
+		t.Fatalf("failed to encode payload: %v", err)
+	}
+
+	var data []byte
+	h := handlers.NewStartPayloadCodec(codec, func(b *gotgbot.Bot, ctx *ext.Context) error {
+		data = handlers.StartPayloadData(ctx)
+		return nil
+	})
+
+	ctx := NewCommandMessage(1, 1, "start", []string{encoded})
+	if !h.CheckUpdate(b, ctx) {
+		t.Fatalf("expected encoded payload to match")
+	}
+	if err = h.HandleUpdate(b, ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(data) != "hello" {
+		t.Errorf("expected decoded payload 'hello', got '%s'", data)
+	}
+
+	if h.CheckUpdate(b, NewCommandMessage(1, 1, "start", []string{"inv-aGVsbG8"})) {
+		t.Errorf("did not expect unsigned payload to match")
+	}
+}
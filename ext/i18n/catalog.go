@@ -0,0 +1,297 @@
+package i18n
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// message is a single translation. Messages without plural forms only have a PluralOther form.
+type message map[PluralForm]string
+
+// LoadJSON loads the translations for a locale from a JSON object. Each key maps to either a string, or an object of
+// plural forms to strings:
+//
+//	{
+//		"welcome": "Welcome, %s!",
+//		"apples": {"one": "%d apple", "other": "%d apples"}
+//	}
+//
+// Translations are merged into any existing translations for the locale.
+func (b *Bundle) LoadJSON(locale string, r io.Reader) error {
+	var raw map[string]json.RawMessage
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return fmt.Errorf("failed to decode JSON catalog: %w", err)
+	}
+
+	msgs := make(map[string]message, len(raw))
+	for key, v := range raw {
+		var s string
+		if err := json.Unmarshal(v, &s); err == nil {
+			msgs[key] = message{PluralOther: s}
+			continue
+		}
+
+		var forms map[PluralForm]string
+		if err := json.Unmarshal(v, &forms); err != nil {
+			return fmt.Errorf("invalid translation for key %q: must be a string or an object of plural forms", key)
+		}
+		for form := range forms {
+			if !isPluralForm(form) {
+				return fmt.Errorf("invalid translation for key %q: unknown plural form %q", key, form)
+			}
+		}
+		msgs[key] = message(forms)
+	}
+
+	b.addMessages(locale, msgs)
+	return nil
+}
+
+// LoadPO loads the translations for a locale from a gettext .po file. If the locale is empty, it is read from the
+// "Language" header of the file.
+//
+// The msgid of each entry is used as its key. Entries with a msgctxt use the "<msgctxt>\x04<msgid>" key, as in gettext.
+// Fuzzy and untranslated entries are skipped.
+// The numbered msgstr[n] translations of plural entries are mapped to the plural forms of the locale's PluralRule, in
+// order. If the file has fewer plural translations than the rule has forms, the last translation is used for
+// PluralOther.
+func (b *Bundle) LoadPO(locale string, r io.Reader) error {
+	entries, err := parsePO(r)
+	if err != nil {
+		return err
+	}
+
+	if locale == "" {
+		for _, e := range entries {
+			if e.id == "" && e.ctxt == "" && len(e.strs) > 0 {
+				locale = poHeader(e.strs[0], "Language")
+				break
+			}
+		}
+		if locale == "" {
+			return fmt.Errorf("no locale given, and no Language header found")
+		}
+	}
+
+	rule := b.pluralRule(locale)
+	msgs := make(map[string]message, len(entries))
+	for _, e := range entries {
+		if e.id == "" || e.fuzzy || !e.translated() {
+			continue
+		}
+
+		key := e.id
+		if e.ctxt != "" {
+			key = e.ctxt + "\x04" + e.id
+		}
+
+		if !e.plural {
+			msgs[key] = message{PluralOther: e.strs[0]}
+			continue
+		}
+
+		msg := message{}
+		for i, s := range e.strs {
+			if i == len(e.strs)-1 && len(e.strs) < len(rule.Forms) {
+				msg[PluralOther] = s
+				break
+			}
+			if i < len(rule.Forms) {
+				msg[rule.Forms[i]] = s
+			}
+		}
+		msgs[key] = msg
+	}
+
+	b.addMessages(locale, msgs)
+	return nil
+}
+
+// LoadFile loads a .json or .po catalog file. The locale is taken from the file name; for example, "locales/pt-BR.po"
+// is loaded as "pt-br".
+func (b *Bundle) LoadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open catalog: %w", err)
+	}
+	defer f.Close()
+
+	ext := filepath.Ext(path)
+	locale := strings.TrimSuffix(filepath.Base(path), ext)
+	switch strings.ToLower(ext) {
+	case ".json":
+		err = b.LoadJSON(locale, f)
+	case ".po":
+		err = b.LoadPO(locale, f)
+	default:
+		return fmt.Errorf("unsupported catalog file type %q", ext)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load catalog %s: %w", path, err)
+	}
+	return nil
+}
+
+// LoadDir loads all the .json and .po catalog files in a directory, as with LoadFile. Other files are ignored.
+func (b *Bundle) LoadDir(dir string) error {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("failed to read catalog directory: %w", err)
+	}
+
+	for _, f := range files {
+		ext := strings.ToLower(filepath.Ext(f.Name()))
+		if f.IsDir() || (ext != ".json" && ext != ".po") {
+			continue
+		}
+		if err := b.LoadFile(filepath.Join(dir, f.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func isPluralForm(form PluralForm) bool {
+	switch form {
+	case PluralZero, PluralOne, PluralTwo, PluralFew, PluralMany, PluralOther:
+		return true
+	}
+	return false
+}
+
+// poEntry is a single entry of a .po file.
+type poEntry struct {
+	ctxt     string
+	id       string
+	idPlural string
+	plural   bool
+	strs     []string
+	fuzzy    bool
+}
+
+func (e poEntry) translated() bool {
+	for _, s := range e.strs {
+		if s != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// parsePO parses the entries of a .po file. Obsolete entries are ignored.
+func parsePO(r io.Reader) ([]poEntry, error) {
+	var entries []poEntry
+	var cur poEntry
+	// field points to the string which continuation lines are appended to.
+	var field *string
+	started := false
+
+	flush := func() {
+		if started {
+			entries = append(entries, cur)
+		}
+		cur = poEntry{}
+		field = nil
+		started = false
+	}
+
+	scanner := bufio.NewScanner(r)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "":
+			flush()
+			continue
+
+		case strings.HasPrefix(line, "#"):
+			// A comment after a complete entry starts the next one.
+			if started && len(cur.strs) > 0 {
+				flush()
+			}
+			if strings.HasPrefix(line, "#,") && strings.Contains(line, "fuzzy") {
+				cur.fuzzy = true
+			}
+			continue
+
+		case strings.HasPrefix(line, `"`):
+			if field == nil {
+				return nil, fmt.Errorf("line %d: unexpected string continuation", lineNo)
+			}
+			s, err := strconv.Unquote(line)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid string: %w", lineNo, err)
+			}
+			*field += s
+			continue
+		}
+
+		keyword, value := line, ""
+		if idx := strings.IndexByte(line, ' '); idx >= 0 {
+			keyword, value = line[:idx], strings.TrimSpace(line[idx+1:])
+		}
+		s, err := strconv.Unquote(value)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid string: %w", lineNo, err)
+		}
+
+		switch {
+		case keyword == "msgctxt":
+			if started && len(cur.strs) > 0 {
+				flush()
+			}
+			cur.ctxt = s
+			field = &cur.ctxt
+
+		case keyword == "msgid":
+			if started && len(cur.strs) > 0 {
+				flush()
+			}
+			cur.id = s
+			field = &cur.id
+
+		case keyword == "msgid_plural":
+			cur.plural = true
+			cur.idPlural = s
+			field = &cur.idPlural
+
+		case keyword == "msgstr":
+			cur.strs = append(cur.strs, s)
+			field = &cur.strs[len(cur.strs)-1]
+
+		case strings.HasPrefix(keyword, "msgstr[") && strings.HasSuffix(keyword, "]"):
+			idx, err := strconv.Atoi(keyword[len("msgstr[") : len(keyword)-1])
+			if err != nil || idx != len(cur.strs) {
+				return nil, fmt.Errorf("line %d: unexpected plural index %q", lineNo, keyword)
+			}
+			cur.strs = append(cur.strs, s)
+			field = &cur.strs[len(cur.strs)-1]
+
+		default:
+			return nil, fmt.Errorf("line %d: unknown keyword %q", lineNo, keyword)
+		}
+		started = true
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read .po file: %w", err)
+	}
+	flush()
+
+	return entries, nil
+}
+
+// poHeader returns the value of a header field, from the msgstr of the header entry.
+func poHeader(header string, name string) string {
+	for _, line := range strings.Split(header, "\n") {
+		if idx := strings.IndexByte(line, ':'); idx >= 0 && strings.EqualFold(strings.TrimSpace(line[:idx]), name) {
+			return strings.TrimSpace(line[idx+1:])
+		}
+	}
+	return ""
+}
@@ -0,0 +1,148 @@
+package i18n
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBundle_LoadJSON(t *testing.T) {
+	b := NewBundle("en")
+	err := b.LoadJSON("en", strings.NewReader(`{
+		"welcome": "Welcome, %s!",
+		"apples": {"one": "%d apple", "other": "%d apples"}
+	}`))
+	if err != nil {
+		t.Fatalf("failed to load JSON: %v", err)
+	}
+
+	l := b.Localizer("en")
+	if got := l.T("welcome", "Ana"); got != "Welcome, Ana!" {
+		t.Errorf("unexpected translation %q", got)
+	}
+	if got := l.N("apples", 1); got != "1 apple" {
+		t.Errorf("unexpected plural translation %q", got)
+	}
+
+	for name, input := range map[string]string{
+		"invalid JSON":        `{`,
+		"invalid value":       `{"key": 1}`,
+		"unknown plural form": `{"key": {"several": "x"}}`,
+	} {
+		if err := b.LoadJSON("en", strings.NewReader(input)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+const testPO = `# Russian translations.
+msgid ""
+msgstr ""
+"Language: ru\n"
+"Plural-Forms: nplurals=3; plural=(n%10==1 && n%100!=11 ? 0 : n%10>=2 && n%10<=4 && (n%100<10 || n%100>=20) ? 1 : 2);\n"
+
+#: bot.go:10
+msgid "hello"
+msgstr "Привет, "
+"мир!"
+
+msgid "apples"
+msgid_plural "%d apples"
+msgstr[0] "%d яблоко"
+msgstr[1] "%d яблока"
+msgstr[2] "%d яблок"
+
+msgctxt "menu"
+msgid "open"
+msgstr "Открыть меню"
+
+#, fuzzy
+msgid "bye"
+msgstr "Пока"
+
+msgid "untranslated"
+msgstr ""
+
+#~ msgid "obsolete"
+#~ msgstr "Устарело"
+`
+
+func TestBundle_LoadPO(t *testing.T) {
+	b := NewBundle("en")
+	if err := b.LoadPO("", strings.NewReader(testPO)); err != nil {
+		t.Fatalf("failed to load .po file: %v", err)
+	}
+
+	l := b.Localizer("ru")
+	for key, want := range map[string]string{
+		"hello":          "Привет, мир!",
+		"menu\x04open":   "Открыть меню",
+		"bye":            "bye",
+		"untranslated":   "untranslated",
+		"obsolete":       "obsolete",
+		"open":           "open",
+		"missing plural": "missing plural",
+	} {
+		if got := l.T(key); got != want {
+			t.Errorf("expected %q for key %q, got %q", want, key, got)
+		}
+	}
+	for n, want := range map[int64]string{1: "1 яблоко", 2: "2 яблока", 11: "11 яблок"} {
+		if got := l.N("apples", n); got != want {
+			t.Errorf("expected %q for %d, got %q", want, n, got)
+		}
+	}
+
+	if err := b.LoadPO("", strings.NewReader(`msgid "a"`+"\n"+`msgstr "b"`)); err == nil {
+		t.Errorf("expected an error for a .po file without a locale")
+	}
+	if err := b.LoadPO("ru", strings.NewReader(`msgid "a"`+"\n"+`msgfoo "b"`)); err == nil {
+		t.Errorf("expected an error for an unknown keyword")
+	}
+}
+
+func TestBundle_LoadPO_fewerPluralForms(t *testing.T) {
+	// French has a separate plural form for round millions, which gettext files don't define.
+	b := NewBundle("en")
+	err := b.LoadPO("fr", strings.NewReader(`
+msgid "apple"
+msgid_plural "apples"
+msgstr[0] "%d pomme"
+msgstr[1] "%d pommes"
+`))
+	if err != nil {
+		t.Fatalf("failed to load .po file: %v", err)
+	}
+
+	l := b.Localizer("fr")
+	for n, want := range map[int64]string{0: "0 pomme", 2: "2 pommes", 1000000: "1000000 pommes"} {
+		if got := l.N("apple", n); got != want {
+			t.Errorf("expected %q for %d, got %q", want, n, got)
+		}
+	}
+}
+
+func TestBundle_LoadDir(t *testing.T) {
+	dir := t.TempDir()
+	for name, contents := range map[string]string{
+		"en.json":   `{"hello": "Hello!"}`,
+		"pt-BR.po":  "msgid \"hello\"\nmsgstr \"Oi!\"\n",
+		"README.md": "not a catalog",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(contents), 0600); err != nil {
+			t.Fatalf("failed to write catalog: %v", err)
+		}
+	}
+
+	b := NewBundle("en")
+	if err := b.LoadDir(dir); err != nil {
+		t.Fatalf("failed to load catalogs: %v", err)
+	}
+	if got := b.Localizer("pt-br").T("hello"); got != "Oi!" {
+		t.Errorf("expected pt-br translation, got %q", got)
+	}
+	if got := b.Localizer("de").T("hello"); got != "Hello!" {
+		t.Errorf("expected default translation, got %q", got)
+	}
+}
@@ -0,0 +1,371 @@
+// Package i18n provides message catalogs to translate bots into multiple languages, with support for CLDR plural
+// rules, locale fallback chains, and formatted translations.
+//
+// Catalogs are loaded into a Bundle from JSON or gettext .po files. The locale of each update is picked from the
+// user's telegram language, unless the user has chosen a different locale, which is stored in a LocaleStore.
+package i18n
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"sync"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+)
+
+const localizerDataKey = "i18n.localizer"
+
+// Bundle holds the message catalogs of all supported locales.
+//
+// Locales are IETF language tags, as used by telegram's User.LanguageCode; for example, "en" or "pt-br". They are
+// matched case-insensitively.
+type Bundle struct {
+	// DefaultLocale is the locale to use when none of the user's locales have a translation.
+	DefaultLocale string
+	// Fallbacks defines custom fallback locales; for example, mapping "uk" to "ru". Locales which don't have a custom
+	// fallback fall back to their base language; for example, "pt-br" falls back to "pt".
+	Fallbacks map[string]string
+	// PluralRules overrides the built-in plural rules, keyed by locale or base language.
+	PluralRules map[string]PluralRule
+	// Store holds the locales explicitly chosen by users. If nil, users always get their telegram language.
+	Store LocaleStore
+
+	// catalogs maps locales to their translations, keyed by message key.
+	catalogs map[string]map[string]message
+	// lock allows us to ensure synchronous data access.
+	lock sync.RWMutex
+}
+
+// NewBundle creates a new, empty Bundle with the given default locale.
+func NewBundle(defaultLocale string) *Bundle {
+	return &Bundle{
+		DefaultLocale: defaultLocale,
+		catalogs:      map[string]map[string]message{},
+	}
+}
+
+// AddMessages adds translations for a locale, without plural forms.
+// Translations are merged into any existing translations for the locale.
+func (b *Bundle) AddMessages(locale string, msgs map[string]string) {
+	out := make(map[string]message, len(msgs))
+	for k, v := range msgs {
+		out[k] = message{PluralOther: v}
+	}
+	b.addMessages(locale, out)
+}
+
+// AddPlural adds a translation with plural forms for a locale.
+func (b *Bundle) AddPlural(locale string, key string, forms map[PluralForm]string) {
+	msg := make(message, len(forms))
+	for form, v := range forms {
+		msg[form] = v
+	}
+	b.addMessages(locale, map[string]message{key: msg})
+}
+
+func (b *Bundle) addMessages(locale string, msgs map[string]message) {
+	locale = normalizeLocale(locale)
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.catalogs == nil {
+		b.catalogs = map[string]map[string]message{}
+	}
+	catalog, ok := b.catalogs[locale]
+	if !ok {
+		catalog = make(map[string]message, len(msgs))
+		b.catalogs[locale] = catalog
+	}
+	for k, v := range msgs {
+		catalog[k] = v
+	}
+}
+
+// Locales returns the locales which have translations.
+func (b *Bundle) Locales() []string {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	locales := make([]string, 0, len(b.catalogs))
+	for l := range b.catalogs {
+		locales = append(locales, l)
+	}
+	return locales
+}
+
+// FallbackChain returns the locales which are checked, in order, when translating for the given locale. The chain
+// follows the custom Fallbacks and base languages of the locale, and ends with those of the DefaultLocale.
+func (b *Bundle) FallbackChain(locale string) []string {
+	var chain []string
+	seen := map[string]bool{}
+	for _, l := range []string{locale, b.DefaultLocale} {
+		for l = normalizeLocale(l); l != "" && !seen[l]; l = b.nextFallback(l) {
+			seen[l] = true
+			chain = append(chain, l)
+		}
+	}
+	return chain
+}
+
+func (b *Bundle) nextFallback(locale string) string {
+	if fallback, ok := b.Fallbacks[locale]; ok {
+		return normalizeLocale(fallback)
+	}
+	if base := baseLanguage(locale); base != locale {
+		return base
+	}
+	return ""
+}
+
+// pluralRule returns the plural rule to use for a locale, preferring any custom PluralRules.
+func (b *Bundle) pluralRule(locale string) PluralRule {
+	locale = normalizeLocale(locale)
+	for _, l := range []string{locale, baseLanguage(locale)} {
+		for k, rule := range b.PluralRules {
+			if normalizeLocale(k) == l {
+				return rule
+			}
+		}
+	}
+	return DefaultPluralRule(locale)
+}
+
+// Localizer creates a Localizer which translates into the given locale.
+func (b *Bundle) Localizer(locale string) *Localizer {
+	return &Localizer{
+		bundle: b,
+		chain:  b.FallbackChain(locale),
+	}
+}
+
+// ForContext returns the Localizer for the user of the current update. The locale is the one chosen by the user in
+// the Store, if any; otherwise, the user's telegram language is used. Updates without a user get the DefaultLocale.
+//
+// The Localizer is stored in the context, so the Store is only checked once per update.
+func (b *Bundle) ForContext(ctx *ext.Context) (*Localizer, error) {
+	if l, ok := ctx.Data[localizerDataKey].(*Localizer); ok && l.bundle == b {
+		return l, nil
+	}
+
+	locale, err := b.userLocale(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	l := b.Localizer(locale)
+	if ctx.Data == nil {
+		ctx.Data = map[string]interface{}{}
+	}
+	ctx.Data[localizerDataKey] = l
+	return l, nil
+}
+
+func (b *Bundle) userLocale(ctx *ext.Context) (string, error) {
+	if ctx.EffectiveUser == nil {
+		return b.DefaultLocale, nil
+	}
+
+	if b.Store != nil {
+		locale, ok, err := b.Store.Get(ctx.EffectiveUser.Id)
+		if err != nil {
+			return "", fmt.Errorf("failed to get locale of user %d: %w", ctx.EffectiveUser.Id, err)
+		}
+		if ok {
+			return locale, nil
+		}
+	}
+
+	if ctx.EffectiveUser.LanguageCode != "" {
+		return ctx.EffectiveUser.LanguageCode, nil
+	}
+	return b.DefaultLocale, nil
+}
+
+// SetUserLocale stores the locale chosen by the user of the current update, to use instead of their telegram language.
+// An empty locale reverts the user to their telegram language. The Localizer cached in the context is cleared, so
+// later translations for the same update use the new locale.
+//
+// To change the locale of other users, use the Store directly.
+func (b *Bundle) SetUserLocale(ctx *ext.Context, locale string) error {
+	if b.Store == nil {
+		return fmt.Errorf("no locale store set")
+	}
+	if ctx.EffectiveUser == nil {
+		return fmt.Errorf("no user to set the locale of")
+	}
+
+	var err error
+	if locale == "" {
+		err = b.Store.Delete(ctx.EffectiveUser.Id)
+	} else {
+		err = b.Store.Set(ctx.EffectiveUser.Id, normalizeLocale(locale))
+	}
+	if err != nil {
+		return err
+	}
+
+	delete(ctx.Data, localizerDataKey)
+	return nil
+}
+
+// T translates a message for the user of the current update, as with Localizer.T.
+// If the Store fails, the user's telegram language is used instead; use ForContext to handle such errors.
+func (b *Bundle) T(ctx *ext.Context, key string, args ...interface{}) string {
+	return b.contextLocalizer(ctx).T(key, args...)
+}
+
+// N translates a message with plural forms for the user of the current update, as with Localizer.N.
+// If the Store fails, the user's telegram language is used instead; use ForContext to handle such errors.
+func (b *Bundle) N(ctx *ext.Context, key string, n int64, args ...interface{}) string {
+	return b.contextLocalizer(ctx).N(key, n, args...)
+}
+
+// Formatted translates an HTML message into text and entities for the user of the current update, as with
+// Localizer.Formatted.
+func (b *Bundle) Formatted(ctx *ext.Context, key string, args ...interface{}) (string, []gotgbot.MessageEntity, error) {
+	l, err := b.ForContext(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+	return l.Formatted(key, args...)
+}
+
+// NFormatted translates an HTML message with plural forms into text and entities for the user of the current update,
+// as with Localizer.NFormatted.
+func (b *Bundle) NFormatted(ctx *ext.Context, key string, n int64, args ...interface{}) (string, []gotgbot.MessageEntity, error) {
+	l, err := b.ForContext(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+	return l.NFormatted(key, n, args...)
+}
+
+// contextLocalizer returns the Localizer for the current update, ignoring any Store errors.
+func (b *Bundle) contextLocalizer(ctx *ext.Context) *Localizer {
+	l, err := b.ForContext(ctx)
+	if err != nil {
+		if ctx.EffectiveUser != nil && ctx.EffectiveUser.LanguageCode != "" {
+			return b.Localizer(ctx.EffectiveUser.LanguageCode)
+		}
+		return b.Localizer(b.DefaultLocale)
+	}
+	return l
+}
+
+// lookup returns the translation of key in the first locale of the chain which has it. For plural lookups, the
+// translation must also have the plural form selected for n by that locale's rules.
+func (b *Bundle) lookup(chain []string, key string, n int64, plural bool) (string, bool) {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	for _, locale := range chain {
+		msg, ok := b.catalogs[locale][key]
+		if !ok {
+			continue
+		}
+
+		form := PluralOther
+		if plural {
+			form = b.pluralRule(locale).Select(n)
+		}
+		if s, ok := msg[form]; ok {
+			return s, true
+		}
+		if s, ok := msg[PluralOther]; ok {
+			return s, true
+		}
+	}
+	return "", false
+}
+
+// Localizer translates messages into a single locale, falling back to other locales where translations are missing.
+type Localizer struct {
+	bundle *Bundle
+	// chain is the list of locales to check for translations, in order.
+	chain []string
+}
+
+// Locale returns the locale which this Localizer translates into.
+func (l *Localizer) Locale() string {
+	if len(l.chain) == 0 {
+		return ""
+	}
+	return l.chain[0]
+}
+
+// T translates a message. If any args are given, the translation is used as a fmt format string.
+// If no locale has a translation for the key, the key itself is returned, without any formatting.
+func (l *Localizer) T(key string, args ...interface{}) string {
+	s, ok := l.bundle.lookup(l.chain, key, 0, false)
+	if !ok {
+		return key
+	}
+	return format(s, args)
+}
+
+// N translates a message with plural forms, selecting the form to use for the count n with the CLDR plural rules of
+// the locale. The translation is used as a fmt format string with the given args; if no args are given, n is used.
+// If no locale has a translation for the key, the key itself is returned, without any formatting.
+func (l *Localizer) N(key string, n int64, args ...interface{}) string {
+	s, ok := l.bundle.lookup(l.chain, key, n, true)
+	if !ok {
+		return key
+	}
+	if len(args) == 0 {
+		args = []interface{}{n}
+	}
+	return format(s, args)
+}
+
+// Formatted translates a message written in telegram's HTML format, and returns the text and entities to send. This
+// allows translations to contain formatting, without needing a ParseMode; the result can also be split, or combined
+// with other entities.
+// String args are HTML-escaped before formatting, so they are always shown as plain text.
+func (l *Localizer) Formatted(key string, args ...interface{}) (string, []gotgbot.MessageEntity, error) {
+	return gotgbot.ParseHTML(l.T(key, escapeArgs(args)...))
+}
+
+// NFormatted translates an HTML message with plural forms, as with N, and returns the text and entities to send, as
+// with Formatted.
+func (l *Localizer) NFormatted(key string, n int64, args ...interface{}) (string, []gotgbot.MessageEntity, error) {
+	return gotgbot.ParseHTML(l.N(key, n, escapeArgs(args)...))
+}
+
+func format(s string, args []interface{}) string {
+	if len(args) == 0 {
+		return s
+	}
+	return fmt.Sprintf(s, args...)
+}
+
+// escapeArgs HTML-escapes any string arguments.
+func escapeArgs(args []interface{}) []interface{} {
+	out := make([]interface{}, len(args))
+	for i, arg := range args {
+		switch v := arg.(type) {
+		case string:
+			out[i] = html.EscapeString(v)
+		case fmt.Stringer:
+			out[i] = html.EscapeString(v.String())
+		default:
+			out[i] = arg
+		}
+	}
+	return out
+}
+
+// normalizeLocale converts a locale to lowercase, with "-" separators; for example, "pt_BR" becomes "pt-br".
+func normalizeLocale(locale string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"))
+}
+
+// baseLanguage returns the language of a normalized locale, without the region; for example, "pt-br" becomes "pt".
+func baseLanguage(locale string) string {
+	if idx := strings.IndexByte(locale, '-'); idx >= 0 {
+		return locale[:idx]
+	}
+	return locale
+}
@@ -0,0 +1,161 @@
+package i18n
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+)
+
+func newTestBundle() *Bundle {
+	b := NewBundle("en")
+	b.AddMessages("en", map[string]string{
+		"hello":   "Hello!",
+		"welcome": "Welcome, %s!",
+		"bye":     "Goodbye",
+		"greet":   "Hi <b>%s</b>, see <a href=\"https://example.com\">the docs</a>",
+	})
+	b.AddPlural("en", "apples", map[PluralForm]string{PluralOne: "%d apple", PluralOther: "%d apples"})
+	b.AddMessages("pt", map[string]string{"hello": "Olá!", "welcome": "Bem-vindo, %s!"})
+	b.AddMessages("pt-br", map[string]string{"hello": "Oi!"})
+	b.AddMessages("ru", map[string]string{"hello": "Привет!"})
+	b.AddPlural("ru", "apples", map[PluralForm]string{PluralOne: "%d яблоко", PluralFew: "%d яблока", PluralMany: "%d яблок"})
+	return b
+}
+
+func newUserContext(user *gotgbot.User) *ext.Context {
+	return ext.NewContext(&gotgbot.Update{
+		Message: &gotgbot.Message{
+			From: user,
+			Chat: gotgbot.Chat{Id: 1, Type: "private"},
+			Text: "text",
+		},
+	}, nil)
+}
+
+func TestBundle_FallbackChain(t *testing.T) {
+	b := newTestBundle()
+	b.Fallbacks = map[string]string{"uk": "ru"}
+
+	for locale, want := range map[string][]string{
+		"en":    {"en"},
+		"pt-BR": {"pt-br", "pt", "en"},
+		"pt_br": {"pt-br", "pt", "en"},
+		"uk":    {"uk", "ru", "en"},
+		"":      {"en"},
+	} {
+		if got := b.FallbackChain(locale); !reflect.DeepEqual(got, want) {
+			t.Errorf("expected chain %v for %q, got %v", want, locale, got)
+		}
+	}
+}
+
+func TestLocalizer(t *testing.T) {
+	b := newTestBundle()
+
+	pt := b.Localizer("pt-BR")
+	if got := pt.T("hello"); got != "Oi!" {
+		t.Errorf("expected regional translation, got %q", got)
+	}
+	if got := pt.T("welcome", "Ana"); got != "Bem-vindo, Ana!" {
+		t.Errorf("expected base language translation, got %q", got)
+	}
+	if got := pt.T("bye"); got != "Goodbye" {
+		t.Errorf("expected default locale translation, got %q", got)
+	}
+	if got := pt.T("missing"); got != "missing" {
+		t.Errorf("expected missing translations to return the key, got %q", got)
+	}
+	if got := pt.T("missing", "Ana", 2); got != "missing" {
+		t.Errorf("expected missing translations not to be formatted, got %q", got)
+	}
+	if got := pt.N("missing", 2); got != "missing" {
+		t.Errorf("expected missing plural translations not to be formatted, got %q", got)
+	}
+
+	ru := b.Localizer("ru")
+	for n, want := range map[int64]string{1: "1 яблоко", 3: "3 яблока", 5: "5 яблок", 21: "21 яблоко", 112: "112 яблок"} {
+		if got := ru.N("apples", n); got != want {
+			t.Errorf("expected %q for %d, got %q", want, n, got)
+		}
+	}
+	// Portuguese has no plural translation, so the english rules are used on the english translation.
+	if got := pt.N("apples", 0); got != "0 apples" {
+		t.Errorf("expected fallback plural, got %q", got)
+	}
+}
+
+func TestLocalizer_Formatted(t *testing.T) {
+	l := newTestBundle().Localizer("en")
+
+	text, ents, err := l.Formatted("greet", "<Bob & co>")
+	if err != nil {
+		t.Fatalf("failed to format translation: %v", err)
+	}
+	if text != "Hi <Bob & co>, see the docs" {
+		t.Errorf("unexpected text %q", text)
+	}
+	want := []gotgbot.MessageEntity{
+		{Type: "bold", Offset: 3, Length: 10},
+		{Type: "text_link", Offset: 19, Length: 8, Url: "https://example.com"},
+	}
+	if !reflect.DeepEqual(ents, want) {
+		t.Errorf("expected entities %v, got %v", want, ents)
+	}
+}
+
+type failingLocaleStore struct {
+	InMemoryLocaleStore
+}
+
+func (s *failingLocaleStore) Get(int64) (string, bool, error) {
+	return "", false, errors.New("store unavailable")
+}
+
+func TestBundle_ForContext(t *testing.T) {
+	b := newTestBundle()
+	b.Store = NewInMemoryLocaleStore()
+
+	ctx := newUserContext(&gotgbot.User{Id: 1, LanguageCode: "pt-br"})
+	if got := b.T(ctx, "hello"); got != "Oi!" {
+		t.Errorf("expected telegram language to be used, got %q", got)
+	}
+
+	if err := b.SetUserLocale(ctx, "ru"); err != nil {
+		t.Fatalf("failed to set user locale: %v", err)
+	}
+	if got := b.T(ctx, "hello"); got != "Привет!" {
+		t.Errorf("expected chosen locale to be used within the same update, got %q", got)
+	}
+	if got := b.T(newUserContext(&gotgbot.User{Id: 1, LanguageCode: "pt-br"}), "hello"); got != "Привет!" {
+		t.Errorf("expected chosen locale to override telegram language, got %q", got)
+	}
+	if got := b.N(newUserContext(&gotgbot.User{Id: 1}), "apples", 2); got != "2 яблока" {
+		t.Errorf("expected chosen locale plurals, got %q", got)
+	}
+
+	if err := b.SetUserLocale(ctx, ""); err != nil {
+		t.Fatalf("failed to reset user locale: %v", err)
+	}
+	if got := b.T(ctx, "hello"); got != "Oi!" {
+		t.Errorf("expected reset locale to be used within the same update, got %q", got)
+	}
+	if got := b.T(newUserContext(&gotgbot.User{Id: 1, LanguageCode: "pt-br"}), "hello"); got != "Oi!" {
+		t.Errorf("expected reset locale to use telegram language, got %q", got)
+	}
+
+	if got := b.T(newUserContext(nil), "hello"); got != "Hello!" {
+		t.Errorf("expected updates without users to use the default locale, got %q", got)
+	}
+
+	b.Store = &failingLocaleStore{}
+	ctx = newUserContext(&gotgbot.User{Id: 1, LanguageCode: "ru"})
+	if _, err := b.ForContext(ctx); err == nil {
+		t.Errorf("expected store errors to be returned")
+	}
+	if got := b.T(ctx, "hello"); got != "Привет!" {
+		t.Errorf("expected store errors to fall back to telegram language, got %q", got)
+	}
+}
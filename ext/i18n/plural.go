@@ -0,0 +1,293 @@
+package i18n
+
+// PluralForm is a CLDR plural category.
+// See https://cldr.unicode.org/index/cldr-spec/plural-rules for more details.
+type PluralForm string
+
+const (
+	PluralZero  PluralForm = "zero"
+	PluralOne   PluralForm = "one"
+	PluralTwo   PluralForm = "two"
+	PluralFew   PluralForm = "few"
+	PluralMany  PluralForm = "many"
+	PluralOther PluralForm = "other"
+)
+
+// PluralRule describes how a language selects plural forms for integer counts.
+type PluralRule struct {
+	// Forms lists the plural forms which Select can return, in CLDR order: zero, one, two, few, many, other.
+	// This is used to map the numbered plural translations of .po files to plural forms.
+	Forms []PluralForm
+	// Select returns the plural form to use for the count n.
+	Select func(n int64) PluralForm
+}
+
+var (
+	// ruleOther is used by languages which have no plural forms.
+	ruleOther = PluralRule{
+		Forms:  []PluralForm{PluralOther},
+		Select: func(n int64) PluralForm { return PluralOther },
+	}
+
+	// ruleOneOther is used by languages where only 1 is singular, such as english.
+	ruleOneOther = PluralRule{
+		Forms: []PluralForm{PluralOne, PluralOther},
+		Select: func(n int64) PluralForm {
+			if n == 1 {
+				return PluralOne
+			}
+			return PluralOther
+		},
+	}
+
+	// ruleZeroOneOther is used by languages where 0 and 1 are singular, such as hindi.
+	ruleZeroOneOther = PluralRule{
+		Forms: []PluralForm{PluralOne, PluralOther},
+		Select: func(n int64) PluralForm {
+			if n == 0 || n == 1 {
+				return PluralOne
+			}
+			return PluralOther
+		},
+	}
+
+	// ruleRomance is used by romance languages where 1 is singular, and round millions have their own form.
+	ruleRomance = PluralRule{
+		Forms: []PluralForm{PluralOne, PluralMany, PluralOther},
+		Select: func(n int64) PluralForm {
+			switch {
+			case n == 1:
+				return PluralOne
+			case n != 0 && n%1000000 == 0:
+				return PluralMany
+			}
+			return PluralOther
+		},
+	}
+
+	// ruleFrench is used by french and portuguese, where 0 and 1 are singular, and round millions have their own form.
+	ruleFrench = PluralRule{
+		Forms: []PluralForm{PluralOne, PluralMany, PluralOther},
+		Select: func(n int64) PluralForm {
+			switch {
+			case n == 0 || n == 1:
+				return PluralOne
+			case n%1000000 == 0:
+				return PluralMany
+			}
+			return PluralOther
+		},
+	}
+
+	// ruleEastSlavic is used by russian, ukrainian and belarusian.
+	ruleEastSlavic = PluralRule{
+		Forms: []PluralForm{PluralOne, PluralFew, PluralMany},
+		Select: func(n int64) PluralForm {
+			n10, n100 := abs(n)%10, abs(n)%100
+			switch {
+			case n10 == 1 && n100 != 11:
+				return PluralOne
+			case n10 >= 2 && n10 <= 4 && (n100 < 12 || n100 > 14):
+				return PluralFew
+			}
+			return PluralMany
+		},
+	}
+
+	// ruleSerboCroatian is used by serbian, croatian and bosnian.
+	ruleSerboCroatian = PluralRule{
+		Forms: []PluralForm{PluralOne, PluralFew, PluralOther},
+		Select: func(n int64) PluralForm {
+			n10, n100 := abs(n)%10, abs(n)%100
+			switch {
+			case n10 == 1 && n100 != 11:
+				return PluralOne
+			case n10 >= 2 && n10 <= 4 && (n100 < 12 || n100 > 14):
+				return PluralFew
+			}
+			return PluralOther
+		},
+	}
+
+	// rulePolish is used by polish.
+	rulePolish = PluralRule{
+		Forms: []PluralForm{PluralOne, PluralFew, PluralMany},
+		Select: func(n int64) PluralForm {
+			n10, n100 := abs(n)%10, abs(n)%100
+			switch {
+			case n == 1:
+				return PluralOne
+			case n10 >= 2 && n10 <= 4 && (n100 < 12 || n100 > 14):
+				return PluralFew
+			}
+			return PluralMany
+		},
+	}
+
+	// ruleCzech is used by czech and slovak.
+	ruleCzech = PluralRule{
+		Forms: []PluralForm{PluralOne, PluralFew, PluralOther},
+		Select: func(n int64) PluralForm {
+			switch {
+			case n == 1:
+				return PluralOne
+			case n >= 2 && n <= 4:
+				return PluralFew
+			}
+			return PluralOther
+		},
+	}
+
+	// ruleArabic is used by arabic.
+	ruleArabic = PluralRule{
+		Forms: []PluralForm{PluralZero, PluralOne, PluralTwo, PluralFew, PluralMany, PluralOther},
+		Select: func(n int64) PluralForm {
+			n100 := abs(n) % 100
+			switch {
+			case n == 0:
+				return PluralZero
+			case n == 1:
+				return PluralOne
+			case n == 2:
+				return PluralTwo
+			case n100 >= 3 && n100 <= 10:
+				return PluralFew
+			case n100 >= 11:
+				return PluralMany
+			}
+			return PluralOther
+		},
+	}
+
+	// ruleHebrew is used by hebrew.
+	ruleHebrew = PluralRule{
+		Forms: []PluralForm{PluralOne, PluralTwo, PluralOther},
+		Select: func(n int64) PluralForm {
+			switch n {
+			case 1:
+				return PluralOne
+			case 2:
+				return PluralTwo
+			}
+			return PluralOther
+		},
+	}
+
+	// ruleLithuanian is used by lithuanian.
+	ruleLithuanian = PluralRule{
+		Forms: []PluralForm{PluralOne, PluralFew, PluralOther},
+		Select: func(n int64) PluralForm {
+			n10, n100 := abs(n)%10, abs(n)%100
+			switch {
+			case n100 >= 11 && n100 <= 19:
+				return PluralOther
+			case n10 == 1:
+				return PluralOne
+			case n10 >= 2:
+				return PluralFew
+			}
+			return PluralOther
+		},
+	}
+
+	// ruleLatvian is used by latvian.
+	ruleLatvian = PluralRule{
+		Forms: []PluralForm{PluralZero, PluralOne, PluralOther},
+		Select: func(n int64) PluralForm {
+			n10, n100 := abs(n)%10, abs(n)%100
+			switch {
+			case n10 == 0 || (n100 >= 11 && n100 <= 19):
+				return PluralZero
+			case n10 == 1:
+				return PluralOne
+			}
+			return PluralOther
+		},
+	}
+
+	// ruleRomanian is used by romanian and moldavian.
+	ruleRomanian = PluralRule{
+		Forms: []PluralForm{PluralOne, PluralFew, PluralOther},
+		Select: func(n int64) PluralForm {
+			n100 := abs(n) % 100
+			switch {
+			case n == 1:
+				return PluralOne
+			case n == 0 || (n100 >= 2 && n100 <= 19):
+				return PluralFew
+			}
+			return PluralOther
+		},
+	}
+
+	// ruleSlovenian is used by slovenian.
+	ruleSlovenian = PluralRule{
+		Forms: []PluralForm{PluralOne, PluralTwo, PluralFew, PluralOther},
+		Select: func(n int64) PluralForm {
+			switch abs(n) % 100 {
+			case 1:
+				return PluralOne
+			case 2:
+				return PluralTwo
+			case 3, 4:
+				return PluralFew
+			}
+			return PluralOther
+		},
+	}
+)
+
+// pluralRules maps base language codes to their CLDR plural rules.
+// Languages which aren't listed here use ruleOneOther.
+var pluralRules = map[string]PluralRule{
+	"ar": ruleArabic,
+	"be": ruleEastSlavic,
+	"bn": ruleZeroOneOther,
+	"bs": ruleSerboCroatian,
+	"ca": ruleRomance,
+	"cs": ruleCzech,
+	"es": ruleRomance,
+	"fa": ruleZeroOneOther,
+	"fr": ruleFrench,
+	"he": ruleHebrew,
+	"hi": ruleZeroOneOther,
+	"hr": ruleSerboCroatian,
+	"id": ruleOther,
+	"it": ruleRomance,
+	"ja": ruleOther,
+	"km": ruleOther,
+	"ko": ruleOther,
+	"lo": ruleOther,
+	"lt": ruleLithuanian,
+	"lv": ruleLatvian,
+	"mo": ruleRomanian,
+	"ms": ruleOther,
+	"my": ruleOther,
+	"pl": rulePolish,
+	"pt": ruleFrench,
+	"ro": ruleRomanian,
+	"ru": ruleEastSlavic,
+	"sk": ruleCzech,
+	"sl": ruleSlovenian,
+	"sr": ruleSerboCroatian,
+	"th": ruleOther,
+	"uk": ruleEastSlavic,
+	"vi": ruleOther,
+	"zh": ruleOther,
+}
+
+// DefaultPluralRule returns the built-in CLDR plural rule for the given locale. Only the base language is used; for
+// example, "pt-br" uses the rule for "pt". Unknown languages default to english-style plurals: one and other.
+func DefaultPluralRule(locale string) PluralRule {
+	if rule, ok := pluralRules[baseLanguage(normalizeLocale(locale))]; ok {
+		return rule
+	}
+	return ruleOneOther
+}
+
+func abs(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
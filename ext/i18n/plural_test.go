@@ -0,0 +1,27 @@
+package i18n
+
+import (
+	"testing"
+)
+
+func TestDefaultPluralRule(t *testing.T) {
+	for locale, want := range map[string]map[int64]PluralForm{
+		"en":    {0: PluralOther, 1: PluralOne, 2: PluralOther},
+		"fr":    {0: PluralOne, 1: PluralOne, 2: PluralOther, 1000000: PluralMany},
+		"pt-br": {0: PluralOne, 1: PluralOne, 2: PluralOther},
+		"ja":    {1: PluralOther, 2: PluralOther},
+		"ru":    {1: PluralOne, 2: PluralFew, 5: PluralMany, 11: PluralMany, 21: PluralOne, 22: PluralFew, 111: PluralMany},
+		"pl":    {1: PluralOne, 2: PluralFew, 5: PluralMany, 21: PluralMany, 22: PluralFew},
+		"cs":    {1: PluralOne, 3: PluralFew, 5: PluralOther},
+		"ar":    {0: PluralZero, 1: PluralOne, 2: PluralTwo, 3: PluralFew, 11: PluralMany, 100: PluralOther},
+		"lv":    {0: PluralZero, 1: PluralOne, 2: PluralOther, 11: PluralZero, 21: PluralOne},
+		"xx":    {1: PluralOne, 2: PluralOther},
+	} {
+		rule := DefaultPluralRule(locale)
+		for n, form := range want {
+			if got := rule.Select(n); got != form {
+				t.Errorf("%s: expected %s for %d, got %s", locale, form, n, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package i18n
+
+import (
+	"sync"
+)
+
+// LocaleStore stores the locales which users have explicitly chosen, overriding their telegram language.
+type LocaleStore interface {
+	// Get returns the locale chosen by the user, if any.
+	Get(userId int64) (string, bool, error)
+	// Set stores the locale chosen by the user.
+	Set(userId int64, locale string) error
+	// Delete removes the locale chosen by the user, reverting to their telegram language.
+	Delete(userId int64) error
+}
+
+// InMemoryLocaleStore is a thread-safe in-memory implementation of the LocaleStore interface.
+type InMemoryLocaleStore struct {
+	// locales maps user IDs to their chosen locales.
+	locales map[int64]string
+	// lock allows us to ensure synchronous data access.
+	lock sync.RWMutex
+}
+
+var _ LocaleStore = &InMemoryLocaleStore{}
+
+func NewInMemoryLocaleStore() *InMemoryLocaleStore {
+	return &InMemoryLocaleStore{
+		locales: map[int64]string{},
+	}
+}
+
+func (s *InMemoryLocaleStore) Get(userId int64) (string, bool, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	locale, ok := s.locales[userId]
+	return locale, ok, nil
+}
+
+func (s *InMemoryLocaleStore) Set(userId int64, locale string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.locales == nil {
+		s.locales = map[int64]string{}
+	}
+	s.locales[userId] = locale
+	return nil
+}
+
+func (s *InMemoryLocaleStore) Delete(userId int64) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delete(s.locales, userId)
+	return nil
+}
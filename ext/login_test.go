@@ -0,0 +1,86 @@
+package ext
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func newLoginQuery(t *testing.T, token string, authDate time.Time) url.Values {
+	t.Helper()
+
+	query := url.Values{}
+	query.Set("id", "12345")
+	query.Set("first_name", "John")
+	query.Set("username", "MrSmith")
+	query.Set("photo_url", "https://t.me/i/userpic/320/MrSmith.jpg")
+	query.Set("auth_date", strconv.FormatInt(authDate.Unix(), 10))
+
+	secretKey, err := getSHA256(token)
+	if err != nil {
+		t.Fatalf("failed to hash token: %v", err)
+	}
+	signQuery(t, query, secretKey)
+	return query
+}
+
+func TestParseLoginQuery(t *testing.T) {
+	now := time.Now()
+	u, err := ParseLoginQuery(newLoginQuery(t, "test_token", now), "test_token", time.Hour)
+	if err != nil {
+		t.Fatalf("failed to parse login query: %v", err)
+	}
+	if u.Id != 12345 || u.FirstName != "John" || u.Username != "MrSmith" || u.AuthDate != now.Unix() {
+		t.Errorf("unexpected login user: %+v", u)
+	}
+
+	if _, err = ParseLoginQuery(newLoginQuery(t, "test_token", now), "invalid_token", 0); !errors.Is(err, ErrInvalidQueryHash) {
+		t.Errorf("expected invalid hash error, got %v", err)
+	}
+
+	old := newLoginQuery(t, "test_token", now.Add(-2*time.Hour))
+	if _, err = ParseLoginQuery(old, "test_token", time.Hour); !errors.Is(err, ErrExpiredAuthDate) {
+		t.Errorf("expected expired auth date error, got %v", err)
+	}
+}
+
+func TestLoginHandler(t *testing.T) {
+	h := NewLoginHandler("test_token", func(w http.ResponseWriter, r *http.Request, u *LoginUser) {
+		http.Redirect(w, r, "/home?user="+strconv.FormatInt(u.Id, 10), http.StatusFound)
+	}, &LoginHandlerOpts{MaxAge: time.Hour})
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/login?"+newLoginQuery(t, "test_token", time.Now()).Encode(), nil))
+	if rec.Code != http.StatusFound || rec.Header().Get("Location") != "/home?user=12345" {
+		t.Errorf("expected valid login to redirect, got %d to %q", rec.Code, rec.Header().Get("Location"))
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/login?"+newLoginQuery(t, "test_token", time.Now().Add(-2*time.Hour)).Encode(), nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected expired login to be rejected, got %d", rec.Code)
+	}
+}
+
+func TestLoginHandlerDefaultMaxAge(t *testing.T) {
+	onLogin := func(w http.ResponseWriter, r *http.Request, u *LoginUser) {
+		w.WriteHeader(http.StatusOK)
+	}
+	old := newLoginQuery(t, "test_token", time.Now().Add(-DefaultLoginMaxAge-time.Hour)).Encode()
+
+	rec := httptest.NewRecorder()
+	NewLoginHandler("test_token", onLogin, nil).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/login?"+old, nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected logins older than the default max age to be rejected, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	NewLoginHandler("test_token", onLogin, &LoginHandlerOpts{MaxAge: -1}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/login?"+old, nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected age check to be skipped with a negative max age, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,471 @@
+// Package menu provides navigable inline keyboard menus, which are edited in place as the user opens submenus and
+// goes back.
+//
+// A menu tree is declared once, and rendered for each user when shown; buttons can have dynamic text, and be hidden
+// for some users. The current position in the tree is encoded in the callback data of each button, using a
+// callbackdata.Codec.
+package menu
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/callbackdata"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers"
+)
+
+// DefaultCallbackPrefix is the default callback data prefix of menu buttons.
+const DefaultCallbackPrefix = "menu:"
+
+// DefaultBackText is the default text of the button which returns to the parent menu.
+const DefaultBackText = "« Back"
+
+const (
+	// answerDataKey is the ext.Context.Data key used to store the answer to the current callback query.
+	answerDataKey = "menu.answer"
+
+	// navigateAction is the callback payload action used to open a menu.
+	navigateAction = "nav"
+	// pressAction is the callback payload action used to press an action button.
+	pressAction = "btn"
+	// pathParam is the callback payload parameter holding the path of the menu.
+	pathParam = "p"
+	// buttonParam is the callback payload parameter holding the ID of the pressed button.
+	buttonParam = "b"
+	// pathSeparator separates the menu IDs of a path.
+	pathSeparator = "/"
+)
+
+var ErrInvalidMenu = errors.New("invalid menu")
+
+// Menu is a message with an inline keyboard, which can open submenus, run actions, and link to URLs.
+type Menu struct {
+	// Id identifies the menu in callback data. It must be unique amongst the submenus of its parent, and shouldn't be
+	// too long, since the IDs of all parent menus are included in the callback data.
+	Id string
+	// Text is the text of the menu message.
+	Text string
+	// TextFunc generates the text of the menu message for the current user. If set, Text is ignored.
+	TextFunc func(b *gotgbot.Bot, ctx *ext.Context) (string, error)
+	// ParseMode is the parse mode of the menu text.
+	ParseMode string
+	// Columns is the maximum number of buttons per row, after which buttons wrap to a new row. If 0, buttons only
+	// wrap when Row is called.
+	Columns int
+	// BackText is the text of the button which returns to the parent menu. Defaults to DefaultBackText.
+	BackText string
+
+	// rows holds the buttons of the menu, row by row.
+	rows [][]Button
+}
+
+// Button is a menu button. Exactly one of Submenu, Action or Url should be set.
+type Button struct {
+	// Id identifies action buttons in callback data. It must be unique within the menu.
+	Id string
+	// Text is the text of the button.
+	Text string
+	// TextFunc generates the text of the button for the current user. If set, Text is ignored.
+	TextFunc func(b *gotgbot.Bot, ctx *ext.Context) string
+	// Visible determines whether the button is shown to the current user. If nil, the button is always shown.
+	Visible func(b *gotgbot.Bot, ctx *ext.Context) bool
+
+	// Submenu is opened when the button is pressed.
+	Submenu *Menu
+	// Action is called when the button is pressed. The menu is rendered again once it returns, so that any changes
+	// are shown. Use Answer to show a notification to the user.
+	Action handlers.Response
+	// Url is opened when the button is pressed.
+	Url string
+}
+
+// New creates a new Menu with a static text.
+func New(id string, text string) *Menu {
+	return &Menu{
+		Id:   id,
+		Text: text,
+	}
+}
+
+// Add adds a button to the current row.
+func (m *Menu) Add(btn Button) *Menu {
+	if len(m.rows) == 0 {
+		m.rows = append(m.rows, nil)
+	}
+	m.rows[len(m.rows)-1] = append(m.rows[len(m.rows)-1], btn)
+	return m
+}
+
+// Row starts a new row of buttons.
+func (m *Menu) Row() *Menu {
+	if len(m.rows) > 0 && len(m.rows[len(m.rows)-1]) > 0 {
+		m.rows = append(m.rows, nil)
+	}
+	return m
+}
+
+// Submenu adds a button which opens a submenu.
+func (m *Menu) Submenu(text string, sub *Menu) *Menu {
+	return m.Add(Button{Text: text, Submenu: sub})
+}
+
+// Action adds a button which calls the given action when pressed.
+func (m *Menu) Action(id string, text string, action handlers.Response) *Menu {
+	return m.Add(Button{Id: id, Text: text, Action: action})
+}
+
+// Url adds a button which opens a URL.
+func (m *Menu) Url(text string, url string) *Menu {
+	return m.Add(Button{Text: text, Url: url})
+}
+
+func (m *Menu) text(b *gotgbot.Bot, ctx *ext.Context) (string, error) {
+	if m.TextFunc != nil {
+		return m.TextFunc(b, ctx)
+	}
+	return m.Text, nil
+}
+
+// button returns the action button with the given ID.
+func (m *Menu) button(id string) (Button, bool) {
+	for _, row := range m.rows {
+		for _, btn := range row {
+			if btn.Action != nil && btn.Id == id {
+				return btn, true
+			}
+		}
+	}
+	return Button{}, false
+}
+
+// submenuButton returns the button opening the submenu with the given ID.
+func (m *Menu) submenuButton(id string) (Button, bool) {
+	for _, row := range m.rows {
+		for _, btn := range row {
+			if btn.Submenu != nil && btn.Submenu.Id == id {
+				return btn, true
+			}
+		}
+	}
+	return Button{}, false
+}
+
+func (btn Button) text(b *gotgbot.Bot, ctx *ext.Context) string {
+	if btn.TextFunc != nil {
+		return btn.TextFunc(b, ctx)
+	}
+	return btn.Text
+}
+
+func (btn Button) visible(b *gotgbot.Bot, ctx *ext.Context) bool {
+	return btn.Visible == nil || btn.Visible(b, ctx)
+}
+
+// Answer sets the answer to the callback query of the current menu action, to show a notification or alert to the
+// user. Callback queries are answered automatically once the action returns; by default, without any text.
+func Answer(ctx *ext.Context, opts *gotgbot.AnswerCallbackQueryOpts) {
+	ctx.Data[answerDataKey] = opts
+}
+
+// Manager renders a menu tree, and handles the callback queries of its buttons.
+type Manager struct {
+	// Root is the top-level menu.
+	Root *Menu
+	// Codec encodes the callback data of menu buttons. Setting a Store allows for deeply nested menus, whose paths
+	// don't fit in callback data; setting a Secret stops users from forging callback data.
+	Codec callbackdata.Codec
+
+	// menus maps menu paths to their menus.
+	menus map[string]*Menu
+}
+
+// NewManager checks the menu tree, and creates a Manager for it. The menu tree must not be changed afterwards.
+func NewManager(root *Menu) (*Manager, error) {
+	if root == nil {
+		return nil, fmt.Errorf("%w: no root menu", ErrInvalidMenu)
+	}
+
+	m := &Manager{
+		Root:  root,
+		Codec: callbackdata.Codec{Prefix: DefaultCallbackPrefix},
+		menus: map[string]*Menu{},
+	}
+	if err := m.addMenu(root, root.Id, map[*Menu]bool{}); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// addMenu checks a menu and all its submenus, and adds them to the menu paths.
+func (m *Manager) addMenu(menu *Menu, path string, parents map[*Menu]bool) error {
+	if menu.Id == "" || strings.Contains(menu.Id, pathSeparator) {
+		return fmt.Errorf("%w: menu ID %q must be non-empty, and not contain %q", ErrInvalidMenu, menu.Id, pathSeparator)
+	}
+	if parents[menu] {
+		return fmt.Errorf("%w: menu %q contains itself", ErrInvalidMenu, path)
+	}
+	parents[menu] = true
+	defer delete(parents, menu)
+
+	m.menus[path] = menu
+
+	submenus := map[string]bool{}
+	actions := map[string]bool{}
+	for _, row := range menu.rows {
+		for _, btn := range row {
+			switch {
+			case btn.Submenu != nil:
+				if submenus[btn.Submenu.Id] {
+					return fmt.Errorf("%w: duplicate submenu ID %q in menu %q", ErrInvalidMenu, btn.Submenu.Id, path)
+				}
+				submenus[btn.Submenu.Id] = true
+				if err := m.addMenu(btn.Submenu, path+pathSeparator+btn.Submenu.Id, parents); err != nil {
+					return err
+				}
+
+			case btn.Action != nil:
+				if btn.Id == "" || actions[btn.Id] {
+					return fmt.Errorf("%w: action button IDs must be non-empty and unique, got %q in menu %q", ErrInvalidMenu, btn.Id, path)
+				}
+				actions[btn.Id] = true
+
+			case btn.Url == "":
+				return fmt.Errorf("%w: button %q in menu %q has no submenu, action or URL", ErrInvalidMenu, btn.Text, path)
+			}
+		}
+	}
+	return nil
+}
+
+// Send sends the root menu to the given chat. Only the ParseMode and ReplyMarkup of the opts are overwritten.
+func (m *Manager) Send(b *gotgbot.Bot, ctx *ext.Context, chatId int64, opts *gotgbot.SendMessageOpts) (*gotgbot.Message, error) {
+	text, markup, err := m.render(b, ctx, m.Root.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	var sendOpts gotgbot.SendMessageOpts
+	if opts != nil {
+		sendOpts = *opts
+	}
+	sendOpts.ParseMode = m.Root.ParseMode
+	sendOpts.ReplyMarkup = nil
+	if markup != nil {
+		sendOpts.ReplyMarkup = *markup
+	}
+	return b.SendMessage(chatId, text, &sendOpts)
+}
+
+// Handler returns the handler for the callback queries sent by menu buttons. The handler uses the Manager's current
+// Codec for every update, so the Codec can also be changed after calling Handler. Callback queries are always answered;
+// those for menus which no longer exist, or which can't be decoded, are answered without changing the message.
+func (m *Manager) Handler() ext.Handler {
+	return managerHandler{m: m}
+}
+
+// managerHandler handles the callback queries of a Manager's buttons.
+type managerHandler struct {
+	m *Manager
+}
+
+func (h managerHandler) CheckUpdate(b *gotgbot.Bot, ctx *ext.Context) bool {
+	return h.router().CheckUpdate(b, ctx)
+}
+
+func (h managerHandler) HandleUpdate(b *gotgbot.Bot, ctx *ext.Context) error {
+	return h.router().HandleUpdate(b, ctx)
+}
+
+func (h managerHandler) Name() string {
+	return fmt.Sprintf("menu_%p", h.m)
+}
+
+// router creates the CallbackRouter for the Manager's current Codec.
+func (h managerHandler) router() *handlers.CallbackRouter {
+	router := handlers.NewCallbackRouter(h.m.Codec).
+		On(navigateAction, answered(h.m.navigate)).
+		On(pressAction, answered(h.m.press))
+	router.Invalid = answered(func(b *gotgbot.Bot, ctx *ext.Context) error {
+		return nil
+	})
+	return router
+}
+
+// navigate opens the menu requested by the current callback query.
+func (m *Manager) navigate(b *gotgbot.Bot, ctx *ext.Context) error {
+	path := handlers.CallbackPayload(ctx).Get(pathParam)
+	if !m.canOpen(b, ctx, path) {
+		return nil
+	}
+	return m.edit(b, ctx, path)
+}
+
+// press calls the action of the button pressed in the current callback query, and renders the menu again.
+func (m *Manager) press(b *gotgbot.Bot, ctx *ext.Context) error {
+	payload := handlers.CallbackPayload(ctx)
+	path := payload.Get(pathParam)
+	if !m.canOpen(b, ctx, path) {
+		return nil
+	}
+
+	btn, ok := m.menus[path].button(payload.Get(buttonParam))
+	if !ok || !btn.visible(b, ctx) {
+		return nil
+	}
+
+	if err := btn.Action(b, ctx); err != nil {
+		return err
+	}
+	return m.edit(b, ctx, path)
+}
+
+// canOpen checks that the menu at the given path exists, and that the current user can see all the buttons leading to
+// it; this stops users from opening hidden menus by reusing old callback data.
+func (m *Manager) canOpen(b *gotgbot.Bot, ctx *ext.Context, path string) bool {
+	if _, ok := m.menus[path]; !ok {
+		return false
+	}
+
+	ids := strings.Split(path, pathSeparator)
+	menu := m.Root
+	for _, id := range ids[1:] {
+		btn, ok := menu.submenuButton(id)
+		if !ok || !btn.visible(b, ctx) {
+			return false
+		}
+		menu = btn.Submenu
+	}
+	return true
+}
+
+// edit renders the menu at the given path in the message of the current callback query.
+func (m *Manager) edit(b *gotgbot.Bot, ctx *ext.Context, path string) error {
+	text, markup, err := m.render(b, ctx, path)
+	if err != nil {
+		return err
+	}
+
+	cq := ctx.CallbackQuery
+	if markup == nil {
+		err = editWithoutKeyboard(b, cq, text, m.menus[path].ParseMode)
+	} else {
+		opts := &gotgbot.EditMessageTextOpts{
+			ParseMode:   m.menus[path].ParseMode,
+			ReplyMarkup: *markup,
+		}
+		if cq.Message != nil {
+			opts.ChatId = cq.Message.Chat.Id
+			opts.MessageId = cq.Message.MessageId
+		} else {
+			opts.InlineMessageId = cq.InlineMessageId
+		}
+		_, _, err = b.EditMessageText(text, opts)
+	}
+	if err != nil && !isNotModifiedError(err) {
+		return fmt.Errorf("failed to edit menu message: %w", err)
+	}
+	return nil
+}
+
+// editWithoutKeyboard edits the text of the callback query's message, and removes its keyboard. Bot.EditMessageText
+// always sends a reply_markup, so the request is made directly to leave it out.
+func editWithoutKeyboard(b *gotgbot.Bot, cq *gotgbot.CallbackQuery, text string, parseMode string) error {
+	params := map[string]string{
+		"text":       text,
+		"parse_mode": parseMode,
+	}
+	if cq.Message != nil {
+		params["chat_id"] = strconv.FormatInt(cq.Message.Chat.Id, 10)
+		params["message_id"] = strconv.FormatInt(cq.Message.MessageId, 10)
+	} else {
+		params["inline_message_id"] = cq.InlineMessageId
+	}
+
+	_, err := b.Request("editMessageText", params, nil, nil)
+	return err
+}
+
+// render generates the text and keyboard of the menu at the given path, for the current user. The keyboard is nil if
+// no buttons are visible.
+func (m *Manager) render(b *gotgbot.Bot, ctx *ext.Context, path string) (string, *gotgbot.InlineKeyboardMarkup, error) {
+	menu := m.menus[path]
+	text, err := menu.text(b, ctx)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to get text of menu %q: %w", path, err)
+	}
+
+	kb := gotgbot.NewInlineKeyboardBuilder()
+	for _, row := range menu.rows {
+		kb.Columns(menu.Columns).Row()
+		for _, btn := range row {
+			if !btn.visible(b, ctx) {
+				continue
+			}
+
+			kbBtn := gotgbot.InlineKeyboardButton{Text: btn.text(b, ctx), Url: btn.Url}
+			switch {
+			case btn.Submenu != nil:
+				kbBtn.CallbackData, err = m.Codec.Encode(callbackdata.NewPayload(navigateAction).
+					Set(pathParam, path+pathSeparator+btn.Submenu.Id))
+			case btn.Action != nil:
+				kbBtn.CallbackData, err = m.Codec.Encode(callbackdata.NewPayload(pressAction).
+					Set(pathParam, path).
+					Set(buttonParam, btn.Id))
+			}
+			if err != nil {
+				return "", nil, fmt.Errorf("failed to encode button %q of menu %q: %w", kbBtn.Text, path, err)
+			}
+			kb.Button(kbBtn)
+		}
+	}
+
+	if idx := strings.LastIndex(path, pathSeparator); idx >= 0 {
+		backText := menu.BackText
+		if backText == "" {
+			backText = DefaultBackText
+		}
+		data, err := m.Codec.Encode(callbackdata.NewPayload(navigateAction).Set(pathParam, path[:idx]))
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to encode back button of menu %q: %w", path, err)
+		}
+		kb.Columns(0).Row().Callback(backText, data)
+	}
+
+	rows := kb.Rows()
+	if len(rows) == 0 {
+		// Menus without any visible buttons are sent without a keyboard.
+		return text, nil, nil
+	}
+
+	markup, err := kb.Build()
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to build keyboard of menu %q: %w", path, err)
+	}
+	return text, &markup, nil
+}
+
+// answered wraps a response to always answer the current callback query once it returns, with the answer set by
+// Answer, if any. Errors from the response take precedence over answering errors.
+func answered(r handlers.Response) handlers.Response {
+	return func(b *gotgbot.Bot, ctx *ext.Context) error {
+		err := r(b, ctx)
+
+		opts, _ := ctx.Data[answerDataKey].(*gotgbot.AnswerCallbackQueryOpts)
+		if _, answerErr := ctx.CallbackQuery.Answer(b, opts); answerErr != nil && err == nil {
+			return fmt.Errorf("failed to answer menu callback query: %w", answerErr)
+		}
+		return err
+	}
+}
+
+// isNotModifiedError checks whether telegram refused an edit because the message is unchanged; for example, because
+// the same button was pressed twice.
+func isNotModifiedError(err error) bool {
+	var tgErr *gotgbot.TelegramError
+	return errors.As(err, &tgErr) && tgErr.Code == 400 &&
+		strings.Contains(strings.ToLower(tgErr.Description), "message is not modified")
+}
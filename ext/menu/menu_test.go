@@ -0,0 +1,277 @@
+package menu
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/callbackdata"
+)
+
+// request is an API request received by the test server.
+type request struct {
+	method string
+	params map[string]string
+}
+
+// newTestBot creates a bot which records its requests. Edits fail with "message is not modified" if notModified is set.
+func newTestBot(t *testing.T, requests *[]request, notModified *bool) *gotgbot.Bot {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		params := map[string]string{}
+		if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+		method := path.Base(r.URL.Path)
+		*requests = append(*requests, request{method: method, params: params})
+
+		switch {
+		case method == "editMessageText" && *notModified:
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"ok": false, "error_code": 400, "description": "Bad Request: message is not modified"}`))
+		case method == "answerCallbackQuery":
+			_, _ = w.Write([]byte(`{"ok": true, "result": true}`))
+		default:
+			_, _ = w.Write([]byte(`{"ok": true, "result": {"message_id": 10, "chat": {"id": 1, "type": "private"}}}`))
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	return &gotgbot.Bot{
+		User: gotgbot.User{Id: 100, IsBot: true, Username: "gotgbot"},
+		BotClient: &gotgbot.BaseBotClient{
+			Token:              "token",
+			DefaultRequestOpts: &gotgbot.RequestOpts{APIURL: server.URL},
+		},
+	}
+}
+
+func newCallbackQuery(userId int64, data string) *ext.Context {
+	return ext.NewContext(&gotgbot.Update{
+		CallbackQuery: &gotgbot.CallbackQuery{
+			Id:   "cq",
+			From: gotgbot.User{Id: userId},
+			Message: &gotgbot.Message{
+				MessageId: 10,
+				Chat:      gotgbot.Chat{Id: 1, Type: "private"},
+			},
+			Data: data,
+		},
+	}, nil)
+}
+
+func keyboard(t *testing.T, req request) [][]gotgbot.InlineKeyboardButton {
+	var markup gotgbot.InlineKeyboardMarkup
+	if err := json.Unmarshal([]byte(req.params["reply_markup"]), &markup); err != nil {
+		t.Fatalf("failed to decode keyboard: %v", err)
+	}
+	return markup.InlineKeyboard
+}
+
+func buttonTexts(rows [][]gotgbot.InlineKeyboardButton) string {
+	var texts []string
+	for _, row := range rows {
+		var rowTexts []string
+		for _, btn := range row {
+			rowTexts = append(rowTexts, btn.Text)
+		}
+		texts = append(texts, strings.Join(rowTexts, ","))
+	}
+	return strings.Join(texts, "|")
+}
+
+func TestManager(t *testing.T) {
+	var requests []request
+	var notModified bool
+	b := newTestBot(t, &requests, &notModified)
+
+	notifications := map[int64]bool{}
+	settings := New("settings", "Settings").
+		Add(Button{
+			Id: "notify",
+			TextFunc: func(b *gotgbot.Bot, ctx *ext.Context) string {
+				if notifications[ctx.EffectiveUser.Id] {
+					return "Notifications: on"
+				}
+				return "Notifications: off"
+			},
+			Action: func(b *gotgbot.Bot, ctx *ext.Context) error {
+				notifications[ctx.EffectiveUser.Id] = !notifications[ctx.EffectiveUser.Id]
+				Answer(ctx, &gotgbot.AnswerCallbackQueryOpts{Text: "Saved"})
+				return nil
+			},
+		})
+	admin := New("admin", "Admin")
+	admin.Action("fail", "Fail", func(b *gotgbot.Bot, ctx *ext.Context) error {
+		return errors.New("action failed")
+	})
+	root := New("main", "Main menu").
+		Submenu("Settings", settings).
+		Add(Button{
+			Text:    "Admin",
+			Submenu: admin,
+			Visible: func(b *gotgbot.Bot, ctx *ext.Context) bool { return ctx.EffectiveUser.Id == 1 },
+		}).
+		Row().
+		Url("Help", "https://example.com")
+
+	m, err := NewManager(root)
+	if err != nil {
+		t.Fatalf("failed to create menu manager: %v", err)
+	}
+	m.Codec.Secret = []byte("secret")
+	h := m.Handler()
+
+	// Buttons can be hidden per user.
+	if _, err := m.Send(b, newCallbackQuery(2, ""), 1, nil); err != nil {
+		t.Fatalf("failed to send menu: %v", err)
+	}
+	if got := buttonTexts(keyboard(t, requests[0])); got != "Settings|Help" {
+		t.Errorf("unexpected root keyboard for user 2: %s", got)
+	}
+	if _, err := m.Send(b, newCallbackQuery(1, ""), 1, nil); err != nil {
+		t.Fatalf("failed to send menu: %v", err)
+	}
+	rootKeyboard := keyboard(t, requests[1])
+	if got := buttonTexts(rootKeyboard); got != "Settings,Admin|Help" {
+		t.Fatalf("unexpected root keyboard for user 1: %s", got)
+	}
+
+	// handle simulates pressing a button, and returns the requests it sent.
+	handle := func(userId int64, data string) ([]request, error) {
+		requests = nil
+		ctx := newCallbackQuery(userId, data)
+		if !h.CheckUpdate(b, ctx) {
+			t.Fatalf("expected callback data %q to be handled", data)
+		}
+		err := h.HandleUpdate(b, ctx)
+		return requests, err
+	}
+
+	// Open the settings submenu.
+	reqs, err := handle(1, rootKeyboard[0][0].CallbackData)
+	if err != nil {
+		t.Fatalf("failed to open submenu: %v", err)
+	}
+	if len(reqs) != 2 || reqs[0].method != "editMessageText" || reqs[1].method != "answerCallbackQuery" {
+		t.Fatalf("expected the message to be edited and the callback answered, got %+v", reqs)
+	}
+	if reqs[0].params["text"] != "Settings" || reqs[0].params["message_id"] != "10" {
+		t.Errorf("unexpected edit %+v", reqs[0].params)
+	}
+	settingsKeyboard := keyboard(t, reqs[0])
+	if got := buttonTexts(settingsKeyboard); got != "Notifications: off|« Back" {
+		t.Fatalf("unexpected settings keyboard: %s", got)
+	}
+
+	// Press the dynamic button; the menu is rendered again, and the answer is sent.
+	reqs, err = handle(1, settingsKeyboard[0][0].CallbackData)
+	if err != nil {
+		t.Fatalf("failed to press button: %v", err)
+	}
+	if got := buttonTexts(keyboard(t, reqs[0])); got != "Notifications: on|« Back" {
+		t.Errorf("expected the menu to be rendered again, got %s", got)
+	}
+	if reqs[1].params["text"] != "Saved" {
+		t.Errorf("expected the answer to be sent, got %+v", reqs[1].params)
+	}
+
+	// Unchanged menus don't cause errors.
+	notModified = true
+	if _, err = handle(1, settingsKeyboard[1][0].CallbackData); err != nil {
+		t.Errorf("expected unmodified messages to be ignored, got %v", err)
+	}
+	notModified = false
+
+	// Buttons of hidden submenus can't be pressed, even with valid callback data.
+	reqs, err = handle(1, rootKeyboard[0][1].CallbackData)
+	if err != nil {
+		t.Fatalf("failed to open admin menu: %v", err)
+	}
+	failData := keyboard(t, reqs[0])[0][0].CallbackData
+	if reqs, err = handle(2, failData); err != nil || len(reqs) != 1 || reqs[0].method != "answerCallbackQuery" {
+		t.Errorf("expected hidden button press to only be answered, got %+v (%v)", reqs, err)
+	}
+
+	// Action errors are returned, but the callback query is still answered.
+	if reqs, err = handle(1, failData); err == nil || len(reqs) != 1 || reqs[0].method != "answerCallbackQuery" {
+		t.Errorf("expected action error and answer, got %+v (%v)", reqs, err)
+	}
+
+	// Tampered callback data is answered without changes.
+	if reqs, err = handle(1, DefaultCallbackPrefix+"nav;p=main/admin"); err != nil || len(reqs) != 1 || reqs[0].method != "answerCallbackQuery" {
+		t.Errorf("expected tampered data to only be answered, got %+v (%v)", reqs, err)
+	}
+}
+
+func TestNewManager_invalid(t *testing.T) {
+	sub := New("sub", "Sub")
+	cyclic := New("cyclic", "Cyclic")
+	cyclic.Submenu("Self", cyclic)
+
+	for name, root := range map[string]*Menu{
+		"no root":            nil,
+		"empty ID":           New("", "Root"),
+		"ID with separator":  New("a/b", "Root"),
+		"duplicate submenus": New("root", "Root").Submenu("A", sub).Submenu("B", sub),
+		"duplicate actions":  New("root", "Root").Action("a", "A", func(*gotgbot.Bot, *ext.Context) error { return nil }).Action("a", "B", func(*gotgbot.Bot, *ext.Context) error { return nil }),
+		"button without use": New("root", "Root").Add(Button{Text: "Nothing"}),
+		"cycle":              cyclic,
+	} {
+		if _, err := NewManager(root); !errors.Is(err, ErrInvalidMenu) {
+			t.Errorf("%s: expected ErrInvalidMenu, got %v", name, err)
+		}
+	}
+}
+
+func TestManager_noVisibleButtons(t *testing.T) {
+	var requests []request
+	var notModified bool
+	b := newTestBot(t, &requests, &notModified)
+
+	hidden := func(b *gotgbot.Bot, ctx *ext.Context) bool { return false }
+	root := New("main", "Main menu").
+		Add(Button{Text: "Hidden", Url: "https://example.com", Visible: hidden})
+
+	m, err := NewManager(root)
+	if err != nil {
+		t.Fatalf("failed to create menu manager: %v", err)
+	}
+	h := m.Handler()
+	// The Codec can be changed after the handler is created.
+	m.Codec.Prefix = "m:"
+
+	if _, err := m.Send(b, newCallbackQuery(1, ""), 1, nil); err != nil {
+		t.Fatalf("failed to send menu: %v", err)
+	}
+	if _, ok := requests[0].params["reply_markup"]; ok {
+		t.Errorf("expected no keyboard to be sent, got %s", requests[0].params["reply_markup"])
+	}
+
+	data, err := m.Codec.Encode(callbackdata.NewPayload(navigateAction).Set(pathParam, "main"))
+	if err != nil {
+		t.Fatalf("failed to encode callback data: %v", err)
+	}
+	requests = nil
+	ctx := newCallbackQuery(1, data)
+	if !h.CheckUpdate(b, ctx) {
+		t.Fatalf("expected callback data with the new prefix to be handled")
+	}
+	if err := h.HandleUpdate(b, ctx); err != nil {
+		t.Fatalf("failed to handle callback query: %v", err)
+	}
+	if len(requests) != 2 || requests[0].method != "editMessageText" {
+		t.Fatalf("expected the message to be edited, got %+v", requests)
+	}
+	if _, ok := requests[0].params["reply_markup"]; ok {
+		t.Errorf("expected the keyboard to be removed, got %s", requests[0].params["reply_markup"])
+	}
+	if requests[0].params["text"] != "Main menu" || requests[0].params["message_id"] != "10" {
+		t.Errorf("unexpected edit %+v", requests[0].params)
+	}
+}
@@ -0,0 +1,272 @@
+// Package permissions provides cached administrator checks, to easily restrict handlers to chat admins.
+package permissions
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers"
+)
+
+// DefaultTTL is the default duration for which chat administrator lists are cached.
+const DefaultTTL = 10 * time.Minute
+
+// Predicate is a context-aware check, which can be used to restrict handlers.
+type Predicate func(b *gotgbot.Bot, ctx *ext.Context) (bool, error)
+
+// AdminCache is a thread-safe cache of chat administrators, populated with Bot.GetChatAdministrators.
+// To keep the cache up to date, add the handler returned by AdminCache.Handler to your dispatcher, and make sure to
+// request "chat_member" updates.
+type AdminCache struct {
+	// TTL is the duration for which a chat's administrators are cached.
+	TTL time.Duration
+	// TrustAnonymousAdmins determines whether anonymous admins are assumed to have all rights.
+	// Telegram doesn't tell bots who an anonymous admin is, so their rights can't be checked.
+	TrustAnonymousAdmins bool
+
+	// chats maps bot/chat keys to the cached administrators of that chat.
+	chats map[string]*chatAdmins
+	// lock allows us to ensure synchronous data access.
+	lock sync.RWMutex
+}
+
+// chatAdmins stores the cached administrators of a single chat.
+type chatAdmins struct {
+	// expiry is the time after which the admin list should be fetched again.
+	expiry time.Time
+	// admins maps user IDs to their chat member information.
+	admins map[int64]gotgbot.MergedChatMember
+}
+
+// NewAdminCache creates a new AdminCache. If ttl is 0, DefaultTTL is used.
+func NewAdminCache(ttl time.Duration) *AdminCache {
+	if ttl == 0 {
+		ttl = DefaultTTL
+	}
+
+	return &AdminCache{
+		TTL:   ttl,
+		chats: map[string]*chatAdmins{},
+	}
+}
+
+// GetAdmin returns the administrator information for a user in a chat, or nil if they are not an admin.
+func (c *AdminCache) GetAdmin(b *gotgbot.Bot, chatId int64, userId int64) (*gotgbot.MergedChatMember, error) {
+	admins, err := c.getAdmins(b, chatId)
+	if err != nil {
+		return nil, err
+	}
+
+	m, ok := admins[userId]
+	if !ok {
+		return nil, nil
+	}
+	return &m, nil
+}
+
+// IsAdmin checks whether a user is an administrator of a chat.
+func (c *AdminCache) IsAdmin(b *gotgbot.Bot, chatId int64, userId int64) (bool, error) {
+	m, err := c.GetAdmin(b, chatId, userId)
+	if err != nil {
+		return false, err
+	}
+	return m != nil, nil
+}
+
+// HasRight checks whether a user is an administrator of a chat with the given right.
+func (c *AdminCache) HasRight(b *gotgbot.Bot, chatId int64, userId int64, right string) (bool, error) {
+	m, err := c.GetAdmin(b, chatId, userId)
+	if err != nil {
+		return false, err
+	}
+	return m != nil && HasRight(*m, right), nil
+}
+
+// SenderIsAdmin checks whether the sender of the current update is an administrator of the current chat.
+// Anonymous admins and channel posts are always considered admins. Linked and anonymous channels are not.
+// Private chats have no administrators.
+func (c *AdminCache) SenderIsAdmin(b *gotgbot.Bot, ctx *ext.Context) (bool, error) {
+	return c.senderCheck(b, ctx, "")
+}
+
+// SenderHasRight returns a Predicate which checks whether the sender of the current update is an administrator of the
+// current chat, with the given right.
+// Anonymous admins are only trusted if TrustAnonymousAdmins is set.
+func (c *AdminCache) SenderHasRight(right string) Predicate {
+	return func(b *gotgbot.Bot, ctx *ext.Context) (bool, error) {
+		return c.senderCheck(b, ctx, right)
+	}
+}
+
+// BotIsAdmin checks whether the bot is an administrator of the current chat.
+func (c *AdminCache) BotIsAdmin(b *gotgbot.Bot, ctx *ext.Context) (bool, error) {
+	if !isGroupOrChannel(ctx.EffectiveChat) {
+		return false, nil
+	}
+	return c.IsAdmin(b, ctx.EffectiveChat.Id, b.Id)
+}
+
+// BotHasRight returns a Predicate which checks whether the bot is an administrator of the current chat, with the given
+// right.
+func (c *AdminCache) BotHasRight(right string) Predicate {
+	return func(b *gotgbot.Bot, ctx *ext.Context) (bool, error) {
+		if !isGroupOrChannel(ctx.EffectiveChat) {
+			return false, nil
+		}
+		return c.HasRight(b, ctx.EffectiveChat.Id, b.Id, right)
+	}
+}
+
+// Invalidate removes a chat from the cache, forcing the administrators to be fetched again on the next check.
+func (c *AdminCache) Invalidate(b *gotgbot.Bot, chatId int64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	delete(c.chats, cacheKey(b, chatId))
+}
+
+// Update updates the cached administrators of a chat from a ChatMemberUpdated event.
+// Chats which aren't currently cached are left untouched.
+func (c *AdminCache) Update(b *gotgbot.Bot, cmu *gotgbot.ChatMemberUpdated) {
+	if cmu == nil || cmu.NewChatMember == nil {
+		return
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	chat, ok := c.chats[cacheKey(b, cmu.Chat.Id)]
+	if !ok {
+		return
+	}
+
+	// The admin map is copied rather than modified, as it may still be in use by concurrent checks.
+	admins := make(map[int64]gotgbot.MergedChatMember, len(chat.admins)+1)
+	for k, v := range chat.admins {
+		admins[k] = v
+	}
+
+	m := cmu.NewChatMember.MergeChatMember()
+	if IsAdmin(m) {
+		admins[m.User.Id] = m
+	} else {
+		delete(admins, m.User.Id)
+	}
+
+	c.chats[cacheKey(b, cmu.Chat.Id)] = &chatAdmins{
+		expiry: chat.expiry,
+		admins: admins,
+	}
+}
+
+// Handler returns a handler which keeps the cache up to date with incoming chat_member and my_chat_member updates.
+// It never stops the update from being processed by other handlers, so it should be added to an early group.
+func (c *AdminCache) Handler() ext.Handler {
+	return cacheUpdater{c: c}
+}
+
+// Require wraps a response, so that it is only called if the predicate is true. If the predicate is false, the denied
+// response is called instead; if denied is nil, the update is ignored.
+func Require(p Predicate, r handlers.Response, denied handlers.Response) handlers.Response {
+	return func(b *gotgbot.Bot, ctx *ext.Context) error {
+		ok, err := p(b, ctx)
+		if err != nil {
+			return fmt.Errorf("failed to check permissions: %w", err)
+		}
+		if ok {
+			return r(b, ctx)
+		}
+		if denied != nil {
+			return denied(b, ctx)
+		}
+		return nil
+	}
+}
+
+func (c *AdminCache) senderCheck(b *gotgbot.Bot, ctx *ext.Context, right string) (bool, error) {
+	if !isGroupOrChannel(ctx.EffectiveChat) || ctx.EffectiveSender == nil {
+		return false, nil
+	}
+
+	s := ctx.EffectiveSender
+	if s.IsAnonymousAdmin() || s.IsChannelPost() {
+		return right == "" || c.TrustAnonymousAdmins, nil
+	}
+	if !s.IsUser() {
+		// Linked channels and anonymous channels are never admins.
+		return false, nil
+	}
+
+	if right == "" {
+		return c.IsAdmin(b, ctx.EffectiveChat.Id, s.User.Id)
+	}
+	return c.HasRight(b, ctx.EffectiveChat.Id, s.User.Id, right)
+}
+
+func (c *AdminCache) getAdmins(b *gotgbot.Bot, chatId int64) (map[int64]gotgbot.MergedChatMember, error) {
+	key := cacheKey(b, chatId)
+
+	c.lock.RLock()
+	chat, ok := c.chats[key]
+	c.lock.RUnlock()
+	if ok && time.Now().Before(chat.expiry) {
+		return chat.admins, nil
+	}
+
+	members, err := b.GetChatAdministrators(chatId, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get chat administrators: %w", err)
+	}
+
+	admins := make(map[int64]gotgbot.MergedChatMember, len(members))
+	for _, cm := range members {
+		m := cm.MergeChatMember()
+		admins[m.User.Id] = m
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.chats == nil {
+		c.chats = map[string]*chatAdmins{}
+	}
+	c.chats[key] = &chatAdmins{
+		expiry: time.Now().Add(c.TTL),
+		admins: admins,
+	}
+	return admins, nil
+}
+
+func cacheKey(b *gotgbot.Bot, chatId int64) string {
+	return fmt.Sprintf("%d/%d", b.Id, chatId)
+}
+
+func isGroupOrChannel(chat *gotgbot.Chat) bool {
+	return chat != nil && chat.Type != "private"
+}
+
+// cacheUpdater feeds chat member updates into the AdminCache.
+type cacheUpdater struct {
+	c *AdminCache
+}
+
+func (u cacheUpdater) CheckUpdate(b *gotgbot.Bot, ctx *ext.Context) bool {
+	return ctx.ChatMember != nil || ctx.MyChatMember != nil
+}
+
+func (u cacheUpdater) HandleUpdate(b *gotgbot.Bot, ctx *ext.Context) error {
+	if ctx.ChatMember != nil {
+		u.c.Update(b, ctx.ChatMember)
+	}
+	if ctx.MyChatMember != nil {
+		u.c.Update(b, ctx.MyChatMember)
+	}
+	return ext.ContinueGroups
+}
+
+func (u cacheUpdater) Name() string {
+	return fmt.Sprintf("permissions_admincache_%p", u.c)
+}
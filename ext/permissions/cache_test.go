@@ -0,0 +1,131 @@
+package permissions
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+)
+
+const adminsResponse = `{"ok": true, "result": [
+	{"status": "creator", "user": {"id": 1, "first_name": "owner"}},
+	{"status": "administrator", "user": {"id": 2, "first_name": "mod"}, "can_delete_messages": true},
+	{"status": "administrator", "user": {"id": 100, "first_name": "bot", "is_bot": true}, "can_restrict_members": true}
+]}`
+
+func newTestBot(t *testing.T, calls *int32) *gotgbot.Bot {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/getChatAdministrators") {
+			t.Errorf("unexpected request to %s", r.URL.Path)
+		}
+		atomic.AddInt32(calls, 1)
+		_, _ = w.Write([]byte(adminsResponse))
+	}))
+	t.Cleanup(server.Close)
+
+	return &gotgbot.Bot{
+		User: gotgbot.User{Id: 100, IsBot: true, Username: "gotgbot"},
+		BotClient: &gotgbot.BaseBotClient{
+			Token:              "token",
+			DefaultRequestOpts: &gotgbot.RequestOpts{APIURL: server.URL},
+		},
+	}
+}
+
+func newGroupMessage(from *gotgbot.User, senderChat *gotgbot.Chat) *ext.Context {
+	return ext.NewContext(&gotgbot.Update{
+		Message: &gotgbot.Message{
+			From:       from,
+			SenderChat: senderChat,
+			Chat:       gotgbot.Chat{Id: -100, Type: "supergroup"},
+			Text:       "text",
+		},
+	}, nil)
+}
+
+func TestAdminCache(t *testing.T) {
+	var calls int32
+	b := newTestBot(t, &calls)
+	c := NewAdminCache(time.Hour)
+
+	for _, tc := range []struct {
+		name     string
+		ctx      *ext.Context
+		pred     Predicate
+		expected bool
+	}{
+		{name: "creator is admin", ctx: newGroupMessage(&gotgbot.User{Id: 1}, nil), pred: c.SenderIsAdmin, expected: true},
+		{name: "creator has all rights", ctx: newGroupMessage(&gotgbot.User{Id: 1}, nil), pred: c.SenderHasRight(CanPromoteMembers), expected: true},
+		{name: "admin is admin", ctx: newGroupMessage(&gotgbot.User{Id: 2}, nil), pred: c.SenderIsAdmin, expected: true},
+		{name: "admin has right", ctx: newGroupMessage(&gotgbot.User{Id: 2}, nil), pred: c.SenderHasRight(CanDeleteMessages), expected: true},
+		{name: "admin missing right", ctx: newGroupMessage(&gotgbot.User{Id: 2}, nil), pred: c.SenderHasRight(CanRestrictMembers), expected: false},
+		{name: "user is not admin", ctx: newGroupMessage(&gotgbot.User{Id: 3}, nil), pred: c.SenderIsAdmin, expected: false},
+		{name: "anonymous admin is admin", ctx: newGroupMessage(&gotgbot.User{Id: 1087968824}, &gotgbot.Chat{Id: -100, Type: "supergroup"}), pred: c.SenderIsAdmin, expected: true},
+		{name: "anonymous admin rights are untrusted", ctx: newGroupMessage(&gotgbot.User{Id: 1087968824}, &gotgbot.Chat{Id: -100, Type: "supergroup"}), pred: c.SenderHasRight(CanDeleteMessages), expected: false},
+		{name: "anonymous channel is not admin", ctx: newGroupMessage(&gotgbot.User{Id: 136817688}, &gotgbot.Chat{Id: -200, Type: "channel"}), pred: c.SenderIsAdmin, expected: false},
+		{name: "bot has right", ctx: newGroupMessage(&gotgbot.User{Id: 3}, nil), pred: c.BotHasRight(CanRestrictMembers), expected: true},
+		{name: "bot missing right", ctx: newGroupMessage(&gotgbot.User{Id: 3}, nil), pred: c.BotHasRight(CanPinMessages), expected: false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ok, err := tc.pred(b, tc.ctx)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if ok != tc.expected {
+				t.Errorf("expected %v, got %v", tc.expected, ok)
+			}
+		})
+	}
+
+	if atomic.LoadInt32(&calls) != 1 {
+		t.Errorf("expected admins to be fetched once, got %d calls", atomic.LoadInt32(&calls))
+	}
+}
+
+func TestAdminCacheUpdate(t *testing.T) {
+	var calls int32
+	b := newTestBot(t, &calls)
+	c := NewAdminCache(time.Hour)
+
+	user := gotgbot.User{Id: 3}
+	ctx := newGroupMessage(&user, nil)
+	if ok, err := c.SenderIsAdmin(b, ctx); err != nil || ok {
+		t.Fatalf("expected user not to be admin: %v, %v", ok, err)
+	}
+
+	promotion := ext.NewContext(&gotgbot.Update{
+		ChatMember: &gotgbot.ChatMemberUpdated{
+			Chat:          gotgbot.Chat{Id: -100, Type: "supergroup"},
+			From:          gotgbot.User{Id: 1},
+			OldChatMember: gotgbot.ChatMemberMember{User: user},
+			NewChatMember: gotgbot.ChatMemberAdministrator{User: user, CanPinMessages: true},
+		},
+	}, nil)
+
+	h := c.Handler()
+	if !h.CheckUpdate(b, promotion) {
+		t.Fatalf("expected cache handler to match chat member updates")
+	}
+	if err := h.HandleUpdate(b, promotion); !errors.Is(err, ext.ContinueGroups) {
+		t.Fatalf("expected cache handler to continue groups, got %v", err)
+	}
+
+	if ok, err := c.SenderHasRight(CanPinMessages)(b, ctx); err != nil || !ok {
+		t.Errorf("expected promoted user to have right: %v, %v", ok, err)
+	}
+
+	c.Invalidate(b, -100)
+	if ok, err := c.SenderIsAdmin(b, ctx); err != nil || ok {
+		t.Errorf("expected user not to be admin after invalidation: %v, %v", ok, err)
+	}
+
+	if atomic.LoadInt32(&calls) != 2 {
+		t.Errorf("expected admins to be fetched twice, got %d calls", atomic.LoadInt32(&calls))
+	}
+}
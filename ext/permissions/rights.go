@@ -0,0 +1,61 @@
+package permissions
+
+import "github.com/PaulSonOfLars/gotgbot/v2"
+
+// The consts listed below represent all the administrator rights that can be checked, named after their JSON fields.
+const (
+	CanManageChat       = "can_manage_chat"
+	CanDeleteMessages   = "can_delete_messages"
+	CanManageVideoChats = "can_manage_video_chats"
+	CanRestrictMembers  = "can_restrict_members"
+	CanPromoteMembers   = "can_promote_members"
+	CanChangeInfo       = "can_change_info"
+	CanInviteUsers      = "can_invite_users"
+	CanPostMessages     = "can_post_messages"
+	CanEditMessages     = "can_edit_messages"
+	CanPinMessages      = "can_pin_messages"
+	CanManageTopics     = "can_manage_topics"
+)
+
+// IsAdmin returns true if the chat member is an administrator or the creator of the chat.
+func IsAdmin(m gotgbot.MergedChatMember) bool {
+	return m.Status == "creator" || m.Status == "administrator"
+}
+
+// HasRight checks whether the chat member has the given administrator right.
+// The chat creator has all rights; unknown rights are never granted.
+func HasRight(m gotgbot.MergedChatMember, right string) bool {
+	if m.Status == "creator" {
+		return true
+	}
+	if m.Status != "administrator" {
+		return false
+	}
+
+	switch right {
+	case CanManageChat:
+		return m.CanManageChat
+	case CanDeleteMessages:
+		return m.CanDeleteMessages
+	case CanManageVideoChats:
+		return m.CanManageVideoChats
+	case CanRestrictMembers:
+		return m.CanRestrictMembers
+	case CanPromoteMembers:
+		return m.CanPromoteMembers
+	case CanChangeInfo:
+		return m.CanChangeInfo
+	case CanInviteUsers:
+		return m.CanInviteUsers
+	case CanPostMessages:
+		return m.CanPostMessages
+	case CanEditMessages:
+		return m.CanEditMessages
+	case CanPinMessages:
+		return m.CanPinMessages
+	case CanManageTopics:
+		return m.CanManageTopics
+	default:
+		return false
+	}
+}
@@ -0,0 +1,217 @@
+package ext
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+)
+
+var (
+	ErrInvalidQueryHash = errors.New("invalid query hash")
+	ErrExpiredAuthDate  = errors.New("auth_date has expired")
+	ErrFutureAuthDate   = errors.New("auth_date is in the future")
+)
+
+// webAppAuthDateClockSkew is how far in the future an auth_date may be, to allow for clock drift between telegram and
+// the bot server.
+const webAppAuthDateClockSkew = time.Minute
+
+// webAppInitDataContextKey is the context key used to store validated WebAppInitData in HTTP requests.
+type webAppInitDataContextKey struct{}
+
+// WebAppInitData contains the data transferred to a webapp when it is opened.
+// See https://core.telegram.org/bots/webapps#webappinitdata for more details.
+type WebAppInitData struct {
+	// Optional. A unique identifier for the Web App session, required for sending messages via Bot.AnswerWebAppQuery.
+	QueryId string
+	// Optional. An object containing data about the current user.
+	User *gotgbot.User
+	// Optional. An object containing data about the chat partner of the current user in the chat where the bot was
+	// launched via the attachment menu.
+	Receiver *gotgbot.User
+	// Optional. An object containing data about the chat where the bot was launched via the attachment menu.
+	Chat *gotgbot.Chat
+	// Optional. Type of the chat from which the Web App was opened.
+	ChatType string
+	// Optional. Global identifier, uniquely corresponding to the chat from which the Web App was opened.
+	ChatInstance string
+	// Optional. The value of the startattach parameter, passed via link.
+	StartParam string
+	// Optional. Time in seconds, after which a message can be sent via the Bot.AnswerWebAppQuery method.
+	CanSendAfter int64
+	// Unix time when the form was opened.
+	AuthDate int64
+	// A hash of all passed parameters, which the bot server can use to check their validity.
+	Hash string
+}
+
+// ParseWebAppInitData validates a webapp's initData field, and parses it into a WebAppInitData struct.
+// If maxAge is positive, initData with an older auth_date is rejected with ErrExpiredAuthDate, and initData with an
+// auth_date in the future is rejected with ErrFutureAuthDate.
+// See https://core.telegram.org/bots/webapps#validating-data-received-via-the-web-app for more details.
+func ParseWebAppInitData(initData string, token string, maxAge time.Duration) (*WebAppInitData, error) {
+	query, err := url.ParseQuery(initData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse URL query: %w", err)
+	}
+
+	return ParseWebAppQuery(query, token, maxAge)
+}
+
+// ParseWebAppQuery validates a webapp's parsed initData query, and parses it into a WebAppInitData struct.
+// If maxAge is positive, queries with an older auth_date are rejected with ErrExpiredAuthDate, and queries with an
+// auth_date in the future are rejected with ErrFutureAuthDate.
+func ParseWebAppQuery(query url.Values, token string, maxAge time.Duration) (*WebAppInitData, error) {
+	ok, err := ValidateWebAppQuery(query, token)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrInvalidQueryHash
+	}
+
+	authDate, err := checkAuthDate(query, maxAge)
+	if err != nil {
+		return nil, err
+	}
+
+	data := WebAppInitData{
+		QueryId:      query.Get("query_id"),
+		ChatType:     query.Get("chat_type"),
+		ChatInstance: query.Get("chat_instance"),
+		StartParam:   query.Get("start_param"),
+		AuthDate:     authDate,
+		Hash:         query.Get("hash"),
+	}
+
+	if v := query.Get("can_send_after"); v != "" {
+		data.CanSendAfter, err = strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse can_send_after: %w", err)
+		}
+	}
+	if err = unmarshalQueryField(query, "user", &data.User); err != nil {
+		return nil, err
+	}
+	if err = unmarshalQueryField(query, "receiver", &data.Receiver); err != nil {
+		return nil, err
+	}
+	if err = unmarshalQueryField(query, "chat", &data.Chat); err != nil {
+		return nil, err
+	}
+
+	return &data, nil
+}
+
+// WebAppMiddlewareOpts defines optional parameters for WebAppMiddleware.
+type WebAppMiddlewareOpts struct {
+	// MaxAge is the maximum age of the initData's auth_date. If 0, the age is not checked.
+	MaxAge time.Duration
+	// GetInitData extracts the raw initData string from the request.
+	// If nil, WebAppInitDataFromHeader is used. Other sources, such as WebAppInitDataFromFormField, must be opted into
+	// explicitly.
+	GetInitData func(r *http.Request) string
+	// ErrorHandler is called when the initData is invalid.
+	// If nil, a 401 Unauthorized status is returned.
+	ErrorHandler func(w http.ResponseWriter, r *http.Request, err error)
+}
+
+// WebAppMiddleware returns a net/http middleware which validates webapp initData, and stores the parsed
+// WebAppInitData in the request context. Handlers can then obtain it with WebAppInitDataFromContext.
+func WebAppMiddleware(token string, opts *WebAppMiddlewareOpts) func(http.Handler) http.Handler {
+	var maxAge time.Duration
+	getInitData := WebAppInitDataFromHeader
+	errHandler := defaultWebAppErrorHandler
+
+	if opts != nil {
+		maxAge = opts.MaxAge
+		if opts.GetInitData != nil {
+			getInitData = opts.GetInitData
+		}
+		if opts.ErrorHandler != nil {
+			errHandler = opts.ErrorHandler
+		}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			data, err := ParseWebAppInitData(getInitData(r), token, maxAge)
+			if err != nil {
+				errHandler(w, r, err)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), webAppInitDataContextKey{}, data)))
+		})
+	}
+}
+
+// WebAppInitDataFromContext returns the WebAppInitData stored by WebAppMiddleware, if any.
+func WebAppInitDataFromContext(ctx context.Context) (*WebAppInitData, bool) {
+	data, ok := ctx.Value(webAppInitDataContextKey{}).(*WebAppInitData)
+	return data, ok
+}
+
+// WebAppInitDataFromHeader returns the initData sent in the "Authorization: tma <initData>" header, if any. This is
+// the default WebAppMiddlewareOpts.GetInitData.
+func WebAppInitDataFromHeader(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "tma ") {
+		return strings.TrimPrefix(auth, "tma ")
+	}
+	return ""
+}
+
+// WebAppInitDataFromFormField returns a WebAppMiddlewareOpts.GetInitData function, which reads the initData from the
+// given field of the request's form body. URL query parameters are ignored.
+func WebAppInitDataFromFormField(field string) func(r *http.Request) string {
+	return func(r *http.Request) string {
+		return r.PostFormValue(field)
+	}
+}
+
+func defaultWebAppErrorHandler(w http.ResponseWriter, _ *http.Request, err error) {
+	http.Error(w, "invalid init data: "+err.Error(), http.StatusUnauthorized)
+}
+
+// checkAuthDate parses the auth_date field, and ensures it is no older than maxAge.
+// If maxAge is positive, dates further in the future than the allowed clock drift are also rejected, as they would
+// otherwise extend the initData's lifetime.
+func checkAuthDate(query url.Values, maxAge time.Duration) (int64, error) {
+	authDate, err := strconv.ParseInt(query.Get("auth_date"), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse auth_date: %w", err)
+	}
+
+	if maxAge <= 0 {
+		return authDate, nil
+	}
+	age := time.Since(time.Unix(authDate, 0))
+	if age > maxAge {
+		return 0, ErrExpiredAuthDate
+	}
+	if age < -webAppAuthDateClockSkew {
+		return 0, ErrFutureAuthDate
+	}
+	return authDate, nil
+}
+
+// unmarshalQueryField unmarshals a JSON-encoded query field, if it is present.
+func unmarshalQueryField(query url.Values, field string, v interface{}) error {
+	raw := query.Get(field)
+	if raw == "" {
+		return nil
+	}
+
+	if err := json.Unmarshal([]byte(raw), v); err != nil {
+		return fmt.Errorf("failed to unmarshal %s: %w", field, err)
+	}
+	return nil
+}
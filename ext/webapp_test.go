@@ -0,0 +1,151 @@
+package ext
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// signQuery adds a valid hash to the query, as telegram would.
+func signQuery(t *testing.T, query url.Values, secretKey []byte) {
+	t.Helper()
+
+	query.Del("hash")
+	args := make([]string, 0, len(query))
+	for k, v := range query {
+		args = append(args, k+"="+v[0])
+	}
+	sort.Strings(args)
+
+	hash, err := generateHMAC256(strings.Join(args, "\n"), secretKey)
+	if err != nil {
+		t.Fatalf("failed to sign query: %v", err)
+	}
+	query.Set("hash", string(getHex(hash)))
+}
+
+func newWebAppQuery(t *testing.T, token string, authDate time.Time) url.Values {
+	t.Helper()
+
+	query := url.Values{}
+	query.Set("auth_date", strconv.FormatInt(authDate.Unix(), 10))
+	query.Set("query_id", "AAHdF6IQAAAAAN0XohDhrOrc")
+	query.Set("user", `{"id":12345,"first_name":"John","last_name":"Smith","username":"MrSmith","language_code":"en"}`)
+	query.Set("chat_type", "private")
+	query.Set("start_param", "ref")
+
+	secretKey, err := generateHMAC256(token, []byte("WebAppData"))
+	if err != nil {
+		t.Fatalf("failed to generate secret key: %v", err)
+	}
+	signQuery(t, query, secretKey)
+	return query
+}
+
+func TestParseWebAppInitData(t *testing.T) {
+	now := time.Now()
+	query := newWebAppQuery(t, "test_token", now)
+
+	data, err := ParseWebAppInitData(query.Encode(), "test_token", time.Hour)
+	if err != nil {
+		t.Fatalf("failed to parse init data: %v", err)
+	}
+	if data.User == nil || data.User.Id != 12345 || data.User.Username != "MrSmith" {
+		t.Errorf("unexpected user: %+v", data.User)
+	}
+	if data.QueryId != "AAHdF6IQAAAAAN0XohDhrOrc" || data.ChatType != "private" || data.StartParam != "ref" {
+		t.Errorf("unexpected init data: %+v", data)
+	}
+	if data.AuthDate != now.Unix() {
+		t.Errorf("expected auth date %d, got %d", now.Unix(), data.AuthDate)
+	}
+
+	if _, err = ParseWebAppInitData(query.Encode(), "invalid_token", 0); !errors.Is(err, ErrInvalidQueryHash) {
+		t.Errorf("expected invalid hash error, got %v", err)
+	}
+
+	old := newWebAppQuery(t, "test_token", now.Add(-2*time.Hour))
+	if _, err = ParseWebAppInitData(old.Encode(), "test_token", time.Hour); !errors.Is(err, ErrExpiredAuthDate) {
+		t.Errorf("expected expired auth date error, got %v", err)
+	}
+	if _, err = ParseWebAppInitData(old.Encode(), "test_token", 0); err != nil {
+		t.Errorf("expected no error without max age, got %v", err)
+	}
+
+	future := newWebAppQuery(t, "test_token", now.Add(time.Hour))
+	if _, err = ParseWebAppInitData(future.Encode(), "test_token", time.Hour); !errors.Is(err, ErrFutureAuthDate) {
+		t.Errorf("expected future auth date error, got %v", err)
+	}
+	skewed := newWebAppQuery(t, "test_token", now.Add(10*time.Second))
+	if _, err = ParseWebAppInitData(skewed.Encode(), "test_token", time.Hour); err != nil {
+		t.Errorf("expected small clock drift to be accepted, got %v", err)
+	}
+}
+
+func TestWebAppMiddleware(t *testing.T) {
+	h := WebAppMiddleware("test_token", &WebAppMiddlewareOpts{MaxAge: time.Hour})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, ok := WebAppInitDataFromContext(r.Context())
+		if !ok {
+			t.Errorf("expected init data in request context")
+			return
+		}
+		_, _ = w.Write([]byte(strconv.FormatInt(data.User.Id, 10)))
+	}))
+
+	query := newWebAppQuery(t, "test_token", time.Now())
+
+	req := httptest.NewRequest(http.MethodPost, "/validate", nil)
+	req.Header.Set("Authorization", "tma "+query.Encode())
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || rec.Body.String() != "12345" {
+		t.Errorf("expected valid init data to be accepted, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// The URL query isn't read by default.
+	req = httptest.NewRequest(http.MethodGet, "/validate?"+query.Encode(), nil)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected init data in URL query to be ignored, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	query.Set("user", `{"id":1}`)
+	req = httptest.NewRequest(http.MethodPost, "/validate", nil)
+	req.Header.Set("Authorization", "tma "+query.Encode())
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected tampered init data to be rejected, got %d", rec.Code)
+	}
+}
+
+func TestWebAppMiddlewareFormField(t *testing.T) {
+	h := WebAppMiddleware("test_token", &WebAppMiddlewareOpts{
+		GetInitData: WebAppInitDataFromFormField("init_data"),
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	query := newWebAppQuery(t, "test_token", time.Now())
+
+	form := url.Values{"init_data": {query.Encode()}}
+	req := httptest.NewRequest(http.MethodPost, "/validate", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected init data in form body to be accepted, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/validate?"+form.Encode(), nil)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected init data in URL query to be ignored, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,289 @@
+package gotgbot
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+)
+
+// FileIdStore stores the file_ids of previously uploaded files, keyed by their media kind and the hash of their
+// contents (eg "photo:<sha256>"); the same contents sent as different kinds of media get different file_ids.
+type FileIdStore interface {
+	// Get returns the file_id of the file with the given key, if any.
+	Get(key string) (string, bool, error)
+	// Set stores the file_id of the file with the given key.
+	Set(key string, fileId string) error
+	// Delete removes the file_id of the file with the given key; eg, because it is no longer valid.
+	Delete(key string) error
+}
+
+// InMemoryFileIdStore is a thread-safe in-memory implementation of the FileIdStore interface.
+type InMemoryFileIdStore struct {
+	// fileIds maps media kind and content hash keys to file_ids.
+	fileIds map[string]string
+	// lock allows us to ensure synchronous data access.
+	lock sync.RWMutex
+}
+
+var _ FileIdStore = &InMemoryFileIdStore{}
+
+func NewInMemoryFileIdStore() *InMemoryFileIdStore {
+	return &InMemoryFileIdStore{
+		fileIds: map[string]string{},
+	}
+}
+
+func (s *InMemoryFileIdStore) Get(key string) (string, bool, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	fileId, ok := s.fileIds[key]
+	return fileId, ok, nil
+}
+
+func (s *InMemoryFileIdStore) Set(key string, fileId string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.fileIds == nil {
+		s.fileIds = map[string]string{}
+	}
+	s.fileIds[key] = fileId
+	return nil
+}
+
+func (s *InMemoryFileIdStore) Delete(key string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delete(s.fileIds, key)
+	return nil
+}
+
+// cacheableFileFields are the upload fields which can be resent by file_id, along with a function to obtain the
+// file_id from the sent message. Thumbnails can't be reused, so they are always uploaded.
+var cacheableFileFields = map[string]func(m *Message) string{
+	"photo": func(m *Message) string {
+		if len(m.Photo) == 0 {
+			return ""
+		}
+		// The last photo size is the original, largest photo.
+		return m.Photo[len(m.Photo)-1].FileId
+	},
+	"audio": func(m *Message) string {
+		if m.Audio == nil {
+			return ""
+		}
+		return m.Audio.FileId
+	},
+	"document": func(m *Message) string {
+		if m.Document == nil {
+			return ""
+		}
+		return m.Document.FileId
+	},
+	"video": func(m *Message) string {
+		if m.Video == nil {
+			return ""
+		}
+		return m.Video.FileId
+	},
+	"animation": func(m *Message) string {
+		if m.Animation == nil {
+			return ""
+		}
+		return m.Animation.FileId
+	},
+	"voice": func(m *Message) string {
+		if m.Voice == nil {
+			return ""
+		}
+		return m.Voice.FileId
+	},
+	"video_note": func(m *Message) string {
+		if m.VideoNote == nil {
+			return ""
+		}
+		return m.VideoNote.FileId
+	},
+	"sticker": func(m *Message) string {
+		if m.Sticker == nil {
+			return ""
+		}
+		return m.Sticker.FileId
+	},
+}
+
+// fileIdCacheBotClient is a BotClient middleware which resends previously uploaded files by file_id.
+type fileIdCacheBotClient struct {
+	// Inline the wrapped client, so we only need to redefine RequestWithContext.
+	BotClient
+	store FileIdStore
+}
+
+// NewFileIdCache wraps a BotClient with a middleware which avoids uploading the same file contents multiple times.
+//
+// Files uploaded through send methods (eg, Bot.SendPhoto or Bot.SendDocument) are hashed, and the file_id returned by
+// telegram is saved in the store. Any later uploads with the same contents are sent using the stored file_id instead.
+// If telegram rejects a stored file_id, it is deleted from the store and the file is uploaded again.
+//
+// Note: cached files must be read into memory to be hashed. Thumbnails and media groups are not cached.
+func NewFileIdCache(b BotClient, store FileIdStore) BotClient {
+	if store == nil {
+		store = NewInMemoryFileIdStore()
+	}
+	return &fileIdCacheBotClient{
+		BotClient: b,
+		store:     store,
+	}
+}
+
+// bufferedFile is an in-memory copy of an uploaded file, so that it can be sent more than once.
+type bufferedFile struct {
+	name     string
+	contents []byte
+	// key is the store key of cacheable files, made of the upload field and the content hash; it is empty for files
+	// which can't be resent by file_id.
+	key string
+	// fileId is the cached file_id to send instead of the contents, if any.
+	fileId string
+}
+
+func (c *fileIdCacheBotClient) RequestWithContext(ctx context.Context, method string, params map[string]string, data map[string]NamedReader, opts *RequestOpts) (json.RawMessage, error) {
+	if !strings.HasPrefix(method, "send") || !hasCacheableFile(params, data) {
+		return c.BotClient.RequestWithContext(ctx, method, params, data, opts)
+	}
+
+	// All files are read into memory, so that they can be uploaded again if a cached file_id is rejected.
+	files := make(map[string]*bufferedFile, len(data))
+	for field, file := range data {
+		if err := resetReader(file); err != nil {
+			return nil, fmt.Errorf("failed to reset file of field %s: %w", field, err)
+		}
+		contents, err := ioutil.ReadAll(file)
+		closeErr := closeReader(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read file contents of field %s: %w", field, err)
+		}
+		if closeErr != nil {
+			return nil, fmt.Errorf("failed to close file of field %s: %w", field, closeErr)
+		}
+
+		f := &bufferedFile{name: file.Name(), contents: contents}
+		files[field] = f
+		if !isCacheableFile(params, field) {
+			continue
+		}
+
+		// The field is part of the key, as telegram rejects file_ids sent as another kind of media (eg, a document's
+		// file_id sent as a photo).
+		sum := sha256.Sum256(contents)
+		f.key = field + ":" + hex.EncodeToString(sum[:])
+		fileId, ok, err := c.store.Get(f.key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get cached file_id of field %s: %w", field, err)
+		}
+		if ok {
+			f.fileId = fileId
+		}
+	}
+
+	r, err := c.requestCached(ctx, method, params, files, opts)
+	if err == nil || !isInvalidFileIdError(err) {
+		return r, err
+	}
+
+	// A cached file_id was rejected; forget all cached file_ids for this request, and upload the files again.
+	retry := false
+	for field, f := range files {
+		if f.fileId == "" {
+			continue
+		}
+		if err := c.store.Delete(f.key); err != nil {
+			return nil, fmt.Errorf("failed to delete invalid file_id of field %s: %w", field, err)
+		}
+		f.fileId = ""
+		retry = true
+	}
+	if !retry {
+		return nil, err
+	}
+	return c.requestCached(ctx, method, params, files, opts)
+}
+
+// requestCached sends the request, using cached file_ids where possible, and stores the file_ids of any new uploads.
+func (c *fileIdCacheBotClient) requestCached(ctx context.Context, method string, params map[string]string, files map[string]*bufferedFile, opts *RequestOpts) (json.RawMessage, error) {
+	reqParams := make(map[string]string, len(params))
+	for k, v := range params {
+		reqParams[k] = v
+	}
+
+	reqData := make(map[string]NamedReader, len(files))
+	for field, f := range files {
+		if f.fileId != "" {
+			reqParams[field] = f.fileId
+			continue
+		}
+		reqData[field] = NamedFile{File: bytes.NewReader(f.contents), FileName: f.name}
+	}
+
+	r, err := c.BotClient.RequestWithContext(ctx, method, reqParams, reqData, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var m Message
+	if err := json.Unmarshal(r, &m); err != nil {
+		// Not a message; nothing to cache.
+		return r, nil
+	}
+
+	for field, f := range files {
+		if f.key == "" || f.fileId != "" {
+			continue
+		}
+		if fileId := cacheableFileFields[field](&m); fileId != "" {
+			if err := c.store.Set(f.key, fileId); err != nil {
+				return nil, fmt.Errorf("failed to cache file_id of field %s: %w", field, err)
+			}
+		}
+	}
+	return r, nil
+}
+
+// isCacheableFile checks whether the file uploaded in the given field can be resent by file_id.
+func isCacheableFile(params map[string]string, field string) bool {
+	_, ok := cacheableFileFields[field]
+	return ok && params[field] == "attach://"+field
+}
+
+func hasCacheableFile(params map[string]string, data map[string]NamedReader) bool {
+	for field := range data {
+		if isCacheableFile(params, field) {
+			return true
+		}
+	}
+	return false
+}
+
+// isInvalidFileIdError checks whether telegram rejected a request because of an unusable file_id.
+func isInvalidFileIdError(err error) bool {
+	var tgErr *TelegramError
+	if !errors.As(err, &tgErr) || tgErr.Code != 400 {
+		return false
+	}
+
+	desc := strings.ToLower(tgErr.Description)
+	return strings.Contains(desc, "wrong file identifier") ||
+		strings.Contains(desc, "wrong remote file") ||
+		strings.Contains(desc, "file reference") ||
+		strings.Contains(desc, "failed to get http url content") ||
+		strings.Contains(desc, "can't use file of type")
+}
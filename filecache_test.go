@@ -0,0 +1,118 @@
+package gotgbot
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+)
+
+// uploadRecorderBotClient is a fake BotClient which records the sent photos, and rejects unknown file_ids.
+type uploadRecorderBotClient struct {
+	BaseBotClient
+	uploads  int
+	fileIds  []string
+	validIds map[string]bool
+}
+
+func (c *uploadRecorderBotClient) RequestWithContext(_ context.Context, method string, params map[string]string, data map[string]NamedReader, _ *RequestOpts) (json.RawMessage, error) {
+	if f, ok := data["photo"]; ok {
+		if _, err := ioutil.ReadAll(f); err != nil {
+			return nil, err
+		}
+		c.uploads++
+		return json.RawMessage(`{"message_id": 1, "photo": [{"file_id": "small"}, {"file_id": "large"}]}`), nil
+	}
+
+	c.fileIds = append(c.fileIds, params["photo"])
+	if !c.validIds[params["photo"]] {
+		return nil, &TelegramError{Method: method, Params: params, Code: 400, Description: "Bad Request: wrong file identifier/HTTP URL specified"}
+	}
+	return json.RawMessage(`{"message_id": 2, "photo": [{"file_id": "large"}]}`), nil
+}
+
+func TestFileIdCache(t *testing.T) {
+	client := &uploadRecorderBotClient{validIds: map[string]bool{"large": true}}
+	store := NewInMemoryFileIdStore()
+	b := Bot{BotClient: NewFileIdCache(client, store)}
+
+	for i := 0; i < 2; i++ {
+		if _, err := b.SendPhoto(1, []byte("logo"), nil); err != nil {
+			t.Fatalf("failed to send photo: %v", err)
+		}
+	}
+	if client.uploads != 1 || len(client.fileIds) != 1 || client.fileIds[0] != "large" {
+		t.Fatalf("expected a single upload and a resend by file_id, got %d uploads and %v", client.uploads, client.fileIds)
+	}
+
+	// Different contents are uploaded separately.
+	if _, err := b.SendPhoto(1, []byte("diagram"), nil); err != nil {
+		t.Fatalf("failed to send photo: %v", err)
+	}
+	if client.uploads != 2 {
+		t.Fatalf("expected new contents to be uploaded, got %d uploads", client.uploads)
+	}
+
+	// Stale file_ids are uploaded again.
+	client.validIds = nil
+	if _, err := b.SendPhoto(1, []byte("logo"), nil); err != nil {
+		t.Fatalf("failed to send photo: %v", err)
+	}
+	if client.uploads != 3 {
+		t.Errorf("expected stale file_id to be re-uploaded, got %d uploads", client.uploads)
+	}
+}
+
+// mediaKindBotClient is a fake BotClient which uploads documents and photos, and rejects file_ids of the wrong kind.
+type mediaKindBotClient struct {
+	BaseBotClient
+	uploads []string
+}
+
+func (c *mediaKindBotClient) RequestWithContext(_ context.Context, method string, params map[string]string, data map[string]NamedReader, _ *RequestOpts) (json.RawMessage, error) {
+	for _, field := range []string{"document", "photo"} {
+		if f, ok := data[field]; ok {
+			if _, err := ioutil.ReadAll(f); err != nil {
+				return nil, err
+			}
+			c.uploads = append(c.uploads, field)
+			if field == "document" {
+				return json.RawMessage(`{"message_id": 1, "document": {"file_id": "doc"}}`), nil
+			}
+			return json.RawMessage(`{"message_id": 1, "photo": [{"file_id": "photo"}]}`), nil
+		}
+	}
+
+	if params["photo"] == "doc" {
+		return nil, &TelegramError{Method: method, Params: params, Code: 400, Description: "Bad Request: can't use file of type Document as Photo"}
+	}
+	return json.RawMessage(`{"message_id": 2, "photo": [{"file_id": "photo"}]}`), nil
+}
+
+func TestFileIdCache_mediaKinds(t *testing.T) {
+	client := &mediaKindBotClient{}
+	store := NewInMemoryFileIdStore()
+	b := Bot{BotClient: NewFileIdCache(client, store)}
+
+	// The same contents sent as a document and as a photo are uploaded once for each kind.
+	if _, err := b.SendDocument(1, []byte("image"), nil); err != nil {
+		t.Fatalf("failed to send document: %v", err)
+	}
+	if _, err := b.SendPhoto(1, []byte("image"), nil); err != nil {
+		t.Fatalf("failed to send photo: %v", err)
+	}
+	if len(client.uploads) != 2 || client.uploads[0] != "document" || client.uploads[1] != "photo" {
+		t.Fatalf("expected the contents to be uploaded as each kind of media, got %v", client.uploads)
+	}
+
+	// File_ids of the wrong kind (eg, from stores filled by older versions) are rejected, and uploaded again.
+	for key := range store.fileIds {
+		store.fileIds[key] = "doc"
+	}
+	if _, err := b.SendPhoto(1, []byte("image"), nil); err != nil {
+		t.Fatalf("failed to send photo: %v", err)
+	}
+	if len(client.uploads) != 3 || client.uploads[2] != "photo" {
+		t.Errorf("expected the photo to be uploaded again, got %v", client.uploads)
+	}
+}
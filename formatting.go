@@ -2,6 +2,7 @@ package gotgbot
 
 import (
 	"html"
+	"sort"
 	"strconv"
 	"strings"
 	"unicode"
@@ -12,6 +13,7 @@ var mdMap = map[string]string{
 	"bold":   "*",
 	"italic": "_",
 	"code":   "`",
+	"pre":    "```",
 }
 
 var mdV2Map = map[string]string{
@@ -34,7 +36,32 @@ var htmlMap = map[string]string{
 	"spoiler":       "span class=\"tg-spoiler\"",
 }
 
+// mdSupported contains the entity types which can be represented in markdown.
+var mdSupported = map[string]bool{
+	"bold":         true,
+	"italic":       true,
+	"code":         true,
+	"pre":          true,
+	"text_link":    true,
+	"text_mention": true,
+}
+
+// richSupported contains the entity types which can be represented in markdownV2 and HTML.
+var richSupported = map[string]bool{
+	"bold":          true,
+	"italic":        true,
+	"code":          true,
+	"pre":           true,
+	"underline":     true,
+	"strikethrough": true,
+	"spoiler":       true,
+	"text_link":     true,
+	"text_mention":  true,
+	"custom_emoji":  true,
+}
+
 // OriginalMD gets the original markdown formatting of a message text.
+// Legacy markdown is lossy; see OriginalMDV2 for an exact representation.
 func (m Message) OriginalMD() string {
 	return getOrigMsgMD(utf16.Encode([]rune(m.Text)), m.Entities)
 }
@@ -64,141 +91,118 @@ func (m Message) OriginalCaptionHTML() string {
 	return getOrigMsgHTML(utf16.Encode([]rune(m.Caption)), m.CaptionEntities)
 }
 
-// Does not support nesting. only look at upper entities.
+// Markdown does not support nesting, so nested entities are flattened; the innermost entity is used for any nested
+// text. Markdown also doesn't support escaping within entities, so entities are split around any of their own closing
+// characters, which are written unformatted.
 func getOrigMsgMD(utf16Data []uint16, ents []MessageEntity) string {
 	out := strings.Builder{}
-	prev := int64(0)
-	for _, ent := range getUpperEntities(ents) {
-		newPrev := ent.Offset + ent.Length
-		prevText := string(utf16.Decode(utf16Data[prev:ent.Offset]))
-
-		text := utf16.Decode(utf16Data[ent.Offset:newPrev])
-		pre, cleanCntnt, post := splitEdgeWhitespace(string(text))
-		cleanCntntRune := []rune(cleanCntnt)
-
-		switch ent.Type {
-		case "bold", "italic", "code":
-			out.WriteString(prevText + pre + mdMap[ent.Type] + escapeContainedMDV1(cleanCntntRune, []rune(mdMap[ent.Type])) + mdMap[ent.Type] + post)
+	for _, seg := range flattenEntityTree(entityTree(utf16Data, ents, mdSupported), 0, int64(len(utf16Data)), nil) {
+		text := string(utf16.Decode(utf16Data[seg.start:seg.end]))
+		if seg.ent == nil {
+			out.WriteString(escapeContainedMDV1([]rune(text), []rune("_*`[")))
+			continue
+		}
+
+		switch seg.ent.Type {
+		case "bold", "italic", "code", "pre":
+			writeMDV1Entity(&out, text, mdMap[seg.ent.Type], mdMap[seg.ent.Type], rune(mdMap[seg.ent.Type][0]))
 		case "text_mention":
-			out.WriteString(prevText + pre + "[" + escapeContainedMDV1(cleanCntntRune, []rune("[]()")) + "](tg://user?id=" + strconv.FormatInt(ent.User.Id, 10) + ")" + post)
+			writeMDV1Entity(&out, text, "[", "](tg://user?id="+strconv.FormatInt(seg.ent.User.Id, 10)+")", ']')
 		case "text_link":
-			out.WriteString(prevText + pre + "[" + escapeContainedMDV1(cleanCntntRune, []rune("[]()")) + "](" + ent.Url + ")" + post)
-		default:
-			continue
+			writeMDV1Entity(&out, text, "[", "]("+seg.ent.Url+")", ']')
 		}
-		prev = newPrev
 	}
-
-	out.WriteString(string(utf16.Decode(utf16Data[prev:])))
 	return out.String()
 }
 
-func getOrigMsgHTML(utf16Data []uint16, ents []MessageEntity) string {
-	if len(ents) == 0 {
-		return html.EscapeString(string(utf16.Decode(utf16Data)))
-	}
+// writeMDV1Entity writes the text of a markdown entity between the opening and closing tokens. As the entity can't
+// contain its closing character, the entity is closed before each one, and reopened after it; eg "_snake_\__case_".
+func writeMDV1Entity(out *strings.Builder, text string, opening string, closing string, closingChar rune) {
+	for i, part := range strings.Split(text, string(closingChar)) {
+		if i > 0 {
+			out.WriteString("\\" + string(closingChar))
+		}
 
-	bd := strings.Builder{}
-	prev := int64(0)
-	for _, e := range getUpperEntities(ents) {
-		data, end := fillNestedHTML(utf16Data, e, prev, getChildEntities(e, ents))
-		bd.WriteString(data)
-		prev = end
+		pre, cntnt, post := splitEdgeWhitespace(part)
+		if cntnt == "" {
+			// Markdown entities can't be empty, so whitespace-only text is written as plain text.
+			out.WriteString(part)
+			continue
+		}
+		out.WriteString(pre + opening + cntnt + closing + post)
 	}
-
-	bd.WriteString(html.EscapeString(string(utf16.Decode(utf16Data[prev:]))))
-	return bd.String()
 }
 
-func getOrigMsgMDV2(utf16Data []uint16, ents []MessageEntity) string {
-	if len(ents) == 0 {
-		return string(utf16.Decode(utf16Data))
-	}
-
+func getOrigMsgHTML(utf16Data []uint16, ents []MessageEntity) string {
 	bd := strings.Builder{}
-	prev := int64(0)
-	for _, e := range getUpperEntities(ents) {
-		data, end := fillNestedMarkdownV2(utf16Data, e, prev, getChildEntities(e, ents))
-		bd.WriteString(data)
-		prev = end
-	}
-
-	bd.WriteString(string(utf16.Decode(utf16Data[prev:])))
+	fillNestedHTML(&bd, utf16Data, 0, int64(len(utf16Data)), entityTree(utf16Data, ents, richSupported))
 	return bd.String()
 }
 
-func fillNestedHTML(data []uint16, ent MessageEntity, start int64, entities []MessageEntity) (string, int64) {
-	entEnd := ent.Offset + ent.Length
-	if len(entities) == 0 || entEnd < entities[0].Offset {
-		// no nesting; just return straight away and move to next.
-		return writeFinalHTML(data, ent, start, html.EscapeString(string(utf16.Decode(data[ent.Offset:entEnd])))), entEnd
-	}
-	subPrev := ent.Offset
-	subEnd := ent.Offset
-	bd := strings.Builder{}
-	for _, e := range getUpperEntities(entities) {
-		if e.Offset < subEnd || e == ent {
-			continue
-		}
-		if e.Offset >= entEnd {
-			break
-		}
-
-		out, end := fillNestedHTML(data, e, subPrev, getChildEntities(e, entities))
-		bd.WriteString(out)
-		subPrev = end
-	}
-
-	bd.WriteString(html.EscapeString(string(utf16.Decode(data[subPrev:entEnd]))))
-
-	return writeFinalHTML(data, ent, start, bd.String()), entEnd
+func getOrigMsgMDV2(utf16Data []uint16, ents []MessageEntity) string {
+	w := mdV2Writer{}
+	fillNestedMarkdownV2(&w, utf16Data, 0, int64(len(utf16Data)), entityTree(utf16Data, ents, richSupported))
+	return w.bd.String()
 }
 
-func fillNestedMarkdownV2(data []uint16, ent MessageEntity, start int64, entities []MessageEntity) (string, int64) {
-	entEnd := ent.Offset + ent.Length
-	if len(entities) == 0 || entEnd < entities[0].Offset {
-		// no nesting; just return straight away and move to next.
-		return writeFinalMarkdownV2(data, ent, start, string(utf16.Decode(data[ent.Offset:entEnd]))), entEnd
-	}
-	subPrev := ent.Offset
-	subEnd := ent.Offset
-	bd := strings.Builder{}
-	for _, e := range getUpperEntities(entities) {
-		if e.Offset < subEnd || e == ent {
-			continue
+func fillNestedHTML(bd *strings.Builder, data []uint16, start int64, end int64, nodes []*entityNode) {
+	prev := start
+	for _, n := range nodes {
+		bd.WriteString(html.EscapeString(string(utf16.Decode(data[prev:n.Offset]))))
+		prev = n.Offset + n.Length
+
+		writeHTMLTag(bd, n.MessageEntity, false)
+		if n.Type == "code" || n.Type == "pre" {
+			// Code entities can't contain other entities.
+			bd.WriteString(html.EscapeString(string(utf16.Decode(data[n.Offset:prev]))))
+		} else {
+			fillNestedHTML(bd, data, n.Offset, prev, n.children)
 		}
-		if e.Offset >= entEnd {
-			break
-		}
-
-		out, end := fillNestedMarkdownV2(data, e, subPrev, getChildEntities(e, entities))
-		bd.WriteString(out)
-		subPrev = end
+		writeHTMLTag(bd, n.MessageEntity, true)
 	}
-
-	bd.WriteString(string(utf16.Decode(data[subPrev:entEnd])))
-
-	return writeFinalMarkdownV2(data, ent, start, bd.String()), entEnd
+	bd.WriteString(html.EscapeString(string(utf16.Decode(data[prev:end]))))
 }
 
-func writeFinalHTML(data []uint16, ent MessageEntity, start int64, cntnt string) string {
-	prevText := html.EscapeString(string(utf16.Decode(data[start:ent.Offset])))
+func writeHTMLTag(bd *strings.Builder, ent MessageEntity, closing bool) {
 	switch ent.Type {
 	case "bold", "italic", "code", "underline", "strikethrough", "spoiler":
-		return prevText + "<" + htmlMap[ent.Type] + ">" + cntnt + "</" + closeHTMLTag(htmlMap[ent.Type]) + ">"
+		if closing {
+			bd.WriteString("</" + closeHTMLTag(htmlMap[ent.Type]) + ">")
+			return
+		}
+		bd.WriteString("<" + htmlMap[ent.Type] + ">")
 	case "pre":
 		// <pre>text</pre>
 		if ent.Language == "" {
-			return prevText + "<pre>" + cntnt + "</pre>"
+			if closing {
+				bd.WriteString("</pre>")
+				return
+			}
+			bd.WriteString("<pre>")
+			return
+		}
+		// <pre><code class="language-lang">text</code></pre>
+		if closing {
+			bd.WriteString("</code></pre>")
+			return
+		}
+		bd.WriteString(`<pre><code class="language-` + html.EscapeString(ent.Language) + `">`)
+	case "text_mention", "text_link":
+		if closing {
+			bd.WriteString("</a>")
+			return
 		}
-		// <pre><code class="lang">text</code></pre>
-		return prevText + `<pre><code class="` + ent.Language + `">` + cntnt + "</code></pre>"
-	case "text_mention":
-		return prevText + `<a href="tg://user?id=` + strconv.FormatInt(ent.User.Id, 10) + `">` + cntnt + "</a>"
-	case "text_link":
-		return prevText + `<a href="` + ent.Url + `">` + cntnt + "</a>"
-	default:
-		return prevText + cntnt
+		url := ent.Url
+		if ent.Type == "text_mention" {
+			url = "tg://user?id=" + strconv.FormatInt(ent.User.Id, 10)
+		}
+		bd.WriteString(`<a href="` + html.EscapeString(url) + `">`)
+	case "custom_emoji":
+		if closing {
+			bd.WriteString("</tg-emoji>")
+			return
+		}
+		bd.WriteString(`<tg-emoji emoji-id="` + html.EscapeString(ent.CustomEmojiId) + `">`)
 	}
 }
 
@@ -210,64 +214,200 @@ func closeHTMLTag(s string) string {
 	return "span"
 }
 
-func writeFinalMarkdownV2(data []uint16, ent MessageEntity, start int64, cntnt string) string {
-	prevText := string(utf16.Decode(data[start:ent.Offset]))
-	pre, cleanCntnt, post := splitEdgeWhitespace(cntnt)
-	switch ent.Type {
-	case "bold", "italic", "code", "underline", "strikethrough", "pre", "spoiler":
-		return prevText + pre + mdV2Map[ent.Type] + cleanCntnt + mdV2Map[ent.Type] + post
-	case "text_mention":
-		return prevText + pre + "[" + cleanCntnt + "](tg://user?id=" + strconv.FormatInt(ent.User.Id, 10) + ")" + post
-	case "text_link":
-		return prevText + pre + "[" + cleanCntnt + "](" + ent.Url + ")" + post
-	default:
-		return prevText + cntnt
+// mdV2Writer writes markdownV2, keeping track of underscores to avoid ambiguity between italic and underline tokens.
+type mdV2Writer struct {
+	bd strings.Builder
+	// lastUnderscore is true if the last written token ended with an underscore.
+	lastUnderscore bool
+}
+
+func (w *mdV2Writer) writeToken(token string) {
+	if w.lastUnderscore && strings.HasPrefix(token, "_") {
+		// Telegram ignores carriage returns, so they can be used to separate "_" and "__" tokens.
+		w.bd.WriteByte('\r')
 	}
+	w.bd.WriteString(token)
+	w.lastUnderscore = strings.HasSuffix(token, "_")
 }
 
-func getUpperEntities(ents []MessageEntity) []MessageEntity {
-	prev := int64(0)
-	uppers := make([]MessageEntity, 0, len(ents))
-	for _, e := range ents {
-		if e.Offset < prev {
-			continue
+func (w *mdV2Writer) writeText(text string) {
+	if text == "" {
+		return
+	}
+	w.bd.WriteString(text)
+	w.lastUnderscore = false
+}
+
+func fillNestedMarkdownV2(w *mdV2Writer, data []uint16, start int64, end int64, nodes []*entityNode) {
+	prev := start
+	for _, n := range nodes {
+		w.writeText(escapeMDV2(string(utf16.Decode(data[prev:n.Offset])), mdV2Reserved+"\\"))
+		prev = n.Offset + n.Length
+		cntnt := string(utf16.Decode(data[n.Offset:prev]))
+
+		switch n.Type {
+		case "code":
+			// Code entities can't contain other entities.
+			w.writeToken(mdV2Map[n.Type])
+			w.writeText(escapeMDV2(cntnt, "`\\"))
+			w.writeToken(mdV2Map[n.Type])
+		case "pre":
+			// The newline is always written, to avoid the first word being mistaken for the language.
+			w.writeToken(mdV2Map[n.Type] + n.Language + "\n")
+			w.writeText(escapeMDV2(cntnt, "`\\"))
+			w.writeToken(mdV2Map[n.Type])
+		case "bold", "italic", "underline", "strikethrough", "spoiler":
+			w.writeToken(mdV2Map[n.Type])
+			fillNestedMarkdownV2(w, data, n.Offset, prev, n.children)
+			w.writeToken(mdV2Map[n.Type])
+		case "text_mention", "text_link", "custom_emoji":
+			url := n.Url
+			switch n.Type {
+			case "text_mention":
+				url = "tg://user?id=" + strconv.FormatInt(n.User.Id, 10)
+			case "custom_emoji":
+				url = "tg://emoji?id=" + n.CustomEmojiId
+				w.writeToken("!")
+			}
+			w.writeToken("[")
+			fillNestedMarkdownV2(w, data, n.Offset, prev, n.children)
+			w.writeToken("](" + escapeMDV2(url, ")\\") + ")")
 		}
-		uppers = append(uppers, e)
-		prev = e.Offset + e.Length
 	}
-	return uppers
+	w.writeText(escapeMDV2(string(utf16.Decode(data[prev:end])), mdV2Reserved+"\\"))
+}
+
+// escapeMDV2 escapes all the given characters with a preceding '\'.
+// Carriage returns are always escaped too, as telegram otherwise ignores them.
+func escapeMDV2(s string, chars string) string {
+	chars += "\r"
+	if !strings.ContainsAny(s, chars) {
+		return s
+	}
+
+	bd := strings.Builder{}
+	for _, r := range s {
+		if strings.ContainsRune(chars, r) {
+			bd.WriteRune('\\')
+		}
+		bd.WriteRune(r)
+	}
+	return bd.String()
+}
+
+// entityNode is a formatting entity, along with all the entities nested within it.
+type entityNode struct {
+	MessageEntity
+	children []*entityNode
 }
 
-func getChildEntities(ent MessageEntity, ents []MessageEntity) []MessageEntity {
-	end := ent.Offset + ent.Length
-	children := make([]MessageEntity, 0, len(ents))
+// entityTree nests the supported entities within each other. Entities which partially overlap are split, so that the
+// result is always properly nested.
+func entityTree(data []uint16, ents []MessageEntity, supported map[string]bool) []*entityNode {
+	dataLen := int64(len(data))
+	queue := make([]MessageEntity, 0, len(ents))
 	for _, e := range ents {
-		if e.Offset < ent.Offset || e == ent {
+		if !supported[e.Type] || (e.Type == "text_mention" && e.User == nil) {
 			continue
 		}
-		if e.Offset >= end {
-			break
+		// Ignore invalid entities, rather than panicking.
+		if e.Offset < 0 || e.Offset >= dataLen || e.Length <= 0 {
+			continue
+		}
+		if e.Offset+e.Length > dataLen {
+			e.Length = dataLen - e.Offset
+		}
+		queue = append(queue, e)
+	}
+	sort.SliceStable(queue, func(i, j int) bool {
+		return entityBefore(queue[i], queue[j])
+	})
+
+	var roots []*entityNode
+	var stack []*entityNode
+	for len(queue) > 0 {
+		e := queue[0]
+		queue = queue[1:]
+
+		for len(stack) > 0 && stack[len(stack)-1].Offset+stack[len(stack)-1].Length <= e.Offset {
+			stack = stack[:len(stack)-1]
+		}
+
+		n := &entityNode{MessageEntity: e}
+		if len(stack) == 0 {
+			roots = append(roots, n)
+		} else {
+			parent := stack[len(stack)-1]
+			parentEnd := parent.Offset + parent.Length
+			if end := e.Offset + e.Length; end > parentEnd {
+				// Split the entity; the remainder is processed later.
+				rest := e
+				rest.Offset = parentEnd
+				rest.Length = end - parentEnd
+				n.Length = parentEnd - e.Offset
+
+				idx := sort.Search(len(queue), func(i int) bool {
+					return entityBefore(rest, queue[i])
+				})
+				queue = append(queue[:idx], append([]MessageEntity{rest}, queue[idx:]...)...)
+			}
+			parent.children = append(parent.children, n)
 		}
-		children = append(children, e)
+		stack = append(stack, n)
 	}
-	return children
+	return roots
+}
+
+// entityBefore orders entities by offset, with outer entities before the entities nested in them.
+func entityBefore(a MessageEntity, b MessageEntity) bool {
+	if a.Offset != b.Offset {
+		return a.Offset < b.Offset
+	}
+	return a.Length > b.Length
+}
+
+// entitySegment is a section of text formatted with at most one entity.
+type entitySegment struct {
+	start int64
+	end   int64
+	ent   *MessageEntity
 }
 
+// flattenEntityTree splits the text between start and end into segments with a single entity each, using the
+// innermost entity for nested text.
+func flattenEntityTree(nodes []*entityNode, start int64, end int64, parent *MessageEntity) []entitySegment {
+	var out []entitySegment
+	prev := start
+	for _, n := range nodes {
+		if n.Offset > prev {
+			out = append(out, entitySegment{start: prev, end: n.Offset, ent: parent})
+		}
+		prev = n.Offset + n.Length
+
+		if len(n.children) == 0 || n.Type == "code" || n.Type == "pre" {
+			out = append(out, entitySegment{start: n.Offset, end: prev, ent: &n.MessageEntity})
+			continue
+		}
+		out = append(out, flattenEntityTree(n.children, n.Offset, prev, &n.MessageEntity)...)
+	}
+	if end > prev {
+		out = append(out, entitySegment{start: prev, end: end, ent: parent})
+	}
+	return out
+}
+
+// splitEdgeWhitespace splits the leading and trailing whitespace from the text.
 func splitEdgeWhitespace(text string) (pre string, cntnt string, post string) {
-	bd := strings.Builder{}
 	rText := []rune(text)
-	for i := 0; i < len(rText) && unicode.IsSpace(rText[i]); i++ {
-		bd.WriteRune(rText[i])
+	start := 0
+	for start < len(rText) && unicode.IsSpace(rText[start]) {
+		start++
 	}
-	pre = bd.String()
-	text = strings.TrimPrefix(text, pre)
-
-	bd.Reset()
-	for i := len(rText) - 1; i >= 0 && unicode.IsSpace(rText[i]); i-- {
-		bd.WriteRune(rText[i])
+	end := len(rText)
+	for end > start && unicode.IsSpace(rText[end-1]) {
+		end--
 	}
-	post = bd.String()
-	return pre, strings.TrimSuffix(text, post), post
+	return string(rText[:start]), string(rText[start:end]), string(rText[end:])
 }
 
 func escapeContainedMDV1(data []rune, mdType []rune) string {
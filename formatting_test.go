@@ -0,0 +1,244 @@
+package gotgbot
+
+import (
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+	"unicode/utf16"
+)
+
+func TestOriginalFormatting(t *testing.T) {
+	m := Message{
+		Text: "bold italic link (x) emoji 👍 1+1=2.",
+		Entities: []MessageEntity{
+			{Type: "bold", Offset: 0, Length: 11},
+			{Type: "italic", Offset: 5, Length: 6},
+			{Type: "text_link", Offset: 12, Length: 8, Url: "https://example.com/a_(b)"},
+			{Type: "custom_emoji", Offset: 27, Length: 2, CustomEmojiId: "5368324170671202286"},
+		},
+	}
+
+	for name, tc := range map[string]struct {
+		actual   string
+		expected string
+	}{
+		"markdown": {
+			actual:   m.OriginalMD(),
+			expected: "*bold* _italic_ [link (x)](https://example.com/a_(b)) emoji 👍 1+1=2.",
+		},
+		"markdownV2": {
+			actual:   m.OriginalMDV2(),
+			expected: "*bold _italic_* [link \\(x\\)](https://example.com/a_(b\\)) emoji ![👍](tg://emoji?id=5368324170671202286) 1\\+1\\=2\\.",
+		},
+		"HTML": {
+			actual:   m.OriginalHTML(),
+			expected: `<b>bold <i>italic</i></b> <a href="https://example.com/a_(b)">link (x)</a> emoji <tg-emoji emoji-id="5368324170671202286">👍</tg-emoji> 1+1=2.`,
+		},
+	} {
+		if tc.actual != tc.expected {
+			t.Errorf("%s: expected %q, got %q", name, tc.expected, tc.actual)
+		}
+	}
+}
+
+func TestOriginalFormattingOverlap(t *testing.T) {
+	// Partially overlapping entities are split, so that they can be nested.
+	m := Message{
+		Text: "abcdef",
+		Entities: []MessageEntity{
+			{Type: "bold", Offset: 0, Length: 4},
+			{Type: "italic", Offset: 2, Length: 4},
+		},
+	}
+
+	if out := m.OriginalHTML(); out != "<b>ab<i>cd</i></b><i>ef</i>" {
+		t.Errorf("unexpected HTML: %q", out)
+	}
+	if out := m.OriginalMDV2(); out != "*ab_cd_*_ef_" {
+		t.Errorf("unexpected markdownV2: %q", out)
+	}
+}
+
+func TestOriginalMDV2Underscores(t *testing.T) {
+	m := Message{
+		Text: "ab",
+		Entities: []MessageEntity{
+			{Type: "underline", Offset: 0, Length: 2},
+			{Type: "italic", Offset: 0, Length: 2},
+		},
+	}
+
+	out := m.OriginalMDV2()
+	text, ents, err := ParseMarkdownV2(out)
+	if err != nil {
+		t.Fatalf("failed to parse %q: %v", out, err)
+	}
+	if text != m.Text || !reflect.DeepEqual(ents, m.Entities) {
+		t.Errorf("expected %q to round-trip, got %q with %+v", out, text, ents)
+	}
+}
+
+func TestOriginalMDEntitySplitting(t *testing.T) {
+	// Markdown can't escape characters within entities, so entities are split around their closing characters.
+	for name, tc := range map[string]struct {
+		text     string
+		ent      MessageEntity
+		expected string
+	}{
+		"italic": {
+			text:     "snake_case",
+			ent:      MessageEntity{Type: "italic", Offset: 0, Length: 10},
+			expected: "_snake_\\__case_",
+		},
+		"edges": {
+			text:     "_a b_",
+			ent:      MessageEntity{Type: "italic", Offset: 0, Length: 5},
+			expected: "\\__a b_\\_",
+		},
+		"code": {
+			text:     "a`b",
+			ent:      MessageEntity{Type: "code", Offset: 0, Length: 3},
+			expected: "`a`\\``b`",
+		},
+		"link": {
+			text:     "[x] y",
+			ent:      MessageEntity{Type: "text_link", Offset: 0, Length: 5, Url: "https://example.com"},
+			expected: "[[x](https://example.com)\\] [y](https://example.com)",
+		},
+		"whitespace": {
+			text:     " \tbold\t\n",
+			ent:      MessageEntity{Type: "bold", Offset: 0, Length: 7},
+			expected: " \t*bold*\t\n",
+		},
+	} {
+		m := Message{Text: tc.text, Entities: []MessageEntity{tc.ent}}
+		if out := m.OriginalMD(); out != tc.expected {
+			t.Errorf("%s: expected %q, got %q", name, tc.expected, out)
+		}
+	}
+}
+
+func TestOriginalMDV2CarriageReturn(t *testing.T) {
+	// Telegram ignores unescaped carriage returns, so they must be escaped to be kept.
+	m := Message{
+		Text:     "a\r\nb_c",
+		Entities: []MessageEntity{{Type: "bold", Offset: 3, Length: 3}},
+	}
+
+	out := m.OriginalMDV2()
+	if out != "a\\\r\n*b\\_c*" {
+		t.Errorf("unexpected markdownV2: %q", out)
+	}
+	text, ents, err := ParseMarkdownV2(out)
+	if err != nil {
+		t.Fatalf("failed to parse %q: %v", out, err)
+	}
+	if text != m.Text || !reflect.DeepEqual(ents, m.Entities) {
+		t.Errorf("expected %q to round-trip, got %q with %+v", out, text, ents)
+	}
+}
+
+// TestFormattingRoundTrip checks that formatting random messages, and parsing them again, gives back the original
+// text and entities.
+func TestFormattingRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		m := randomFormattedMessage(r)
+
+		for name, tc := range map[string]struct {
+			format func() string
+			parse  func(string) (string, []MessageEntity, error)
+		}{
+			"markdownV2": {format: m.OriginalMDV2, parse: ParseMarkdownV2},
+			"HTML":       {format: m.OriginalHTML, parse: ParseHTML},
+		} {
+			out := tc.format()
+			text, ents, err := tc.parse(out)
+			if err != nil {
+				t.Fatalf("%s: failed to parse %q from %q with %+v: %v", name, out, m.Text, m.Entities, err)
+			}
+			if text != m.Text {
+				t.Fatalf("%s: expected text %q, got %q from %q", name, m.Text, text, out)
+			}
+			if !reflect.DeepEqual(sortedEntities(ents), sortedEntities(m.Entities)) {
+				t.Fatalf("%s: expected entities %+v, got %+v from %q", name, m.Entities, ents, out)
+			}
+		}
+	}
+}
+
+var roundTripChars = []rune("ab _*[]()~`>#+-=|{}.!\\<>&\"';\r\n👍é")
+
+var roundTripTypes = []string{"bold", "italic", "underline", "strikethrough", "spoiler", "code", "pre", "text_link", "text_mention", "custom_emoji"}
+
+// randomFormattedMessage generates a message with random text, and random properly nested entities.
+func randomFormattedMessage(r *rand.Rand) Message {
+	runes := make([]rune, r.Intn(30))
+	for i := range runes {
+		runes[i] = roundTripChars[r.Intn(len(roundTripChars))]
+	}
+	text := string(runes)
+
+	// Entity boundaries must be on rune boundaries, so map rune indexes to UTF-16 offsets.
+	offsets := make([]int64, len(runes)+1)
+	for i, rn := range runes {
+		offsets[i+1] = offsets[i] + int64(len(utf16.Encode([]rune{rn})))
+	}
+
+	var ents []MessageEntity
+	var addEntities func(start int, end int, depth int, parentType string, inLink bool)
+	addEntities = func(start int, end int, depth int, parentType string, inLink bool) {
+		for pos := start; pos < end && depth < 3; {
+			entStart := pos + r.Intn(end-pos)
+			entEnd := entStart + 1 + r.Intn(end-entStart)
+			types := roundTripTypes
+			if inLink {
+				// Links can't be nested within other links.
+				types = roundTripTypes[:7]
+			}
+			ent := MessageEntity{
+				Type:   types[r.Intn(len(types))],
+				Offset: offsets[entStart],
+				Length: offsets[entEnd] - offsets[entStart],
+			}
+			if ent.Type == parentType {
+				// Telegram merges directly nested entities of the same type.
+				continue
+			}
+			switch ent.Type {
+			case "pre":
+				if r.Intn(2) == 0 {
+					ent.Language = "go"
+				}
+			case "text_link":
+				ent.Url = "https://example.com/(a)\\b"
+			case "text_mention":
+				ent.User = &User{Id: 123}
+			case "custom_emoji":
+				ent.CustomEmojiId = "5368324170671202286"
+			}
+			ents = append(ents, ent)
+
+			if ent.Type != "code" && ent.Type != "pre" {
+				addEntities(entStart, entEnd, depth+1, ent.Type, inLink || ent.Type == "text_link" || ent.Type == "text_mention" || ent.Type == "custom_emoji")
+			}
+			pos = entEnd + r.Intn(3)
+		}
+	}
+	addEntities(0, len(runes), 0, "", false)
+
+	return Message{Text: text, Entities: ents}
+}
+
+func sortedEntities(ents []MessageEntity) []MessageEntity {
+	out := make([]MessageEntity, len(ents))
+	copy(out, ents)
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].Offset != out[j].Offset || out[i].Length != out[j].Length {
+			return entityBefore(out[i], out[j])
+		}
+		return out[i].Type < out[j].Type
+	})
+	return out
+}
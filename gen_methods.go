@@ -2626,6 +2626,13 @@ func (bot *Bot) SendAnimation(chatId int64, animation InputFile, opts *SendAnima
 		case string:
 			v["animation"] = m
 
+		case InputFileSource:
+			attachment, err := m.Attach("animation", data)
+			if err != nil {
+				return nil, fmt.Errorf("failed to attach field animation: %w", err)
+			}
+			v["animation"] = attachment
+
 		case NamedReader:
 			v["animation"] = "attach://animation"
 			data["animation"] = m
@@ -2660,6 +2667,13 @@ func (bot *Bot) SendAnimation(chatId int64, animation InputFile, opts *SendAnima
 			case string:
 				v["thumbnail"] = m
 
+			case InputFileSource:
+				attachment, err := m.Attach("thumbnail", data)
+				if err != nil {
+					return nil, fmt.Errorf("failed to attach field thumbnail: %w", err)
+				}
+				v["thumbnail"] = attachment
+
 			case NamedReader:
 				v["thumbnail"] = "attach://thumbnail"
 				data["thumbnail"] = m
@@ -2763,6 +2777,13 @@ func (bot *Bot) SendAudio(chatId int64, audio InputFile, opts *SendAudioOpts) (*
 		case string:
 			v["audio"] = m
 
+		case InputFileSource:
+			attachment, err := m.Attach("audio", data)
+			if err != nil {
+				return nil, fmt.Errorf("failed to attach field audio: %w", err)
+			}
+			v["audio"] = attachment
+
 		case NamedReader:
 			v["audio"] = "attach://audio"
 			data["audio"] = m
@@ -2802,6 +2823,13 @@ func (bot *Bot) SendAudio(chatId int64, audio InputFile, opts *SendAudioOpts) (*
 			case string:
 				v["thumbnail"] = m
 
+			case InputFileSource:
+				attachment, err := m.Attach("thumbnail", data)
+				if err != nil {
+					return nil, fmt.Errorf("failed to attach field thumbnail: %w", err)
+				}
+				v["thumbnail"] = attachment
+
 			case NamedReader:
 				v["thumbnail"] = "attach://thumbnail"
 				data["thumbnail"] = m
@@ -3060,6 +3088,13 @@ func (bot *Bot) SendDocument(chatId int64, document InputFile, opts *SendDocumen
 		case string:
 			v["document"] = m
 
+		case InputFileSource:
+			attachment, err := m.Attach("document", data)
+			if err != nil {
+				return nil, fmt.Errorf("failed to attach field document: %w", err)
+			}
+			v["document"] = attachment
+
 		case NamedReader:
 			v["document"] = "attach://document"
 			data["document"] = m
@@ -3085,6 +3120,13 @@ func (bot *Bot) SendDocument(chatId int64, document InputFile, opts *SendDocumen
 			case string:
 				v["thumbnail"] = m
 
+			case InputFileSource:
+				attachment, err := m.Attach("thumbnail", data)
+				if err != nil {
+					return nil, fmt.Errorf("failed to attach field thumbnail: %w", err)
+				}
+				v["thumbnail"] = attachment
+
 			case NamedReader:
 				v["thumbnail"] = "attach://thumbnail"
 				data["thumbnail"] = m
@@ -3600,6 +3642,13 @@ func (bot *Bot) SendPhoto(chatId int64, photo InputFile, opts *SendPhotoOpts) (*
 		case string:
 			v["photo"] = m
 
+		case InputFileSource:
+			attachment, err := m.Attach("photo", data)
+			if err != nil {
+				return nil, fmt.Errorf("failed to attach field photo: %w", err)
+			}
+			v["photo"] = attachment
+
 		case NamedReader:
 			v["photo"] = "attach://photo"
 			data["photo"] = m
@@ -3806,6 +3855,13 @@ func (bot *Bot) SendSticker(chatId int64, sticker InputFile, opts *SendStickerOp
 		case string:
 			v["sticker"] = m
 
+		case InputFileSource:
+			attachment, err := m.Attach("sticker", data)
+			if err != nil {
+				return nil, fmt.Errorf("failed to attach field sticker: %w", err)
+			}
+			v["sticker"] = attachment
+
 		case NamedReader:
 			v["sticker"] = "attach://sticker"
 			data["sticker"] = m
@@ -3986,6 +4042,13 @@ func (bot *Bot) SendVideo(chatId int64, video InputFile, opts *SendVideoOpts) (*
 		case string:
 			v["video"] = m
 
+		case InputFileSource:
+			attachment, err := m.Attach("video", data)
+			if err != nil {
+				return nil, fmt.Errorf("failed to attach field video: %w", err)
+			}
+			v["video"] = attachment
+
 		case NamedReader:
 			v["video"] = "attach://video"
 			data["video"] = m
@@ -4020,6 +4083,13 @@ func (bot *Bot) SendVideo(chatId int64, video InputFile, opts *SendVideoOpts) (*
 			case string:
 				v["thumbnail"] = m
 
+			case InputFileSource:
+				attachment, err := m.Attach("thumbnail", data)
+				if err != nil {
+					return nil, fmt.Errorf("failed to attach field thumbnail: %w", err)
+				}
+				v["thumbnail"] = attachment
+
 			case NamedReader:
 				v["thumbnail"] = "attach://thumbnail"
 				data["thumbnail"] = m
@@ -4115,6 +4185,13 @@ func (bot *Bot) SendVideoNote(chatId int64, videoNote InputFile, opts *SendVideo
 		case string:
 			v["video_note"] = m
 
+		case InputFileSource:
+			attachment, err := m.Attach("video_note", data)
+			if err != nil {
+				return nil, fmt.Errorf("failed to attach field video_note: %w", err)
+			}
+			v["video_note"] = attachment
+
 		case NamedReader:
 			v["video_note"] = "attach://video_note"
 			data["video_note"] = m
@@ -4146,6 +4223,13 @@ func (bot *Bot) SendVideoNote(chatId int64, videoNote InputFile, opts *SendVideo
 			case string:
 				v["thumbnail"] = m
 
+			case InputFileSource:
+				attachment, err := m.Attach("thumbnail", data)
+				if err != nil {
+					return nil, fmt.Errorf("failed to attach field thumbnail: %w", err)
+				}
+				v["thumbnail"] = attachment
+
 			case NamedReader:
 				v["thumbnail"] = "attach://thumbnail"
 				data["thumbnail"] = m
@@ -4232,6 +4316,13 @@ func (bot *Bot) SendVoice(chatId int64, voice InputFile, opts *SendVoiceOpts) (*
 		case string:
 			v["voice"] = m
 
+		case InputFileSource:
+			attachment, err := m.Attach("voice", data)
+			if err != nil {
+				return nil, fmt.Errorf("failed to attach field voice: %w", err)
+			}
+			v["voice"] = attachment
+
 		case NamedReader:
 			v["voice"] = "attach://voice"
 			data["voice"] = m
@@ -4459,6 +4550,13 @@ func (bot *Bot) SetChatPhoto(chatId int64, photo InputFile, opts *SetChatPhotoOp
 	v["chat_id"] = strconv.FormatInt(chatId, 10)
 	if photo != nil {
 		switch m := photo.(type) {
+		case InputFileSource:
+			attachment, err := m.Attach("photo", data)
+			if err != nil {
+				return false, fmt.Errorf("failed to attach field photo: %w", err)
+			}
+			v["photo"] = attachment
+
 		case NamedReader:
 			v["photo"] = "attach://photo"
 			data["photo"] = m
@@ -5050,6 +5148,13 @@ func (bot *Bot) SetStickerSetThumbnail(name string, userId int64, opts *SetStick
 			case string:
 				v["thumbnail"] = m
 
+			case InputFileSource:
+				attachment, err := m.Attach("thumbnail", data)
+				if err != nil {
+					return false, fmt.Errorf("failed to attach field thumbnail: %w", err)
+				}
+				v["thumbnail"] = attachment
+
 			case NamedReader:
 				v["thumbnail"] = "attach://thumbnail"
 				data["thumbnail"] = m
@@ -5144,6 +5249,13 @@ func (bot *Bot) SetWebhook(url string, opts *SetWebhookOpts) (bool, error) {
 	if opts != nil {
 		if opts.Certificate != nil {
 			switch m := opts.Certificate.(type) {
+			case InputFileSource:
+				attachment, err := m.Attach("certificate", data)
+				if err != nil {
+					return false, fmt.Errorf("failed to attach field certificate: %w", err)
+				}
+				v["certificate"] = attachment
+
 			case NamedReader:
 				v["certificate"] = "attach://certificate"
 				data["certificate"] = m
@@ -5497,6 +5609,13 @@ func (bot *Bot) UploadStickerFile(userId int64, sticker InputFile, stickerFormat
 	v["user_id"] = strconv.FormatInt(userId, 10)
 	if sticker != nil {
 		switch m := sticker.(type) {
+		case InputFileSource:
+			attachment, err := m.Attach("sticker", data)
+			if err != nil {
+				return nil, fmt.Errorf("failed to attach field sticker: %w", err)
+			}
+			v["sticker"] = attachment
+
 		case NamedReader:
 			v["sticker"] = "attach://sticker"
 			data["sticker"] = m
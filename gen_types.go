@@ -3273,6 +3273,13 @@ func (v InputMediaAnimation) InputParams(mediaName string, data map[string]Named
 		case string:
 			// ok, noop
 
+		case InputFileSource:
+			attachment, err := m.Attach(mediaName, data)
+			if err != nil {
+				return nil, fmt.Errorf("failed to attach media: %w", err)
+			}
+			v.Media = attachment
+
 		case NamedReader:
 			v.Media = "attach://" + mediaName
 			data[mediaName] = m
@@ -3358,6 +3365,13 @@ func (v InputMediaAudio) InputParams(mediaName string, data map[string]NamedRead
 		case string:
 			// ok, noop
 
+		case InputFileSource:
+			attachment, err := m.Attach(mediaName, data)
+			if err != nil {
+				return nil, fmt.Errorf("failed to attach media: %w", err)
+			}
+			v.Media = attachment
+
 		case NamedReader:
 			v.Media = "attach://" + mediaName
 			data[mediaName] = m
@@ -3437,6 +3451,13 @@ func (v InputMediaDocument) InputParams(mediaName string, data map[string]NamedR
 		case string:
 			// ok, noop
 
+		case InputFileSource:
+			attachment, err := m.Attach(mediaName, data)
+			if err != nil {
+				return nil, fmt.Errorf("failed to attach media: %w", err)
+			}
+			v.Media = attachment
+
 		case NamedReader:
 			v.Media = "attach://" + mediaName
 			data[mediaName] = m
@@ -3513,6 +3534,13 @@ func (v InputMediaPhoto) InputParams(mediaName string, data map[string]NamedRead
 		case string:
 			// ok, noop
 
+		case InputFileSource:
+			attachment, err := m.Attach(mediaName, data)
+			if err != nil {
+				return nil, fmt.Errorf("failed to attach media: %w", err)
+			}
+			v.Media = attachment
+
 		case NamedReader:
 			v.Media = "attach://" + mediaName
 			data[mediaName] = m
@@ -3604,6 +3632,13 @@ func (v InputMediaVideo) InputParams(mediaName string, data map[string]NamedRead
 		case string:
 			// ok, noop
 
+		case InputFileSource:
+			attachment, err := m.Attach(mediaName, data)
+			if err != nil {
+				return nil, fmt.Errorf("failed to attach media: %w", err)
+			}
+			v.Media = attachment
+
 		case NamedReader:
 			v.Media = "attach://" + mediaName
 			data[mediaName] = m
@@ -3653,6 +3688,13 @@ func (v InputSticker) InputParams(mediaName string, data map[string]NamedReader)
 		case string:
 			// ok, noop
 
+		case InputFileSource:
+			attachment, err := m.Attach(mediaName, data)
+			if err != nil {
+				return nil, fmt.Errorf("failed to attach media: %w", err)
+			}
+			v.Sticker = attachment
+
 		case NamedReader:
 			v.Sticker = "attach://" + mediaName
 			data[mediaName] = m
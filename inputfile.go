@@ -0,0 +1,211 @@
+package gotgbot
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// InputFileSource is a typed InputFile, which knows how it should be sent to telegram.
+// Use InputFileByID, InputFileByURL, InputFileFromPath or InputFileFromReader to create one.
+//
+// Unlike readers, InputFileSources can be reused: the underlying file is reopened at the start of every request, so
+// requests can be sent again, and safely retried by BotClient middlewares.
+type InputFileSource interface {
+	// Attach returns the value of the request field with the given name. If the file needs to be uploaded, it is
+	// added to the data map, and an "attach://<name>" reference is returned.
+	Attach(name string, data map[string]NamedReader) (string, error)
+}
+
+// InputFileByID creates an InputFile which sends an existing file by its file_id.
+func InputFileByID(fileId string) InputFileSource {
+	return fileStringSource(fileId)
+}
+
+// InputFileByURL creates an InputFile which lets telegram download the file from the given HTTP URL.
+func InputFileByURL(url string) InputFileSource {
+	return fileStringSource(url)
+}
+
+// InputFileFromPath creates an InputFile which uploads the file found at the given path.
+// The file is only opened when the request is sent, and closed once it has been read.
+func InputFileFromPath(path string) InputFileSource {
+	return filePathSource(path)
+}
+
+// InputFileFromReader creates an InputFile which uploads the contents of the reader, with the given file name.
+// The size is optional, and made available to BotClient middlewares through the Size method of the uploaded
+// NamedReader; it should be set to 0 if unknown.
+//
+// If the reader implements io.Seeker, it is rewound to its initial position at the start of every request, so requests
+// can be sent again and retried. Otherwise, the reader can only be sent once.
+func InputFileFromReader(name string, r io.Reader, size int64) InputFileSource {
+	s := &fileReaderSource{
+		name: name,
+		r:    r,
+		size: size,
+	}
+
+	if seeker, ok := r.(io.Seeker); ok {
+		// Store the initial position, so we know where to rewind to.
+		if offset, err := seeker.Seek(0, io.SeekCurrent); err == nil {
+			s.seeker = seeker
+			s.offset = offset
+		}
+	}
+	return s
+}
+
+// fileStringSource is a file which is sent as a string; either a file_id, or a URL.
+type fileStringSource string
+
+func (s fileStringSource) Attach(_ string, _ map[string]NamedReader) (string, error) {
+	return string(s), nil
+}
+
+// filePathSource is a local file, which is opened lazily.
+type filePathSource string
+
+func (s filePathSource) Attach(name string, data map[string]NamedReader) (string, error) {
+	data[name] = &lazyFile{path: string(s)}
+	return "attach://" + name, nil
+}
+
+// reusableReader is implemented by the NamedReaders created by InputFileSources. They are reset at the start of every
+// request, so that retried requests send the whole file, even after a partial read; and closed once they have been
+// sent. BotClient middlewares which abandon a request should also close them.
+type reusableReader interface {
+	NamedReader
+	io.Closer
+	// reset rewinds the reader to the start of the file.
+	reset() error
+}
+
+// resetReader rewinds the reader for a new request, if it was created by an InputFileSource.
+func resetReader(r NamedReader) error {
+	if rr, ok := r.(reusableReader); ok {
+		return rr.reset()
+	}
+	return nil
+}
+
+// closeReader releases the resources held by the reader, if it was created by an InputFileSource. Other readers are
+// owned by the caller, so they are left open.
+func closeReader(r NamedReader) error {
+	if rr, ok := r.(reusableReader); ok {
+		return rr.Close()
+	}
+	return nil
+}
+
+// lazyFile is a NamedReader which only opens the file on the first read, and closes it once it has been fully read.
+type lazyFile struct {
+	path string
+	file *os.File
+	done bool
+}
+
+func (f *lazyFile) Name() string {
+	return filepath.Base(f.path)
+}
+
+func (f *lazyFile) Read(p []byte) (int, error) {
+	if f.done {
+		return 0, io.EOF
+	}
+
+	if f.file == nil {
+		file, err := os.Open(f.path)
+		if err != nil {
+			return 0, fmt.Errorf("failed to open file %s: %w", f.path, err)
+		}
+		f.file = file
+	}
+
+	n, err := f.file.Read(p)
+	if err != nil {
+		f.done = true
+		if closeErr := f.Close(); closeErr != nil && err == io.EOF {
+			return n, fmt.Errorf("failed to close file %s: %w", f.path, closeErr)
+		}
+	}
+	return n, err
+}
+
+// Close closes the file, if it is open. The next read reopens it from the start.
+func (f *lazyFile) Close() error {
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+func (f *lazyFile) reset() error {
+	f.done = false
+	return f.Close()
+}
+
+// fileReaderSource is a file to upload from a reader.
+type fileReaderSource struct {
+	name string
+	r    io.Reader
+	size int64
+
+	// seeker is set if the reader can be rewound, to allow for sending it multiple times.
+	seeker io.Seeker
+	// offset is the initial position of the seeker.
+	offset int64
+}
+
+func (s *fileReaderSource) Attach(name string, data map[string]NamedReader) (string, error) {
+	if s.seeker != nil {
+		if _, err := s.seeker.Seek(s.offset, io.SeekStart); err != nil {
+			return "", fmt.Errorf("failed to rewind reader: %w", err)
+		}
+	}
+
+	file := sizedNamedFile{
+		NamedFile: NamedFile{File: s.r, FileName: s.name},
+		size:      s.size,
+	}
+	if s.seeker != nil {
+		data[name] = rewindingFile{sizedNamedFile: file, seeker: s.seeker, offset: s.offset}
+	} else {
+		data[name] = file
+	}
+	return "attach://" + name, nil
+}
+
+// rewindingFile is a file uploaded from a seekable reader, which is rewound to its initial position at the start of
+// every request.
+type rewindingFile struct {
+	sizedNamedFile
+	seeker io.Seeker
+	offset int64
+}
+
+// Close does nothing, since the reader is owned by the caller.
+func (f rewindingFile) Close() error {
+	return nil
+}
+
+func (f rewindingFile) reset() error {
+	if _, err := f.seeker.Seek(f.offset, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to rewind reader: %w", err)
+	}
+	return nil
+}
+
+// sizedNamedFile is a NamedFile with a known size.
+type sizedNamedFile struct {
+	NamedFile
+	size int64
+}
+
+// Size returns the size of the file, or 0 if unknown.
+func (f sizedNamedFile) Size() int64 {
+	return f.size
+}
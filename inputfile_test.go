@@ -0,0 +1,188 @@
+package gotgbot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// requestRecorderBotClient is a fake BotClient which records the params and file contents of the last request.
+type requestRecorderBotClient struct {
+	BaseBotClient
+	params map[string]string
+	files  map[string]string
+	names  map[string]string
+}
+
+func (c *requestRecorderBotClient) RequestWithContext(_ context.Context, method string, params map[string]string, data map[string]NamedReader, _ *RequestOpts) (json.RawMessage, error) {
+	c.params = params
+	c.files = map[string]string{}
+	c.names = map[string]string{}
+	for k, f := range data {
+		bs, err := ioutil.ReadAll(f)
+		if err != nil {
+			return nil, err
+		}
+		c.files[k] = string(bs)
+		c.names[k] = f.Name()
+	}
+	if method == "sendMediaGroup" {
+		return json.RawMessage(`[{"message_id": 1}]`), nil
+	}
+	return json.RawMessage(`{"message_id": 1}`), nil
+}
+
+func TestInputFileSources(t *testing.T) {
+	client := &requestRecorderBotClient{}
+	b := Bot{BotClient: client}
+
+	path := filepath.Join(t.TempDir(), "report.txt")
+	if err := os.WriteFile(path, []byte("file contents"), 0600); err != nil {
+		t.Fatalf("failed to write test file: %v", err)
+	}
+
+	for name, tc := range map[string]struct {
+		file         InputFileSource
+		expectedText string
+		expectedFile string
+		expectedName string
+	}{
+		"id":     {file: InputFileByID("AgADBAADbqkxG"), expectedText: "AgADBAADbqkxG"},
+		"url":    {file: InputFileByURL("https://example.com/report.txt"), expectedText: "https://example.com/report.txt"},
+		"path":   {file: InputFileFromPath(path), expectedText: "attach://document", expectedFile: "file contents", expectedName: "report.txt"},
+		"reader": {file: InputFileFromReader("data.csv", strings.NewReader("a,b"), 3), expectedText: "attach://document", expectedFile: "a,b", expectedName: "data.csv"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			// Send twice, to ensure sources can be reused.
+			for i := 0; i < 2; i++ {
+				if _, err := b.SendDocument(1, tc.file, nil); err != nil {
+					t.Fatalf("failed to send document: %v", err)
+				}
+				if client.params["document"] != tc.expectedText {
+					t.Errorf("expected document param %q, got %q", tc.expectedText, client.params["document"])
+				}
+				if client.files["document"] != tc.expectedFile || client.names["document"] != tc.expectedName {
+					t.Errorf("expected file %q with contents %q, got %q with %q", tc.expectedName, tc.expectedFile, client.names["document"], client.files["document"])
+				}
+			}
+		})
+	}
+}
+
+func TestInputFileSourceMedia(t *testing.T) {
+	client := &requestRecorderBotClient{}
+	b := Bot{BotClient: client}
+
+	_, err := b.SendMediaGroup(1, []InputMedia{
+		InputMediaPhoto{Media: InputFileByURL("https://example.com/photo.jpg")},
+		InputMediaPhoto{Media: InputFileFromReader("photo.jpg", bytes.NewReader([]byte("jpg")), 0)},
+	}, nil)
+	if err != nil {
+		t.Fatalf("failed to send media group: %v", err)
+	}
+
+	if !strings.Contains(client.params["media"], `"media":"https://example.com/photo.jpg"`) {
+		t.Errorf("expected URL media to be sent as a string, got %s", client.params["media"])
+	}
+	if len(client.files) != 1 {
+		t.Errorf("expected a single file to be uploaded, got %d", len(client.files))
+	}
+}
+
+func TestInputFileFromMissingPath(t *testing.T) {
+	b := Bot{BotClient: &requestRecorderBotClient{}}
+	if _, err := b.SendDocument(1, InputFileFromPath(filepath.Join(t.TempDir(), "missing")), nil); err == nil {
+		t.Errorf("expected an error for a missing file")
+	}
+}
+
+// retryingBotClient is a fake BotClient middleware, which reads part of the files before failing, and then retries the
+// request; as a network failure during the upload would.
+type retryingBotClient struct {
+	BotClient
+}
+
+func (c retryingBotClient) RequestWithContext(ctx context.Context, method string, params map[string]string, data map[string]NamedReader, opts *RequestOpts) (json.RawMessage, error) {
+	for _, f := range data {
+		if _, err := f.Read(make([]byte, 4)); err != nil {
+			return nil, err
+		}
+	}
+	return c.BotClient.RequestWithContext(ctx, method, params, data, opts)
+}
+
+// newUploadServer creates a test server which records the contents of the uploaded document.
+func newUploadServer(t *testing.T, uploaded *string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f, _, err := r.FormFile("document")
+		if err != nil {
+			t.Errorf("failed to get uploaded file: %v", err)
+			return
+		}
+		bs, err := ioutil.ReadAll(f)
+		if err != nil {
+			t.Errorf("failed to read uploaded file: %v", err)
+		}
+		*uploaded = string(bs)
+		_, _ = w.Write([]byte(`{"ok": true, "result": {"message_id": 1}}`))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestInputFileSourcesRetried(t *testing.T) {
+	var uploaded string
+	server := newUploadServer(t, &uploaded)
+	b := Bot{BotClient: retryingBotClient{&BaseBotClient{
+		Token:              "token",
+		DefaultRequestOpts: &RequestOpts{APIURL: server.URL},
+	}}}
+
+	path := filepath.Join(t.TempDir(), "report.txt")
+	if err := os.WriteFile(path, []byte("file contents"), 0600); err != nil {
+		t.Fatalf("failed to write test file: %v", err)
+	}
+
+	for name, file := range map[string]InputFileSource{
+		"path":   InputFileFromPath(path),
+		"reader": InputFileFromReader("report.txt", strings.NewReader("file contents"), 0),
+	} {
+		t.Run(name, func(t *testing.T) {
+			uploaded = ""
+			if _, err := b.SendDocument(1, file, nil); err != nil {
+				t.Fatalf("failed to send document: %v", err)
+			}
+			if uploaded != "file contents" {
+				t.Errorf("expected the retry to upload the whole file, got %q", uploaded)
+			}
+		})
+	}
+}
+
+func TestLazyFileClose(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.txt")
+	if err := os.WriteFile(path, []byte("file contents"), 0600); err != nil {
+		t.Fatalf("failed to write test file: %v", err)
+	}
+
+	data := map[string]NamedReader{}
+	if _, err := InputFileFromPath(path).Attach("document", data); err != nil {
+		t.Fatalf("failed to attach file: %v", err)
+	}
+	f := data["document"].(*lazyFile)
+	if _, err := f.Read(make([]byte, 4)); err != nil {
+		t.Fatalf("failed to read file: %v", err)
+	}
+
+	// Abandoned requests can close the file before it has been fully read.
+	if err := closeReader(f); err != nil || f.file != nil {
+		t.Errorf("expected the file to be closed, got %v", err)
+	}
+}
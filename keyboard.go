@@ -0,0 +1,318 @@
+package gotgbot
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// MaxInlineKeyboardButtons is the maximum number of buttons in an inline keyboard.
+	MaxInlineKeyboardButtons = 100
+	// MaxInlineKeyboardRowButtons is the maximum number of buttons in a single row of an inline keyboard.
+	MaxInlineKeyboardRowButtons = 8
+	// MaxCallbackDataLength is the maximum length of a button's callback data, in bytes.
+	MaxCallbackDataLength = 64
+)
+
+var ErrInvalidKeyboard = errors.New("invalid keyboard")
+
+// InlineKeyboardBuilder builds InlineKeyboardMarkup row by row, without needing nested slice literals. For example:
+//
+//	markup, err := gotgbot.NewInlineKeyboardBuilder().
+//		Callback("Yes", "confirm:yes").Callback("No", "confirm:no").
+//		Row().
+//		Url("Help", "https://example.com/help").
+//		Build()
+//
+// The zero value is ready to use.
+type InlineKeyboardBuilder struct {
+	rows [][]InlineKeyboardButton
+	// columns is the maximum number of buttons per row, after which a new row is started automatically.
+	columns int
+}
+
+// NewInlineKeyboardBuilder creates a new, empty InlineKeyboardBuilder.
+func NewInlineKeyboardBuilder() *InlineKeyboardBuilder {
+	return &InlineKeyboardBuilder{}
+}
+
+// Columns sets the maximum number of buttons per row. Once a row is full, the following buttons are automatically
+// added to a new row. Set to 0 to disable wrapping.
+func (kb *InlineKeyboardBuilder) Columns(n int) *InlineKeyboardBuilder {
+	kb.columns = n
+	return kb
+}
+
+// Row starts a new row. Calling Row on an empty row has no effect.
+func (kb *InlineKeyboardBuilder) Row() *InlineKeyboardBuilder {
+	if len(kb.rows) > 0 && len(kb.rows[len(kb.rows)-1]) > 0 {
+		kb.rows = append(kb.rows, nil)
+	}
+	return kb
+}
+
+// Button adds a button to the current row.
+func (kb *InlineKeyboardBuilder) Button(btn InlineKeyboardButton) *InlineKeyboardBuilder {
+	if len(kb.rows) == 0 || (kb.columns > 0 && len(kb.rows[len(kb.rows)-1]) >= kb.columns) {
+		kb.rows = append(kb.rows, nil)
+	}
+	kb.rows[len(kb.rows)-1] = append(kb.rows[len(kb.rows)-1], btn)
+	return kb
+}
+
+// Callback adds a button which sends a callback query with the given data.
+func (kb *InlineKeyboardBuilder) Callback(text string, data string) *InlineKeyboardBuilder {
+	return kb.Button(InlineKeyboardButton{Text: text, CallbackData: data})
+}
+
+// Url adds a button which opens the given URL.
+func (kb *InlineKeyboardBuilder) Url(text string, url string) *InlineKeyboardBuilder {
+	return kb.Button(InlineKeyboardButton{Text: text, Url: url})
+}
+
+// WebApp adds a button which opens the Web App at the given URL.
+func (kb *InlineKeyboardBuilder) WebApp(text string, url string) *InlineKeyboardBuilder {
+	return kb.Button(InlineKeyboardButton{Text: text, WebApp: &WebAppInfo{Url: url}})
+}
+
+// SwitchInline adds a button which prompts the user to select a chat, and inserts the bot's username and the given
+// inline query in it.
+func (kb *InlineKeyboardBuilder) SwitchInline(text string, query string) *InlineKeyboardBuilder {
+	return kb.Button(InlineKeyboardButton{Text: text, SwitchInlineQuery: &query})
+}
+
+// SwitchInlineCurrentChat adds a button which inserts the bot's username and the given inline query in the current
+// chat.
+func (kb *InlineKeyboardBuilder) SwitchInlineCurrentChat(text string, query string) *InlineKeyboardBuilder {
+	return kb.Button(InlineKeyboardButton{Text: text, SwitchInlineQueryCurrentChat: &query})
+}
+
+// Rows returns the rows built so far, without validating them.
+func (kb *InlineKeyboardBuilder) Rows() [][]InlineKeyboardButton {
+	rows := make([][]InlineKeyboardButton, 0, len(kb.rows))
+	for _, row := range kb.rows {
+		if len(row) > 0 {
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
+
+// Build returns the built InlineKeyboardMarkup, after checking it with ValidateInlineKeyboard.
+func (kb *InlineKeyboardBuilder) Build() (InlineKeyboardMarkup, error) {
+	markup := InlineKeyboardMarkup{InlineKeyboard: kb.Rows()}
+	if err := ValidateInlineKeyboard(markup); err != nil {
+		return InlineKeyboardMarkup{}, err
+	}
+	return markup, nil
+}
+
+// ValidateInlineKeyboard checks that an inline keyboard would be accepted by telegram: it must not have empty rows, or
+// more buttons than allowed, and each button must have text and exactly one action.
+func ValidateInlineKeyboard(markup InlineKeyboardMarkup) error {
+	if len(markup.InlineKeyboard) == 0 {
+		return fmt.Errorf("%w: no buttons", ErrInvalidKeyboard)
+	}
+
+	total := 0
+	for i, row := range markup.InlineKeyboard {
+		if len(row) == 0 {
+			return fmt.Errorf("%w: row %d is empty", ErrInvalidKeyboard, i)
+		}
+		if len(row) > MaxInlineKeyboardRowButtons {
+			return fmt.Errorf("%w: row %d has %d buttons, maximum is %d", ErrInvalidKeyboard, i, len(row), MaxInlineKeyboardRowButtons)
+		}
+		total += len(row)
+
+		for j, btn := range row {
+			if err := validateInlineKeyboardButton(btn, i == 0 && j == 0); err != nil {
+				return fmt.Errorf("%w: button %d of row %d: %s", ErrInvalidKeyboard, j, i, err)
+			}
+		}
+	}
+	if total > MaxInlineKeyboardButtons {
+		return fmt.Errorf("%w: %d buttons, maximum is %d", ErrInvalidKeyboard, total, MaxInlineKeyboardButtons)
+	}
+	return nil
+}
+
+func validateInlineKeyboardButton(btn InlineKeyboardButton, first bool) error {
+	if btn.Text == "" {
+		return errors.New("text is empty")
+	}
+	if len(btn.CallbackData) > MaxCallbackDataLength {
+		return fmt.Errorf("callback data is %d bytes, maximum is %d", len(btn.CallbackData), MaxCallbackDataLength)
+	}
+	if (btn.CallbackGame != nil || btn.Pay) && !first {
+		return errors.New("game and pay buttons must be the first button of the first row")
+	}
+
+	actions := 0
+	for _, set := range []bool{
+		btn.Url != "",
+		btn.CallbackData != "",
+		btn.WebApp != nil,
+		btn.LoginUrl != nil,
+		btn.SwitchInlineQuery != nil,
+		btn.SwitchInlineQueryCurrentChat != nil,
+		btn.SwitchInlineQueryChosenChat != nil,
+		btn.CallbackGame != nil,
+		btn.Pay,
+	} {
+		if set {
+			actions++
+		}
+	}
+	if actions != 1 {
+		return fmt.Errorf("must have exactly one action, has %d", actions)
+	}
+	return nil
+}
+
+// Paginator splits a list of buttons into pages, adding a navigation row with previous/next buttons and a page
+// indicator. The navigation buttons send the CallbackPrefix followed by the page number, so that the same handler
+// can show the requested page:
+//
+//	p := gotgbot.NewPaginator("items:", 5)
+//	dispatcher.AddHandler(handlers.NewCallback(p.Filter, func(b *gotgbot.Bot, ctx *ext.Context) error {
+//		page, ok := p.ParsePage(ctx.CallbackQuery.Data)
+//		if !ok {
+//			// The page indicator was pressed.
+//			_, err := ctx.CallbackQuery.Answer(b, nil)
+//			return err
+//		}
+//		markup, err := p.Keyboard(itemButtons, page)
+//		...
+//	}))
+type Paginator struct {
+	// CallbackPrefix is prepended to the page number in the callback data of navigation buttons. It should be unique
+	// to this paginator, so that its callback queries can be routed back to it.
+	CallbackPrefix string
+	// PageSize is the number of items per page.
+	PageSize int
+	// Columns is the maximum number of items per row. If 0, each item gets its own row.
+	Columns int
+	// PrevText is the text of the previous page button. Defaults to "«".
+	PrevText string
+	// NextText is the text of the next page button. Defaults to "»".
+	NextText string
+	// IndicatorFormat is the fmt format of the page indicator, given the 1-indexed current page and the number of
+	// pages. Defaults to "%d/%d".
+	IndicatorFormat string
+}
+
+// NewPaginator creates a new Paginator with the default navigation texts.
+func NewPaginator(callbackPrefix string, pageSize int) *Paginator {
+	return &Paginator{
+		CallbackPrefix:  callbackPrefix,
+		PageSize:        pageSize,
+		PrevText:        "«",
+		NextText:        "»",
+		IndicatorFormat: "%d/%d",
+	}
+}
+
+// paginatorIndicatorData is the suffix of the page indicator's callback data.
+const paginatorIndicatorData = "current"
+
+// Pages returns the number of pages needed to show count items. There is always at least one page.
+func (p *Paginator) Pages(count int) int {
+	size := p.pageSize()
+	if count <= size {
+		return 1
+	}
+	return (count + size - 1) / size
+}
+
+// CallbackData returns the callback data of the navigation button for the given 0-indexed page.
+func (p *Paginator) CallbackData(page int) string {
+	return p.CallbackPrefix + strconv.Itoa(page)
+}
+
+// ParsePage returns the 0-indexed page requested by the callback data of a navigation button. Returns false if the
+// data doesn't belong to this paginator, or if it belongs to the page indicator.
+func (p *Paginator) ParsePage(data string) (int, bool) {
+	if !strings.HasPrefix(data, p.CallbackPrefix) {
+		return 0, false
+	}
+	page, err := strconv.Atoi(strings.TrimPrefix(data, p.CallbackPrefix))
+	if err != nil || page < 0 {
+		return 0, false
+	}
+	return page, true
+}
+
+// Filter matches the callback queries sent by the navigation buttons of this paginator. It can be used as a
+// handlers.NewCallback filter.
+func (p *Paginator) Filter(cq *CallbackQuery) bool {
+	return strings.HasPrefix(cq.Data, p.CallbackPrefix)
+}
+
+// Keyboard builds the InlineKeyboardMarkup for the given 0-indexed page of items. Out of range pages are clamped to
+// the first or last page.
+func (p *Paginator) Keyboard(items []InlineKeyboardButton, page int) (InlineKeyboardMarkup, error) {
+	return p.AddPage(NewInlineKeyboardBuilder(), items, page).Build()
+}
+
+// AddPage adds the rows for the given 0-indexed page of items to the keyboard builder, followed by the navigation
+// row. This allows for adding more rows before or after the page. The navigation row is omitted if there is only
+// one page. The builder's column setting is restored afterwards.
+func (p *Paginator) AddPage(kb *InlineKeyboardBuilder, items []InlineKeyboardButton, page int) *InlineKeyboardBuilder {
+	// Restore the caller's columns once the page has been added, so that any later rows are laid out as before.
+	prevColumns := kb.columns
+	defer kb.Columns(prevColumns)
+
+	pages := p.Pages(len(items))
+	if page >= pages {
+		page = pages - 1
+	}
+	if page < 0 {
+		page = 0
+	}
+
+	start := page * p.pageSize()
+	end := start + p.pageSize()
+	if end > len(items) {
+		end = len(items)
+	}
+
+	columns := p.Columns
+	if columns <= 0 {
+		columns = 1
+	}
+	kb.Row().Columns(columns)
+	for _, item := range items[start:end] {
+		kb.Button(item)
+	}
+	kb.Columns(0)
+
+	if pages == 1 {
+		return kb.Row()
+	}
+
+	kb.Row()
+	if page > 0 {
+		kb.Callback(orDefault(p.PrevText, "«"), p.CallbackData(page-1))
+	}
+	kb.Callback(fmt.Sprintf(orDefault(p.IndicatorFormat, "%d/%d"), page+1, pages), p.CallbackPrefix+paginatorIndicatorData)
+	if page < pages-1 {
+		kb.Callback(orDefault(p.NextText, "»"), p.CallbackData(page+1))
+	}
+	return kb.Row()
+}
+
+func (p *Paginator) pageSize() int {
+	if p.PageSize <= 0 {
+		return 1
+	}
+	return p.PageSize
+}
+
+func orDefault(s string, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
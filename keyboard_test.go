@@ -0,0 +1,159 @@
+package gotgbot
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestInlineKeyboardBuilder(t *testing.T) {
+	markup, err := NewInlineKeyboardBuilder().
+		Callback("Yes", "yes").Callback("No", "no").
+		Row().
+		Url("Docs", "https://example.com").
+		WebApp("App", "https://example.com/app").
+		Row().Row().
+		SwitchInline("Share", "query").
+		Build()
+	if err != nil {
+		t.Fatalf("failed to build keyboard: %v", err)
+	}
+
+	query := "query"
+	want := [][]InlineKeyboardButton{
+		{{Text: "Yes", CallbackData: "yes"}, {Text: "No", CallbackData: "no"}},
+		{{Text: "Docs", Url: "https://example.com"}, {Text: "App", WebApp: &WebAppInfo{Url: "https://example.com/app"}}},
+		{{Text: "Share", SwitchInlineQuery: &query}},
+	}
+	if !reflect.DeepEqual(markup.InlineKeyboard, want) {
+		t.Errorf("expected %+v, got %+v", want, markup.InlineKeyboard)
+	}
+}
+
+func TestInlineKeyboardBuilder_Columns(t *testing.T) {
+	kb := NewInlineKeyboardBuilder().Columns(2)
+	for i := 0; i < 5; i++ {
+		kb.Callback(strconv.Itoa(i), strconv.Itoa(i))
+	}
+
+	var sizes []int
+	for _, row := range kb.Rows() {
+		sizes = append(sizes, len(row))
+	}
+	if !reflect.DeepEqual(sizes, []int{2, 2, 1}) {
+		t.Errorf("expected rows to wrap after 2 columns, got row sizes %v", sizes)
+	}
+}
+
+func TestValidateInlineKeyboard(t *testing.T) {
+	tooManyRows := NewInlineKeyboardBuilder().Columns(MaxInlineKeyboardRowButtons)
+	for i := 0; i <= MaxInlineKeyboardButtons; i++ {
+		tooManyRows.Callback("x", "x")
+	}
+
+	for name, markup := range map[string]InlineKeyboardMarkup{
+		"no buttons":        {},
+		"empty row":         {InlineKeyboard: [][]InlineKeyboardButton{{{Text: "a", CallbackData: "a"}}, {}}},
+		"row too long":      {InlineKeyboard: [][]InlineKeyboardButton{make([]InlineKeyboardButton, MaxInlineKeyboardRowButtons+1)}},
+		"too many buttons":  {InlineKeyboard: tooManyRows.Rows()},
+		"no text":           {InlineKeyboard: [][]InlineKeyboardButton{{{CallbackData: "a"}}}},
+		"no action":         {InlineKeyboard: [][]InlineKeyboardButton{{{Text: "a"}}}},
+		"two actions":       {InlineKeyboard: [][]InlineKeyboardButton{{{Text: "a", CallbackData: "a", Url: "https://example.com"}}}},
+		"long callback":     {InlineKeyboard: [][]InlineKeyboardButton{{{Text: "a", CallbackData: strings.Repeat("a", 65)}}}},
+		"pay not first":     {InlineKeyboard: [][]InlineKeyboardButton{{{Text: "a", CallbackData: "a"}, {Text: "pay", Pay: true}}}},
+		"game in other row": {InlineKeyboard: [][]InlineKeyboardButton{{{Text: "a", CallbackData: "a"}}, {{Text: "play", CallbackGame: &CallbackGame{}}}}},
+	} {
+		if err := ValidateInlineKeyboard(markup); !errors.Is(err, ErrInvalidKeyboard) {
+			t.Errorf("%s: expected ErrInvalidKeyboard, got %v", name, err)
+		}
+	}
+
+	if _, err := tooManyRows.Build(); !errors.Is(err, ErrInvalidKeyboard) {
+		t.Errorf("expected Build to reject too many buttons, got %v", err)
+	}
+}
+
+func TestPaginator(t *testing.T) {
+	var items []InlineKeyboardButton
+	for i := 0; i < 7; i++ {
+		items = append(items, InlineKeyboardButton{Text: strconv.Itoa(i), CallbackData: "item:" + strconv.Itoa(i)})
+	}
+
+	p := NewPaginator("items:", 3)
+	p.Columns = 2
+
+	for _, tc := range []struct {
+		page     int
+		items    []string
+		nav      []string
+		navData  []string
+		rowSizes []int
+	}{
+		{page: 0, items: []string{"0", "1", "2"}, nav: []string{"1/3", "»"}, navData: []string{"items:current", "items:1"}, rowSizes: []int{2, 1, 2}},
+		{page: 1, items: []string{"3", "4", "5"}, nav: []string{"«", "2/3", "»"}, navData: []string{"items:0", "items:current", "items:2"}, rowSizes: []int{2, 1, 3}},
+		{page: 2, items: []string{"6"}, nav: []string{"«", "3/3"}, navData: []string{"items:1", "items:current"}, rowSizes: []int{1, 2}},
+		// Out of range pages are clamped.
+		{page: 10, items: []string{"6"}, nav: []string{"«", "3/3"}, navData: []string{"items:1", "items:current"}, rowSizes: []int{1, 2}},
+	} {
+		markup, err := p.Keyboard(items, tc.page)
+		if err != nil {
+			t.Fatalf("page %d: failed to build keyboard: %v", tc.page, err)
+		}
+
+		var sizes []int
+		var gotItems []string
+		for _, row := range markup.InlineKeyboard[:len(markup.InlineKeyboard)-1] {
+			for _, btn := range row {
+				gotItems = append(gotItems, btn.Text)
+			}
+		}
+		var gotNav, gotNavData []string
+		for _, btn := range markup.InlineKeyboard[len(markup.InlineKeyboard)-1] {
+			gotNav = append(gotNav, btn.Text)
+			gotNavData = append(gotNavData, btn.CallbackData)
+		}
+		for _, row := range markup.InlineKeyboard {
+			sizes = append(sizes, len(row))
+		}
+
+		if !reflect.DeepEqual(gotItems, tc.items) || !reflect.DeepEqual(gotNav, tc.nav) || !reflect.DeepEqual(gotNavData, tc.navData) || !reflect.DeepEqual(sizes, tc.rowSizes) {
+			t.Errorf("page %d: unexpected keyboard %+v", tc.page, markup.InlineKeyboard)
+		}
+	}
+
+	// A single page has no navigation row.
+	markup, err := p.Keyboard(items[:2], 0)
+	if err != nil {
+		t.Fatalf("failed to build keyboard: %v", err)
+	}
+	if len(markup.InlineKeyboard) != 1 {
+		t.Errorf("expected a single row, got %+v", markup.InlineKeyboard)
+	}
+
+	// The builder's own columns are kept for the rows added after the page.
+	kb := NewInlineKeyboardBuilder().Columns(3)
+	p.AddPage(kb, items, 0)
+	for i := 0; i < 4; i++ {
+		kb.Callback(strconv.Itoa(i), "extra")
+	}
+	rows := kb.Rows()
+	if len(rows) != 5 || len(rows[3]) != 3 || len(rows[4]) != 1 {
+		t.Errorf("expected the builder's columns to be restored, got %+v", rows)
+	}
+
+	for data, want := range map[string]int{"items:2": 2, "items:0": 0} {
+		if page, ok := p.ParsePage(data); !ok || page != want {
+			t.Errorf("expected page %d for %q, got %d (%v)", want, data, page, ok)
+		}
+	}
+	for _, data := range []string{"items:current", "items:-1", "other:1"} {
+		if _, ok := p.ParsePage(data); ok {
+			t.Errorf("expected %q not to be a page", data)
+		}
+	}
+	if !p.Filter(&CallbackQuery{Data: "items:current"}) || p.Filter(&CallbackQuery{Data: "other:1"}) {
+		t.Errorf("expected filter to match the paginator's callback data only")
+	}
+}
@@ -0,0 +1,674 @@
+package gotgbot
+
+import (
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+)
+
+// ParseError describes why formatted text can't be parsed, and where.
+// The messages mirror the "can't parse entities" errors returned by telegram.
+type ParseError struct {
+	// Offset is the byte offset in the input at which the error was found.
+	Offset int
+	// Reason describes what went wrong.
+	Reason string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("can't parse entities: %s at byte offset %d", e.Reason, e.Offset)
+}
+
+func newParseError(offset int, format string, args ...interface{}) *ParseError {
+	return &ParseError{
+		Offset: offset,
+		Reason: fmt.Sprintf(format, args...),
+	}
+}
+
+// ParseHTML parses text using telegram's HTML parse mode, and returns the plain text and its entities.
+// This allows for validating HTML before sending it; the result can be sent as-is with the Entities or
+// CaptionEntities fields, or the original text can be sent with the "HTML" ParseMode.
+// Use SanitizeHTML to clean up untrusted HTML first.
+// See https://core.telegram.org/bots/api#html-style for more details.
+func ParseHTML(s string) (string, []MessageEntity, error) {
+	tb := &TextBuilder{}
+	var stack []openHTMLTag
+
+	for i := 0; i < len(s); {
+		switch s[i] {
+		case '<':
+			tag, end, err := readHTMLTag(s, i)
+			if err != nil {
+				return "", nil, err
+			}
+			i = end
+
+			if !tag.closing {
+				open, err := newOpenHTMLTag(tb, tag, stack)
+				if err != nil {
+					return "", nil, err
+				}
+				stack = append(stack, open)
+				continue
+			}
+
+			if len(stack) == 0 {
+				return "", nil, newParseError(tag.pos, "Unexpected end tag")
+			}
+			top := stack[len(stack)-1]
+			if top.name != tag.name {
+				return "", nil, newParseError(tag.pos, "Unmatched end tag, expected \"</%s>\", found \"</%s>\"", top.name, tag.name)
+			}
+			stack = stack[:len(stack)-1]
+			if top.entity >= 0 {
+				tb.closeEntity(top.entity)
+			}
+
+		case '&':
+			text, n := readHTMLEntity(s[i:])
+			tb.Plain(text)
+			i += n
+
+		default:
+			next := strings.IndexAny(s[i:], "<&")
+			if next < 0 {
+				next = len(s) - i
+			}
+			tb.Plain(s[i : i+next])
+			i += next
+		}
+	}
+
+	if len(stack) > 0 {
+		top := stack[len(stack)-1]
+		return "", nil, newParseError(top.pos, "Can't find end tag corresponding to start tag \"%s\"", top.name)
+	}
+
+	return tb.Text(), tb.Entities(), nil
+}
+
+// SanitizeHTML converts arbitrary HTML to the subset of HTML supported by telegram, so that it can always be parsed
+// by ParseHTML. Unsupported tags and attributes are removed, but their contents are kept; unclosed tags are closed,
+// and stray '<' and '&' characters are escaped.
+func SanitizeHTML(s string) string {
+	bd := strings.Builder{}
+	var stack []sanitizedHTMLTag
+
+	closeTags := func(idx int) {
+		for len(stack) > idx {
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if top.keep {
+				bd.WriteString("</" + top.name + ">")
+			}
+		}
+	}
+
+	for i := 0; i < len(s); {
+		switch s[i] {
+		case '<':
+			tag, end, err := readHTMLTag(s, i)
+			if err != nil {
+				bd.WriteString("&lt;")
+				i++
+				continue
+			}
+			i = end
+
+			if tag.closing {
+				for idx := len(stack) - 1; idx >= 0; idx-- {
+					if stack[idx].name == tag.name {
+						closeTags(idx)
+						break
+					}
+				}
+				continue
+			}
+
+			if _, ok := htmlTagEntities[tag.name]; !ok {
+				// Unsupported tags, such as <br> or <div>, are dropped entirely.
+				continue
+			}
+			out, keep := sanitizeHTMLTag(tag)
+			if keep {
+				bd.WriteString(out)
+			}
+			stack = append(stack, sanitizedHTMLTag{name: tag.name, keep: keep})
+
+		case '&':
+			if _, n := readHTMLEntity(s[i:]); n > 1 {
+				bd.WriteString(s[i : i+n])
+				i += n
+				continue
+			}
+			bd.WriteString("&amp;")
+			i++
+
+		default:
+			next := strings.IndexAny(s[i:], "<&")
+			if next < 0 {
+				next = len(s) - i
+			}
+			bd.WriteString(s[i : i+next])
+			i += next
+		}
+	}
+
+	closeTags(0)
+	return bd.String()
+}
+
+// htmlTagEntities maps the supported HTML tags to their entity types.
+var htmlTagEntities = map[string]string{
+	"b":          "bold",
+	"strong":     "bold",
+	"i":          "italic",
+	"em":         "italic",
+	"u":          "underline",
+	"ins":        "underline",
+	"s":          "strikethrough",
+	"strike":     "strikethrough",
+	"del":        "strikethrough",
+	"span":       "spoiler",
+	"tg-spoiler": "spoiler",
+	"a":          "text_link",
+	"tg-emoji":   "custom_emoji",
+	"code":       "code",
+	"pre":        "pre",
+}
+
+// htmlTag is a parsed HTML start or end tag.
+type htmlTag struct {
+	name    string
+	closing bool
+	attrs   map[string]string
+	// pos is the byte offset of the tag in the input.
+	pos int
+}
+
+// openHTMLTag is a start tag waiting for its end tag.
+type openHTMLTag struct {
+	name string
+	pos  int
+	// entity is the index of the entity opened by this tag, or -1 if there is none.
+	entity int
+}
+
+// sanitizedHTMLTag is a start tag waiting for its end tag during sanitization.
+type sanitizedHTMLTag struct {
+	name string
+	// keep is false if the tag was removed, in which case the end tag must be removed too.
+	keep bool
+}
+
+// readHTMLTag reads the HTML tag starting at s[i], which must be '<'. It returns the tag, and the byte offset after it.
+func readHTMLTag(s string, i int) (htmlTag, int, error) {
+	tag := htmlTag{pos: i}
+	j := i + 1
+	if j < len(s) && s[j] == '/' {
+		tag.closing = true
+		j++
+	}
+
+	nameEnd := j
+	for nameEnd < len(s) && isHTMLNameChar(s[nameEnd]) {
+		nameEnd++
+	}
+	if nameEnd == j {
+		return htmlTag{}, 0, newParseError(i, "Expected HTML tag name")
+	}
+	tag.name = strings.ToLower(s[j:nameEnd])
+	j = skipHTMLSpaces(s, nameEnd)
+
+	if tag.closing {
+		if j >= len(s) || s[j] != '>' {
+			return htmlTag{}, 0, newParseError(i, "Expected '>' after end tag \"%s\"", tag.name)
+		}
+		return tag, j + 1, nil
+	}
+
+	tag.attrs = map[string]string{}
+	for {
+		if j >= len(s) {
+			return htmlTag{}, 0, newParseError(i, "Unclosed start tag \"%s\"", tag.name)
+		}
+		if s[j] == '>' {
+			return tag, j + 1, nil
+		}
+
+		attrEnd := j
+		for attrEnd < len(s) && isHTMLNameChar(s[attrEnd]) {
+			attrEnd++
+		}
+		if attrEnd == j {
+			return htmlTag{}, 0, newParseError(j, "Expected attribute name in start tag \"%s\"", tag.name)
+		}
+		attr := strings.ToLower(s[j:attrEnd])
+		j = skipHTMLSpaces(s, attrEnd)
+
+		if j >= len(s) || s[j] != '=' {
+			tag.attrs[attr] = ""
+			continue
+		}
+		j = skipHTMLSpaces(s, j+1)
+		if j >= len(s) {
+			return htmlTag{}, 0, newParseError(i, "Unclosed start tag \"%s\"", tag.name)
+		}
+
+		var value string
+		if quote := s[j]; quote == '"' || quote == '\'' {
+			valueEnd := strings.IndexByte(s[j+1:], quote)
+			if valueEnd < 0 {
+				return htmlTag{}, 0, newParseError(j, "Unclosed value of attribute \"%s\"", attr)
+			}
+			value = s[j+1 : j+1+valueEnd]
+			j += valueEnd + 2
+		} else {
+			valueEnd := j
+			for valueEnd < len(s) && s[valueEnd] != '>' && !isHTMLSpace(s[valueEnd]) {
+				valueEnd++
+			}
+			value = s[j:valueEnd]
+			j = valueEnd
+		}
+		tag.attrs[attr] = decodeHTMLEntities(value)
+		j = skipHTMLSpaces(s, j)
+	}
+}
+
+// newOpenHTMLTag validates a start tag, and creates the matching entity.
+func newOpenHTMLTag(tb *TextBuilder, tag htmlTag, stack []openHTMLTag) (openHTMLTag, error) {
+	open := openHTMLTag{
+		name:   tag.name,
+		pos:    tag.pos,
+		entity: -1,
+	}
+
+	entType, ok := htmlTagEntities[tag.name]
+	if !ok {
+		return openHTMLTag{}, newParseError(tag.pos, "Unsupported start tag \"%s\"", tag.name)
+	}
+	ent := MessageEntity{Type: entType}
+
+	switch tag.name {
+	case "span":
+		if tag.attrs["class"] != "tg-spoiler" {
+			return openHTMLTag{}, newParseError(tag.pos, "Tag \"span\" must have class \"tg-spoiler\"")
+		}
+
+	case "a":
+		href := tag.attrs["href"]
+		if href == "" {
+			// Links without a URL are ignored.
+			return open, nil
+		}
+		if userId, ok := parseUserURL(href); ok {
+			ent = MessageEntity{Type: "text_mention", User: &User{Id: userId}}
+		} else {
+			ent.Url = href
+		}
+
+	case "tg-emoji":
+		emojiId := tag.attrs["emoji-id"]
+		if emojiId == "" {
+			return openHTMLTag{}, newParseError(tag.pos, "Tag \"tg-emoji\" must have attribute \"emoji-id\"")
+		}
+		ent.CustomEmojiId = emojiId
+
+	case "code":
+		// <pre><code class="language-go"> sets the language of the pre entity, rather than creating a code entity.
+		lang := strings.TrimPrefix(tag.attrs["class"], "language-")
+		if len(stack) > 0 && lang != tag.attrs["class"] && lang != "" {
+			pre := stack[len(stack)-1]
+			if pre.name == "pre" && tb.entities[pre.entity].Offset == tb.Len() && tb.entities[pre.entity].Language == "" {
+				tb.entities[pre.entity].Language = lang
+				return open, nil
+			}
+		}
+	}
+
+	open.entity = tb.openEntity(ent)
+	return open, nil
+}
+
+// sanitizeHTMLTag rewrites a supported start tag with only its supported attributes. If the tag isn't valid, it
+// returns false.
+func sanitizeHTMLTag(tag htmlTag) (string, bool) {
+	switch tag.name {
+	case "span":
+		if tag.attrs["class"] != "tg-spoiler" {
+			return "", false
+		}
+		return `<span class="tg-spoiler">`, true
+	case "a":
+		if tag.attrs["href"] == "" {
+			return "", false
+		}
+		return `<a href="` + html.EscapeString(tag.attrs["href"]) + `">`, true
+	case "tg-emoji":
+		if tag.attrs["emoji-id"] == "" {
+			return "", false
+		}
+		return `<tg-emoji emoji-id="` + html.EscapeString(tag.attrs["emoji-id"]) + `">`, true
+	case "code":
+		if class := tag.attrs["class"]; strings.HasPrefix(class, "language-") {
+			return `<code class="` + html.EscapeString(class) + `">`, true
+		}
+	}
+	return "<" + tag.name + ">", true
+}
+
+// readHTMLEntity decodes the HTML entity at the start of s, and returns the number of bytes used.
+// Only the entities supported by telegram are decoded; anything else is treated as a literal '&'.
+func readHTMLEntity(s string) (string, int) {
+	end := strings.IndexByte(s, ';')
+	if end < 2 || end > 10 {
+		return "&", 1
+	}
+
+	name := s[1:end]
+	switch name {
+	case "lt":
+		return "<", end + 1
+	case "gt":
+		return ">", end + 1
+	case "amp":
+		return "&", end + 1
+	case "quot":
+		return "\"", end + 1
+	}
+
+	if name[0] != '#' {
+		return "&", 1
+	}
+	var code uint64
+	var err error
+	if len(name) > 1 && (name[1] == 'x' || name[1] == 'X') {
+		code, err = strconv.ParseUint(name[2:], 16, 32)
+	} else {
+		code, err = strconv.ParseUint(name[1:], 10, 32)
+	}
+	if err != nil || code == 0 || code > 0x10FFFF || (code >= 0xD800 && code <= 0xDFFF) {
+		return "&", 1
+	}
+	return string(rune(code)), end + 1
+}
+
+func decodeHTMLEntities(s string) string {
+	if !strings.Contains(s, "&") {
+		return s
+	}
+
+	bd := strings.Builder{}
+	for i := 0; i < len(s); {
+		if s[i] != '&' {
+			bd.WriteByte(s[i])
+			i++
+			continue
+		}
+		text, n := readHTMLEntity(s[i:])
+		bd.WriteString(text)
+		i += n
+	}
+	return bd.String()
+}
+
+func isHTMLNameChar(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '-' || c == '_'
+}
+
+func isHTMLSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+func skipHTMLSpaces(s string, i int) int {
+	for i < len(s) && isHTMLSpace(s[i]) {
+		i++
+	}
+	return i
+}
+
+// mdV2Reserved contains all the characters which must be escaped in MarkdownV2 text.
+const mdV2Reserved = "_*[]()~`>#+-=|{}.!"
+
+// mdV2EntityNames maps the MarkdownV2 tokens to the entity names used in error messages.
+var mdV2EntityNames = map[string]string{
+	"*":  "bold",
+	"_":  "italic",
+	"__": "underline",
+	"~":  "strikethrough",
+	"||": "spoiler",
+	"[":  "text_link",
+	"![": "custom_emoji",
+}
+
+// openMDV2Entity is a MarkdownV2 entity waiting for its closing token.
+type openMDV2Entity struct {
+	token string
+	pos   int
+	// entity is the index of the opened entity.
+	entity int
+}
+
+// ParseMarkdownV2 parses text using telegram's MarkdownV2 parse mode, and returns the plain text and its entities.
+// This allows for validating MarkdownV2 before sending it; the result can be sent as-is with the Entities or
+// CaptionEntities fields, or the original text can be sent with the "MarkdownV2" ParseMode.
+// See https://core.telegram.org/bots/api#markdownv2-style for more details.
+func ParseMarkdownV2(s string) (string, []MessageEntity, error) {
+	tb := &TextBuilder{}
+	var stack []openMDV2Entity
+
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '\\':
+			if i+1 < len(s) && s[i+1] > 0 && s[i+1] <= 126 {
+				tb.Plain(s[i+1 : i+2])
+				i += 2
+				continue
+			}
+			tb.Plain("\\")
+			i++
+			continue
+
+		case c == '\r':
+			// Carriage returns are ignored, to allow for separating ambiguous tokens.
+			i++
+			continue
+
+		case c == '`':
+			end, err := parseMDV2Code(tb, s, i)
+			if err != nil {
+				return "", nil, err
+			}
+			i = end
+			continue
+
+		case !strings.ContainsRune(mdV2Reserved, rune(c)):
+			next := i + 1
+			for next < len(s) && !strings.ContainsRune(mdV2Reserved+"\\\r", rune(s[next])) {
+				next++
+			}
+			tb.Plain(s[i:next])
+			i = next
+			continue
+		}
+
+		if c == ']' && len(stack) > 0 && (stack[len(stack)-1].token == "[" || stack[len(stack)-1].token == "![") {
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			end, err := closeMDV2Link(tb, s, i, top)
+			if err != nil {
+				return "", nil, err
+			}
+			i = end
+			continue
+		}
+
+		token := mdV2Token(s, i)
+		if token == "" {
+			return "", nil, newParseError(i, "Character '%c' is reserved and must be escaped with the preceding '\\'", c)
+		}
+		if len(stack) > 0 && stack[len(stack)-1].token == token && token != "[" && token != "![" {
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			tb.closeEntity(top.entity)
+		} else {
+			stack = append(stack, openMDV2Entity{
+				token:  token,
+				pos:    i,
+				entity: tb.openEntity(MessageEntity{Type: mdV2EntityNames[token]}),
+			})
+		}
+		i += len(token)
+	}
+
+	if len(stack) > 0 {
+		top := stack[len(stack)-1]
+		return "", nil, newParseError(top.pos, "Can't find end of %s entity", mdV2EntityNames[top.token])
+	}
+
+	return tb.Text(), tb.Entities(), nil
+}
+
+// mdV2Token returns the entity token starting at s[i], or an empty string if there is none.
+func mdV2Token(s string, i int) string {
+	next := byte(0)
+	if i+1 < len(s) {
+		next = s[i+1]
+	}
+
+	switch s[i] {
+	case '*', '~', '[':
+		return s[i : i+1]
+	case '_':
+		// Ambiguous underscores are always greedily treated as underline tokens.
+		if next == '_' {
+			return "__"
+		}
+		return "_"
+	case '|':
+		if next == '|' {
+			return "||"
+		}
+	case '!':
+		if next == '[' {
+			return "!["
+		}
+	}
+	return ""
+}
+
+// parseMDV2Code parses an inline code or pre entity starting at s[i], and returns the byte offset after it.
+func parseMDV2Code(tb *TextBuilder, s string, i int) (int, error) {
+	start := i
+	ent := MessageEntity{Type: "code"}
+	closing := "`"
+
+	if strings.HasPrefix(s[i:], "```") {
+		ent.Type = "pre"
+		closing = "```"
+		i += 3
+
+		// The language is only set if it is followed by whitespace.
+		langEnd := i
+		for langEnd < len(s) && !isHTMLSpace(s[langEnd]) && s[langEnd] != '`' {
+			langEnd++
+		}
+		if langEnd != i && langEnd < len(s) && s[langEnd] != '`' {
+			ent.Language = s[i:langEnd]
+			i = langEnd
+		}
+
+		// Skip a single newline at the start of the block.
+		if strings.HasPrefix(s[i:], "\r\n") {
+			i += 2
+		} else if i < len(s) && (s[i] == '\n' || s[i] == '\r') {
+			i++
+		}
+	} else {
+		i++
+	}
+
+	idx := tb.openEntity(ent)
+	for i < len(s) {
+		if s[i] == '\\' && i+1 < len(s) && s[i+1] > 0 && s[i+1] <= 126 {
+			tb.Plain(s[i+1 : i+2])
+			i += 2
+			continue
+		}
+		if strings.HasPrefix(s[i:], closing) {
+			tb.closeEntity(idx)
+			return i + len(closing), nil
+		}
+
+		next := i + 1
+		for next < len(s) && s[next] != '\\' && s[next] != '`' {
+			next++
+		}
+		tb.Plain(s[i:next])
+		i = next
+	}
+
+	return 0, newParseError(start, "Can't find end of %s entity", ent.Type)
+}
+
+// closeMDV2Link parses the URL of a link or custom emoji entity, from the closing ']' at s[i].
+// It returns the byte offset after the URL.
+func closeMDV2Link(tb *TextBuilder, s string, i int, open openMDV2Entity) (int, error) {
+	i++
+	var url string
+	if i < len(s) && s[i] == '(' {
+		bd := strings.Builder{}
+		j := i + 1
+		for ; j < len(s) && s[j] != ')'; j++ {
+			if s[j] == '\\' && j+1 < len(s) && s[j+1] > 0 && s[j+1] <= 126 {
+				j++
+			}
+			bd.WriteByte(s[j])
+		}
+		if j >= len(s) {
+			return 0, newParseError(i, "Can't find end of a URL")
+		}
+		url = bd.String()
+		i = j + 1
+	}
+
+	if open.token == "![" {
+		emojiId := strings.TrimPrefix(url, "tg://emoji?id=")
+		if emojiId == url || emojiId == "" {
+			return 0, newParseError(open.pos, "Custom emoji entity must contain a tg://emoji URL")
+		}
+		tb.entities[open.entity].CustomEmojiId = emojiId
+		tb.closeEntity(open.entity)
+		return i, nil
+	}
+
+	if url == "" {
+		// Links without a URL are kept as plain text, so the entity is left empty.
+		return i, nil
+	}
+	if userId, ok := parseUserURL(url); ok {
+		tb.entities[open.entity].Type = "text_mention"
+		tb.entities[open.entity].User = &User{Id: userId}
+	} else {
+		tb.entities[open.entity].Url = url
+	}
+	tb.closeEntity(open.entity)
+	return i, nil
+}
+
+// parseUserURL extracts the user ID from "tg://user?id=<id>" URLs, which are used for text mentions.
+func parseUserURL(url string) (int64, bool) {
+	rawId := strings.TrimPrefix(url, "tg://user?id=")
+	if rawId == url {
+		return 0, false
+	}
+	userId, err := strconv.ParseInt(rawId, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return userId, true
+}
@@ -0,0 +1,204 @@
+package gotgbot
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseHTML(t *testing.T) {
+	for name, tc := range map[string]struct {
+		input    string
+		text     string
+		entities []MessageEntity
+	}{
+		"plain": {
+			input: "hello &lt;world&gt; &amp; &quot;friends&quot; &#128075; &unknown; AT&T",
+			text:  `hello <world> & "friends" 👋 &unknown; AT&T`,
+		},
+		"nested": {
+			input: "<b>bold <i>both</i></b> <S>strike</S>",
+			text:  "bold both strike",
+			entities: []MessageEntity{
+				{Type: "bold", Offset: 0, Length: 9},
+				{Type: "italic", Offset: 5, Length: 4},
+				{Type: "strikethrough", Offset: 10, Length: 6},
+			},
+		},
+		"links": {
+			input: `<a href="https://example.com/?a=1&amp;b=2">link</a> <a href='tg://user?id=123'>user</a> <a>none</a>`,
+			text:  "link user none",
+			entities: []MessageEntity{
+				{Type: "text_link", Offset: 0, Length: 4, Url: "https://example.com/?a=1&b=2"},
+				{Type: "text_mention", Offset: 5, Length: 4, User: &User{Id: 123}},
+			},
+		},
+		"spoilers and emoji": {
+			input: `<span class="tg-spoiler">a</span><tg-spoiler>b</tg-spoiler><tg-emoji emoji-id="5368324170671202286">👍</tg-emoji>`,
+			text:  "ab👍",
+			entities: []MessageEntity{
+				{Type: "spoiler", Offset: 0, Length: 1},
+				{Type: "spoiler", Offset: 1, Length: 1},
+				{Type: "custom_emoji", Offset: 2, Length: 2, CustomEmojiId: "5368324170671202286"},
+			},
+		},
+		"pre with language": {
+			input: `<pre><code class="language-go">x := 1</code></pre><code>y</code>`,
+			text:  "x := 1y",
+			entities: []MessageEntity{
+				{Type: "pre", Offset: 0, Length: 6, Language: "go"},
+				{Type: "code", Offset: 6, Length: 1},
+			},
+		},
+		"empty entities are dropped": {
+			input: "<b></b>text",
+			text:  "text",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			text, entities, err := ParseHTML(tc.input)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if text != tc.text {
+				t.Errorf("expected text %q, got %q", tc.text, text)
+			}
+			if len(entities) != 0 || len(tc.entities) != 0 {
+				if !reflect.DeepEqual(entities, tc.entities) {
+					t.Errorf("expected entities %+v, got %+v", tc.entities, entities)
+				}
+			}
+		})
+	}
+}
+
+func TestParseHTMLErrors(t *testing.T) {
+	for input, offset := range map[string]int{
+		"<b>unclosed":                 0,
+		"a <b>b</i>":                  6,
+		"</b>":                        0,
+		"<div>unsupported</div>":      0,
+		"1 < 2":                       2,
+		`<span class="x">text</span>`: 0,
+		"<tg-emoji>👍</tg-emoji>":      0,
+		`<a href="x>link</a>`:         8,
+	} {
+		_, _, err := ParseHTML(input)
+		var parseErr *ParseError
+		if !errors.As(err, &parseErr) {
+			t.Errorf("expected parse error for %q, got %v", input, err)
+			continue
+		}
+		if parseErr.Offset != offset {
+			t.Errorf("expected error for %q at offset %d, got %d: %v", input, offset, parseErr.Offset, err)
+		}
+	}
+}
+
+func TestSanitizeHTML(t *testing.T) {
+	for input, expected := range map[string]string{
+		"plain text":                                     "plain text",
+		"1 < 2 & 3 > 2 &amp; done":                       "1 &lt; 2 &amp; 3 > 2 &amp; done",
+		"<div><b>bold</b><br></div>":                     "<b>bold</b>",
+		"<b>unclosed <i>tags":                            "<b>unclosed <i>tags</i></b>",
+		"<b>bold <i>italic</b> after</i>":                "<b>bold <i>italic</i></b> after",
+		`<a href="https://x.com" target="_blank">x</a>`:  `<a href="https://x.com">x</a>`,
+		`<span style="color: red">red</span>`:            "red",
+		`<pre><code class="language-go">go</code></pre>`: `<pre><code class="language-go">go</code></pre>`,
+	} {
+		out := SanitizeHTML(input)
+		if out != expected {
+			t.Errorf("expected %q to be sanitized as %q, got %q", input, expected, out)
+		}
+		if _, _, err := ParseHTML(out); err != nil {
+			t.Errorf("expected sanitized HTML %q to be valid: %v", out, err)
+		}
+	}
+}
+
+func TestParseMarkdownV2(t *testing.T) {
+	for name, tc := range map[string]struct {
+		input    string
+		text     string
+		entities []MessageEntity
+	}{
+		"escaped": {
+			input: `1 \+ 1 \= 2\. \\o/ \*not bold\*`,
+			text:  `1 + 1 = 2. \o/ *not bold*`,
+		},
+		"nested": {
+			input: "*bold _italic bold ~strike~ __underline italic___* ||spoiler||",
+			text:  "bold italic bold strike underline italic spoiler",
+			entities: []MessageEntity{
+				{Type: "bold", Offset: 0, Length: 40},
+				{Type: "italic", Offset: 5, Length: 35},
+				{Type: "strikethrough", Offset: 17, Length: 6},
+				{Type: "underline", Offset: 24, Length: 16},
+				{Type: "spoiler", Offset: 41, Length: 7},
+			},
+		},
+		"links": {
+			input: `[link](https://example.com/a_(b\)) [user](tg://user?id=123) ![👍](tg://emoji?id=5368324170671202286)`,
+			text:  "link user 👍",
+			entities: []MessageEntity{
+				{Type: "text_link", Offset: 0, Length: 4, Url: "https://example.com/a_(b)"},
+				{Type: "text_mention", Offset: 5, Length: 4, User: &User{Id: 123}},
+				{Type: "custom_emoji", Offset: 10, Length: 2, CustomEmojiId: "5368324170671202286"},
+			},
+		},
+		"code": {
+			input: "`a_b*c\\`` ```go\nfmt.Println(\"*\")\n``` ```\nno language```",
+			text:  "a_b*c` fmt.Println(\"*\")\n no language",
+			entities: []MessageEntity{
+				{Type: "code", Offset: 0, Length: 6},
+				{Type: "pre", Offset: 7, Length: 17, Language: "go"},
+				{Type: "pre", Offset: 25, Length: 11},
+			},
+		},
+		"ambiguous underscores": {
+			input: "___italic underline_\r__",
+			text:  "italic underline",
+			entities: []MessageEntity{
+				{Type: "underline", Offset: 0, Length: 16},
+				{Type: "italic", Offset: 0, Length: 16},
+			},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			text, entities, err := ParseMarkdownV2(tc.input)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if text != tc.text {
+				t.Errorf("expected text %q, got %q", tc.text, text)
+			}
+			if len(entities) != 0 || len(tc.entities) != 0 {
+				if !reflect.DeepEqual(entities, tc.entities) {
+					t.Errorf("expected entities %+v, got %+v", tc.entities, entities)
+				}
+			}
+		})
+	}
+}
+
+func TestParseMarkdownV2Errors(t *testing.T) {
+	for input, offset := range map[string]int{
+		"hello.":               5,
+		"*unclosed":            0,
+		"*bold _italic*_":      14,
+		"`code":                0,
+		"[link](https://x.com": 6,
+		"![👍](https://x.com)":  0,
+		"a || b":               2,
+	} {
+		_, _, err := ParseMarkdownV2(input)
+		var parseErr *ParseError
+		if !errors.As(err, &parseErr) {
+			t.Errorf("expected parse error for %q, got %v", input, err)
+			continue
+		}
+		if parseErr.Offset != offset {
+			t.Errorf("expected error for %q at offset %d, got %d: %v", input, offset, parseErr.Offset, err)
+		}
+	}
+}
@@ -208,10 +208,17 @@ func fillBuffer(b *bytes.Buffer, params map[string]string, data map[string]Named
 			return "", fmt.Errorf("failed to create form file for field %s and fileName %s: %w", field, fileName, err)
 		}
 
+		if err = resetReader(file); err != nil {
+			return "", fmt.Errorf("failed to reset file of field %s: %w", field, err)
+		}
 		_, err = io.Copy(part, file)
+		closeErr := closeReader(file)
 		if err != nil {
 			return "", fmt.Errorf("failed to copy file contents of field %s to form: %w", field, err)
 		}
+		if closeErr != nil {
+			return "", fmt.Errorf("failed to close file of field %s: %w", field, closeErr)
+		}
 	}
 
 	if err := w.Close(); err != nil {
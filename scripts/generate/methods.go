@@ -409,6 +409,13 @@ type readerBranchesData struct {
 const readerBranch = `
 if {{.GoParam}} != nil {
 	switch m := {{.GoParam}}.(type) {
+	case InputFileSource:
+		attachment, err := m.Attach("{{.Name}}", data)
+		if err != nil {
+			return {{.DefaultReturn}}, fmt.Errorf("failed to attach field {{.Name}}: %w", err)
+		}
+		v["{{.Name}}"] = attachment
+
 	case NamedReader:
 		v["{{.Name}}"] = "attach://{{.Name}}"
 		data["{{.Name}}"] = m
@@ -432,6 +439,13 @@ if {{.GoParam}} != nil {
 	case string:
 		v["{{.Name}}"] = m
 
+	case InputFileSource:
+		attachment, err := m.Attach("{{.Name}}", data)
+		if err != nil {
+			return {{.DefaultReturn}}, fmt.Errorf("failed to attach field {{.Name}}: %w", err)
+		}
+		v["{{.Name}}"] = attachment
+
 	case NamedReader:
 		v["{{.Name}}"] = "attach://{{.Name}}"
 		data["{{.Name}}"] = m
@@ -703,6 +703,13 @@ func (v {{.Type}}) InputParams(mediaName string, data map[string]NamedReader) ([
 		case string:
 			// ok, noop
 
+		case InputFileSource:
+			attachment, err := m.Attach(mediaName, data)
+			if err != nil {
+				return nil, fmt.Errorf("failed to attach media: %w", err)
+			}
+			v.{{.Field}} = attachment
+
 		case NamedReader:
 			v.{{.Field}} = "attach://" + mediaName
 			data[mediaName] = m
@@ -0,0 +1,204 @@
+package gotgbot
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+)
+
+const (
+	// MaxMessageLength is the maximum length of a message's text, in UTF-16 code units.
+	MaxMessageLength = 4096
+	// MaxCaptionLength is the maximum length of a media caption, in UTF-16 code units.
+	MaxCaptionLength = 1024
+)
+
+var ErrUnsupportedParseMode = errors.New("unsupported parse mode")
+
+// atomicEntityTypes are the entity types which telegram rejects when only part of their text is included; eg, half a
+// url or a custom emoji.
+var atomicEntityTypes = map[string]bool{
+	"mention":      true,
+	"hashtag":      true,
+	"cashtag":      true,
+	"bot_command":  true,
+	"url":          true,
+	"email":        true,
+	"phone_number": true,
+	"text_mention": true,
+	"custom_emoji": true,
+}
+
+// TextChunk is a section of a longer text, along with its entities.
+type TextChunk struct {
+	Text     string
+	Entities []MessageEntity
+}
+
+// SplitText splits text and its entities into chunks of at most limit UTF-16 code units, so that each chunk can be sent
+// as a separate message. Entity offsets are rebased to the start of each chunk, and entities which span multiple
+// chunks are split between them. Atomic entities, such as mentions, urls and custom emojis, can't be split; chunks end
+// before them instead, and atomic entities which are longer than the limit are dropped.
+//
+// Chunks are split at paragraph breaks where possible, then line breaks, then spaces. The whitespace at which the
+// text is split is dropped, as are chunks which only contain whitespace, since telegram rejects empty messages. If a
+// chunk has no whitespace at all, it is cut at the limit, but never inside a surrogate pair.
+func SplitText(text string, entities []MessageEntity, limit int64) []TextChunk {
+	data := utf16.Encode([]rune(text))
+	if limit <= 0 || int64(len(data)) <= limit {
+		return []TextChunk{{Text: text, Entities: entities}}
+	}
+
+	var chunks []TextChunk
+	start := int64(0)
+	for start < int64(len(data)) {
+		end, next := splitPoint(data, entities, start, limit)
+		chunkText := string(utf16.Decode(data[start:end]))
+		if strings.TrimSpace(chunkText) != "" {
+			chunks = append(chunks, TextChunk{
+				Text:     chunkText,
+				Entities: clipEntities(entities, start, end),
+			})
+		}
+		start = next
+	}
+	return chunks
+}
+
+// splitPoint finds where to end the chunk starting at start. It returns the end of the chunk, and the start of the
+// next chunk; any whitespace between the two is dropped.
+func splitPoint(data []uint16, entities []MessageEntity, start int64, limit int64) (int64, int64) {
+	max := start + limit
+	if max >= int64(len(data)) {
+		return int64(len(data)), int64(len(data))
+	}
+
+	// Try to split at the last paragraph, line, or word boundary that fits in the chunk.
+	for _, sep := range [][]uint16{{'\n', '\n'}, {'\n'}, {' '}, {'\t'}} {
+		// The separator itself doesn't need to fit in the chunk, since it gets dropped.
+		for i := max; i > start; i-- {
+			if i+int64(len(sep)) > int64(len(data)) || !isSeparatorAt(data, i, sep) {
+				continue
+			}
+			if _, ok := atomicEntityStart(entities, start, i); !ok {
+				return i, i + int64(len(sep))
+			}
+		}
+	}
+
+	// No whitespace; cut at the limit, making sure not to split an atomic entity or a surrogate pair.
+	if entStart, ok := atomicEntityStart(entities, start, max); ok {
+		return entStart, entStart
+	}
+	if utf16.IsSurrogate(rune(data[max-1])) && data[max-1] < 0xDC00 && max-1 > start {
+		return max - 1, max - 1
+	}
+	return max, max
+}
+
+func isSeparatorAt(data []uint16, i int64, sep []uint16) bool {
+	for j, c := range sep {
+		if data[i+int64(j)] != c {
+			return false
+		}
+	}
+	return true
+}
+
+// atomicEntityStart returns the start of the earliest atomic entity which would be cut by ending the chunk starting at
+// start at i, if any. Atomic entities which begin at the start of the chunk are too long to fit in any chunk, so they
+// are ignored; clipEntities drops them.
+func atomicEntityStart(entities []MessageEntity, start int64, i int64) (int64, bool) {
+	entStart, found := int64(0), false
+	for _, ent := range entities {
+		if !atomicEntityTypes[ent.Type] || ent.Offset <= start || ent.Offset >= i || ent.Offset+ent.Length <= i {
+			continue
+		}
+		if !found || ent.Offset < entStart {
+			entStart, found = ent.Offset, true
+		}
+	}
+	return entStart, found
+}
+
+// clipEntities returns the parts of the entities which fall between start and end, rebased to start. Atomic entities
+// are only included if they fit entirely within the chunk.
+func clipEntities(entities []MessageEntity, start int64, end int64) []MessageEntity {
+	var out []MessageEntity
+	for _, ent := range entities {
+		if atomicEntityTypes[ent.Type] && (ent.Offset < start || ent.Offset+ent.Length > end) {
+			continue
+		}
+		entStart, entEnd := ent.Offset, ent.Offset+ent.Length
+		if entStart < start {
+			entStart = start
+		}
+		if entEnd > end {
+			entEnd = end
+		}
+		if entEnd <= entStart {
+			continue
+		}
+
+		ent.Offset = entStart - start
+		ent.Length = entEnd - entStart
+		out = append(out, ent)
+	}
+	return out
+}
+
+// SendLongMessage sends text which may be longer than MaxMessageLength, by splitting it with SplitText and sending
+// each chunk as a reply to the previous one. The ReplyMarkup is only attached to the last message.
+//
+// If opts.ParseMode is HTML or MarkdownV2, the text is parsed locally with ParseHTML or ParseMarkdownV2 so that
+// entities can be split correctly; legacy Markdown is not supported.
+// If sending a chunk fails, the messages sent so far are returned along with the error.
+func (bot *Bot) SendLongMessage(chatId int64, text string, opts *SendMessageOpts) ([]*Message, error) {
+	var chunkOpts SendMessageOpts
+	if opts != nil {
+		chunkOpts = *opts
+	}
+
+	entities := chunkOpts.Entities
+	switch chunkOpts.ParseMode {
+	case ParseModeNone:
+	case ParseModeHTML, ParseModeMarkdownV2:
+		var err error
+		if chunkOpts.ParseMode == ParseModeHTML {
+			text, entities, err = ParseHTML(text)
+		} else {
+			text, entities, err = ParseMarkdownV2(text)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse text: %w", err)
+		}
+		chunkOpts.ParseMode = ParseModeNone
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedParseMode, chunkOpts.ParseMode)
+	}
+
+	chunks := SplitText(text, entities, MaxMessageLength)
+	replyMarkup := chunkOpts.ReplyMarkup
+
+	msgs := make([]*Message, 0, len(chunks))
+	for i, chunk := range chunks {
+		chunkOpts.Entities = chunk.Entities
+		chunkOpts.ReplyMarkup = nil
+		if i == len(chunks)-1 {
+			chunkOpts.ReplyMarkup = replyMarkup
+		}
+		if i > 0 {
+			chunkOpts.ReplyToMessageId = msgs[i-1].MessageId
+		}
+
+		// Copy the opts, in case the BotClient keeps a reference to them.
+		sendOpts := chunkOpts
+		msg, err := bot.SendMessage(chatId, chunk.Text, &sendOpts)
+		if err != nil {
+			return msgs, fmt.Errorf("failed to send message %d of %d: %w", i+1, len(chunks), err)
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs, nil
+}
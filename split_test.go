@@ -0,0 +1,149 @@
+package gotgbot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitText(t *testing.T) {
+	for name, tc := range map[string]struct {
+		text     string
+		entities []MessageEntity
+		limit    int64
+		want     []TextChunk
+	}{
+		"short text is unchanged": {
+			text:     "hello",
+			entities: []MessageEntity{{Type: "bold", Offset: 0, Length: 5}},
+			limit:    10,
+			want:     []TextChunk{{Text: "hello", Entities: []MessageEntity{{Type: "bold", Offset: 0, Length: 5}}}},
+		},
+		"paragraphs are preferred over lines": {
+			text:  "aaa\nbb\n\ncc\ndd",
+			limit: 10,
+			want:  []TextChunk{{Text: "aaa\nbb"}, {Text: "cc\ndd"}},
+		},
+		"lines are preferred over words": {
+			text:  "aa bb\ncc dd",
+			limit: 8,
+			want:  []TextChunk{{Text: "aa bb"}, {Text: "cc dd"}},
+		},
+		"words": {
+			text:  "one two three",
+			limit: 9,
+			want:  []TextChunk{{Text: "one two"}, {Text: "three"}},
+		},
+		"hard cut": {
+			text:  "abcdefgh",
+			limit: 3,
+			want:  []TextChunk{{Text: "abc"}, {Text: "def"}, {Text: "gh"}},
+		},
+		"surrogate pairs are not cut": {
+			text:  "ab😀cd",
+			limit: 3,
+			want:  []TextChunk{{Text: "ab"}, {Text: "😀c"}, {Text: "d"}},
+		},
+		"entities are clipped and rebased": {
+			text: "bold text here",
+			entities: []MessageEntity{
+				{Type: "bold", Offset: 0, Length: 9},
+				{Type: "italic", Offset: 10, Length: 4},
+			},
+			limit: 6,
+			want: []TextChunk{
+				{Text: "bold", Entities: []MessageEntity{{Type: "bold", Offset: 0, Length: 4}}},
+				{Text: "text", Entities: []MessageEntity{{Type: "bold", Offset: 0, Length: 4}}},
+				{Text: "here", Entities: []MessageEntity{{Type: "italic", Offset: 0, Length: 4}}},
+			},
+		},
+		"entity offsets use utf16": {
+			text:     "😀 😀 bold",
+			entities: []MessageEntity{{Type: "bold", Offset: 6, Length: 4}},
+			limit:    5,
+			want: []TextChunk{
+				{Text: "😀 😀"},
+				{Text: "bold", Entities: []MessageEntity{{Type: "bold", Offset: 0, Length: 4}}},
+			},
+		},
+		"whitespace-only chunks are dropped": {
+			text:  "\n\n\nabc def",
+			limit: 4,
+			want:  []TextChunk{{Text: "abc"}, {Text: "def"}},
+		},
+		"atomic entities are not split at whitespace": {
+			text:     "hi John Smith",
+			entities: []MessageEntity{{Type: "text_mention", Offset: 3, Length: 10}},
+			limit:    10,
+			want: []TextChunk{
+				{Text: "hi"},
+				{Text: "John Smith", Entities: []MessageEntity{{Type: "text_mention", Offset: 0, Length: 10}}},
+			},
+		},
+		"atomic entities are not cut": {
+			text:     "abchttp://x.y",
+			entities: []MessageEntity{{Type: "url", Offset: 3, Length: 10}},
+			limit:    6,
+			// The url is longer than the limit, so it is dropped rather than cut.
+			want: []TextChunk{{Text: "abc"}, {Text: "http:/"}, {Text: "/x.y"}},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			got := SplitText(tc.text, tc.entities, tc.limit)
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("expected %#v, got %#v", tc.want, got)
+			}
+		})
+	}
+}
+
+// sentMessagesBotClient is a fake BotClient which records all sent messages.
+type sentMessagesBotClient struct {
+	BaseBotClient
+	sent []map[string]string
+}
+
+func (c *sentMessagesBotClient) RequestWithContext(_ context.Context, _ string, params map[string]string, _ map[string]NamedReader, _ *RequestOpts) (json.RawMessage, error) {
+	c.sent = append(c.sent, params)
+	return json.RawMessage(fmt.Sprintf(`{"message_id": %d}`, 100+len(c.sent))), nil
+}
+
+func TestBot_SendLongMessage(t *testing.T) {
+	client := &sentMessagesBotClient{}
+	b := Bot{BotClient: client}
+
+	text := "<b>" + strings.Repeat("word ", 1000) + "</b>"
+	msgs, err := b.SendLongMessage(1, text, &SendMessageOpts{
+		ParseMode:        ParseModeHTML,
+		ReplyToMessageId: 42,
+		ReplyMarkup:      InlineKeyboardMarkup{InlineKeyboard: [][]InlineKeyboardButton{{{Text: "ok", CallbackData: "ok"}}}},
+	})
+	if err != nil {
+		t.Fatalf("failed to send long message: %v", err)
+	}
+	if len(msgs) != 2 || len(client.sent) != 2 {
+		t.Fatalf("expected 2 messages to be sent, got %d", len(client.sent))
+	}
+
+	for i, params := range client.sent {
+		if params["parse_mode"] != "" {
+			t.Errorf("message %d: expected no parse mode, got %q", i, params["parse_mode"])
+		}
+		if !strings.Contains(params["entities"], `"bold"`) {
+			t.Errorf("message %d: expected bold entities, got %s", i, params["entities"])
+		}
+	}
+	if client.sent[0]["reply_to_message_id"] != "42" || client.sent[1]["reply_to_message_id"] != "101" {
+		t.Errorf("expected a reply chain, got replies to %s and %s", client.sent[0]["reply_to_message_id"], client.sent[1]["reply_to_message_id"])
+	}
+	if client.sent[0]["reply_markup"] != "" || client.sent[1]["reply_markup"] == "" {
+		t.Errorf("expected reply markup on the last message only")
+	}
+
+	if _, err := b.SendLongMessage(1, "*legacy*", &SendMessageOpts{ParseMode: ParseModeMarkdown}); err == nil {
+		t.Errorf("expected legacy markdown to be rejected")
+	}
+}
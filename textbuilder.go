@@ -0,0 +1,155 @@
+package gotgbot
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// TextBuilder builds formatted message text as plain text and a list of MessageEntity items, removing the need to
+// escape any HTML or markdown. Entity offsets are calculated in UTF-16 code units, as expected by telegram.
+//
+// The output can be passed to SendMessageOpts.Entities, or any CaptionEntities field, without setting a ParseMode.
+// This is the inverse of Message.ParseEntities.
+//
+// The zero value is ready to use.
+type TextBuilder struct {
+	text strings.Builder
+	// length is the current length of the text, in UTF-16 code units.
+	length   int64
+	entities []MessageEntity
+}
+
+// NewTextBuilder creates a new, empty TextBuilder.
+func NewTextBuilder() *TextBuilder {
+	return &TextBuilder{}
+}
+
+// Text returns the plain text built so far.
+func (tb *TextBuilder) Text() string {
+	return tb.text.String()
+}
+
+// Entities returns the entities of the text built so far, ordered by offset.
+func (tb *TextBuilder) Entities() []MessageEntity {
+	out := make([]MessageEntity, 0, len(tb.entities))
+	for _, ent := range tb.entities {
+		// Empty entities are dropped, since telegram rejects them.
+		if ent.Length > 0 {
+			out = append(out, ent)
+		}
+	}
+	return out
+}
+
+// Len returns the length of the text built so far, in UTF-16 code units; this is how telegram measures message length.
+func (tb *TextBuilder) Len() int64 {
+	return tb.length
+}
+
+// Plain appends unformatted text.
+func (tb *TextBuilder) Plain(text string) *TextBuilder {
+	tb.text.WriteString(text)
+	tb.length += utf16Len(text)
+	return tb
+}
+
+// Bold appends bold text.
+func (tb *TextBuilder) Bold(text string) *TextBuilder {
+	return tb.Entity(text, MessageEntity{Type: "bold"})
+}
+
+// Italic appends italic text.
+func (tb *TextBuilder) Italic(text string) *TextBuilder {
+	return tb.Entity(text, MessageEntity{Type: "italic"})
+}
+
+// Underline appends underlined text.
+func (tb *TextBuilder) Underline(text string) *TextBuilder {
+	return tb.Entity(text, MessageEntity{Type: "underline"})
+}
+
+// Strikethrough appends strikethrough text.
+func (tb *TextBuilder) Strikethrough(text string) *TextBuilder {
+	return tb.Entity(text, MessageEntity{Type: "strikethrough"})
+}
+
+// Spoiler appends text hidden behind a spoiler.
+func (tb *TextBuilder) Spoiler(text string) *TextBuilder {
+	return tb.Entity(text, MessageEntity{Type: "spoiler"})
+}
+
+// Code appends inline monowidth text.
+func (tb *TextBuilder) Code(text string) *TextBuilder {
+	return tb.Entity(text, MessageEntity{Type: "code"})
+}
+
+// Pre appends a monowidth code block, with an optional programming language.
+func (tb *TextBuilder) Pre(text string, language string) *TextBuilder {
+	return tb.Entity(text, MessageEntity{Type: "pre", Language: language})
+}
+
+// Link appends text linking to the given URL.
+func (tb *TextBuilder) Link(text string, url string) *TextBuilder {
+	return tb.Entity(text, MessageEntity{Type: "text_link", Url: url})
+}
+
+// TextMention appends text mentioning the given user; this works for users without a username.
+func (tb *TextBuilder) TextMention(text string, user User) *TextBuilder {
+	return tb.Entity(text, MessageEntity{Type: "text_mention", User: &user})
+}
+
+// CustomEmoji appends a custom emoji. The text must be a regular emoji, which is shown where custom emoji are not
+// supported.
+func (tb *TextBuilder) CustomEmoji(emoji string, customEmojiId string) *TextBuilder {
+	return tb.Entity(emoji, MessageEntity{Type: "custom_emoji", CustomEmojiId: customEmojiId})
+}
+
+// Entity appends text formatted with the given entity. The entity's offset and length are set automatically.
+// Empty text is appended without an entity, since telegram rejects empty entities.
+func (tb *TextBuilder) Entity(text string, ent MessageEntity) *TextBuilder {
+	return tb.Wrap(ent, func(tb *TextBuilder) {
+		tb.Plain(text)
+	})
+}
+
+// Wrap applies the given entity to all the text appended by the build function, allowing for nested formatting.
+// For example, to write bold text containing a link:
+//
+//	tb.Wrap(MessageEntity{Type: "bold"}, func(tb *TextBuilder) {
+//		tb.Plain("see ").Link("here", "https://example.com")
+//	})
+func (tb *TextBuilder) Wrap(ent MessageEntity, build func(tb *TextBuilder)) *TextBuilder {
+	idx := tb.openEntity(ent)
+	build(tb)
+	tb.closeEntity(idx)
+	return tb
+}
+
+// openEntity adds an entity starting at the end of the current text, and returns its index so it can be closed once
+// its contents have been written. Entities are added when opened rather than when closed, so that outer entities
+// always come before the entities nested within them.
+func (tb *TextBuilder) openEntity(ent MessageEntity) int {
+	ent.Offset = tb.length
+	ent.Length = 0
+	tb.entities = append(tb.entities, ent)
+	return len(tb.entities) - 1
+}
+
+// closeEntity sets the length of an opened entity to cover all the text written since it was opened.
+func (tb *TextBuilder) closeEntity(idx int) {
+	tb.entities[idx].Length = tb.length - tb.entities[idx].Offset
+}
+
+// utf16Len returns the length of the string in UTF-16 code units.
+func utf16Len(s string) int64 {
+	var n int64
+	for _, r := range s {
+		if r >= 0x10000 && r <= utf8.MaxRune {
+			// Characters outside the basic multilingual plane are encoded as surrogate pairs.
+			n += 2
+			continue
+		}
+		n++
+	}
+	return n
+}
@@ -0,0 +1,48 @@
+package gotgbot
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTextBuilder(t *testing.T) {
+	tb := NewTextBuilder().
+		Plain("Hi 👋 ").
+		Bold("John").
+		Plain(", see ").
+		Wrap(MessageEntity{Type: "italic"}, func(tb *TextBuilder) {
+			tb.Plain("the ").Link("docs", "https://example.com")
+		}).
+		Plain(" ").
+		CustomEmoji("🔥", "5368324170671202286").
+		Code("").
+		Pre("fmt.Println()", "go")
+
+	expectedText := "Hi 👋 John, see the docs 🔥fmt.Println()"
+	if tb.Text() != expectedText {
+		t.Errorf("expected text %q, got %q", expectedText, tb.Text())
+	}
+
+	// The waving hand emoji is two UTF-16 code units long.
+	expectedEntities := []MessageEntity{
+		{Type: "bold", Offset: 6, Length: 4},
+		{Type: "italic", Offset: 16, Length: 8},
+		{Type: "text_link", Offset: 20, Length: 4, Url: "https://example.com"},
+		{Type: "custom_emoji", Offset: 25, Length: 2, CustomEmojiId: "5368324170671202286"},
+		{Type: "pre", Offset: 27, Length: 13, Language: "go"},
+	}
+	if !reflect.DeepEqual(tb.Entities(), expectedEntities) {
+		t.Errorf("expected entities %+v, got %+v", expectedEntities, tb.Entities())
+	}
+	if tb.Len() != 40 {
+		t.Errorf("expected length 40, got %d", tb.Len())
+	}
+
+	// Parsing the entities again gives back the original contents.
+	m := Message{Text: tb.Text(), Entities: tb.Entities()}
+	for i, expected := range []string{"John", "the docs", "docs", "🔥", "fmt.Println()"} {
+		if text := m.ParseEntity(m.Entities[i]).Text; text != expected {
+			t.Errorf("expected entity %d to contain %q, got %q", i, expected, text)
+		}
+	}
+}